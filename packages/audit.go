@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultAuditMaxSize = 10 << 20
+
+// AuditRecord is one line of ~/.vira/audit.log.
+type AuditRecord struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Package  string    `json:"package,omitempty"`
+	Version  string    `json:"version,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Checksum string    `json:"checksum,omitempty"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func auditPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".vira", "audit.log")
+}
+
+// auditMaxSize is the size at which the log is rotated to audit.log.1,
+// overridable with VIRA_AUDIT_MAX_SIZE (in bytes).
+func auditMaxSize() int64 {
+	if v := os.Getenv("VIRA_AUDIT_MAX_SIZE"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultAuditMaxSize
+}
+
+// recordAudit appends an entry for action on pkg. Failing to write the
+// log is reported but never fails the command itself.
+func recordAudit(action string, pkg string, resolved PlatformEntry, opErr error) {
+	rec := AuditRecord{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		Package:  pkg,
+		URL:      resolved.URL,
+		Checksum: resolved.Integrity,
+		Success:  opErr == nil,
+	}
+	if name, version, ok := strings.Cut(pkg, "@"); ok {
+		rec.Package, rec.Version = name, version
+	}
+	if opErr != nil {
+		rec.Error = opErr.Error()
+	}
+	if err := appendAudit(auditPath(), rec); err != nil {
+		warn(codeAuditLog, "", "could not write audit log: %v", err)
+	}
+}
+
+func appendAudit(path string, rec AuditRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() >= auditMaxSize() {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// audit prints log entries matching pkg (if set) within [since, until].
+// Zero times leave that side of the range open.
+func audit(pkg string, since, until time.Time) error {
+	file, err := os.Open(auditPath())
+	if os.IsNotExist(err) {
+		fmt.Println("No audit entries")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("corrupt audit log entry: %v", err)
+		}
+		if pkg != "" && rec.Package != pkg {
+			continue
+		}
+		if (!since.IsZero() && rec.Time.Before(since)) || (!until.IsZero() && rec.Time.After(until)) {
+			continue
+		}
+		status := "ok"
+		if !rec.Success {
+			status = "failed: " + rec.Error
+		}
+		fields := []string{rec.Time.Format(time.RFC3339), rec.Action}
+		for _, f := range []string{auditName(rec), rec.URL, rec.Checksum} {
+			if f != "" {
+				fields = append(fields, f)
+			}
+		}
+		fmt.Println(strings.Join(append(fields, status), " "))
+	}
+	return scanner.Err()
+}
+
+func auditName(rec AuditRecord) string {
+	if rec.Version != "" {
+		return rec.Package + "@" + rec.Version
+	}
+	return rec.Package
+}
+
+// parseAuditDate accepts YYYY-MM-DD or RFC 3339. An empty string is the
+// zero time. With endOfDay, a plain date covers the whole day.
+func parseAuditDate(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+func binDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".vira", "bin")
+}
+
+// projectBinDir holds the shims of a project's dependencies, which run
+// puts on PATH.
+func projectBinDir() string {
+	return filepath.Join("build", "dependencies", "bin")
+}
+
+// packageBins returns the executables pkgName declares in the cached index,
+// mapping command name to a path inside the package.
+func packageBins(pkgName string) map[string]string {
+	meta, _ := indexVersion(pkgName)
+	return meta.Bin
+}
+
+// shimPath is where the shim for command lives in dir; Windows gets a
+// .cmd wrapper instead of a symlink.
+func shimPath(dir string, command string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(dir, command+".cmd")
+	}
+	return filepath.Join(dir, command)
+}
+
+// shimTarget returns what an existing shim points at.
+func shimTarget(path string) (string, error) {
+	if runtime.GOOS == "windows" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		line := strings.TrimPrefix(strings.TrimSpace(string(data)), "@")
+		return strings.Trim(strings.TrimSuffix(line, " %*"), `"`), nil
+	}
+	return os.Readlink(path)
+}
+
+// linkBins creates shims in dir, ~/.vira/bin or projectBinDir, for the
+// executables of the package extracted at pkgDir. A command already
+// provided by another package is an error; shims from a previous install
+// of the same package are replaced. Nothing is linked when an entry names
+// a command with a path in it or an executable outside pkgDir.
+func linkBins(pkgName string, pkgDir string, dir string) error {
+	bins := packageBins(pkgName)
+	if len(bins) == 0 {
+		return nil
+	}
+	pkgDir, err := filepath.Abs(pkgDir)
+	if err != nil {
+		return err
+	}
+	targets := map[string]string{}
+	for command, bin := range bins {
+		if command == "" || command == "." || command == ".." || strings.ContainsAny(command, `/\`) {
+			return fmt.Errorf("%s: bin command %q is not a plain name", pkgName, command)
+		}
+		target := filepath.Join(pkgDir, bin)
+		if !strings.HasPrefix(target, pkgDir+string(os.PathSeparator)) {
+			return fmt.Errorf("%s: bin %s points outside the package (%s)", pkgName, command, bin)
+		}
+		targets[command] = target
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, command := range slices.Sorted(maps.Keys(targets)) {
+		target := targets[command]
+		path := shimPath(dir, command)
+		if existing, err := shimTarget(path); err == nil {
+			if !strings.HasPrefix(existing, pkgDir+string(os.PathSeparator)) {
+				return fmt.Errorf("%s is already provided by %s", command, existing)
+			}
+			os.Remove(path)
+		} else if _, err := os.Lstat(path); err == nil {
+			return fmt.Errorf("%s already exists and is not a package shim", path)
+		}
+		if runtime.GOOS == "windows" {
+			err = os.WriteFile(path, []byte("@\""+target+"\" %*\r\n"), 0755)
+		} else {
+			os.Chmod(target, 0755)
+			err = os.Symlink(target, path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unlinkBins removes every shim in dir that points into pkgDir.
+func unlinkBins(pkgDir string, dir string) error {
+	pkgDir, err := filepath.Abs(pkgDir)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		target, err := shimTarget(path)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(target, pkgDir+string(os.PathSeparator)) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBinIndex caches an index in which tool@1.0.0 declares bins.
+func writeBinIndex(t *testing.T, home string, bins map[string]string) {
+	t.Helper()
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"tool": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Bin: bins}}},
+	}})
+}
+
+func TestLinkBins(t *testing.T) {
+	tests := []struct {
+		name    string
+		bins    map[string]string
+		want    []string
+		wantErr string
+	}{
+		{"links declared commands", map[string]string{"tool": "bin/tool", "tool-helper": "helper.sh"}, []string{"tool", "tool-helper"}, ""},
+		{"dot segments inside the package", map[string]string{"tool": "./lib/../bin/tool"}, []string{"tool"}, ""},
+		{"target escapes the package", map[string]string{"tool": "bin/tool", "key": "../../.ssh/id_rsa"}, nil, "points outside the package"},
+		{"target is the package directory", map[string]string{"tool": "."}, nil, "points outside the package"},
+		{"command with a path", map[string]string{"../evil": "bin/tool"}, nil, "not a plain name"},
+		{"command with a backslash", map[string]string{`..\evil`: "bin/tool"}, nil, "not a plain name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := testHome(t)
+			writeBinIndex(t, home, tt.bins)
+			root := t.TempDir()
+			pkgDir := filepath.Join(root, "libs", "tool")
+			secret := filepath.Join(root, ".ssh", "id_rsa")
+			for _, f := range []string{filepath.Join(pkgDir, "bin", "tool"), filepath.Join(pkgDir, "helper.sh"), secret} {
+				os.MkdirAll(filepath.Dir(f), 0755)
+				os.WriteFile(f, []byte("x"), 0600)
+			}
+			dir := filepath.Join(root, "bin")
+
+			err := linkBins("tool", pkgDir, dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+					t.Errorf("rejected bins still created %d shims", len(entries))
+				}
+				if info, _ := os.Stat(secret); info.Mode().Perm() != 0600 {
+					t.Errorf("file outside the package chmodded to %o", info.Mode().Perm())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, command := range tt.want {
+				target, err := shimTarget(shimPath(dir, command))
+				if err != nil || !strings.HasPrefix(target, pkgDir+string(os.PathSeparator)) {
+					t.Errorf("shim %s points at %q (%v), want a file in %s", command, target, err, pkgDir)
+				}
+			}
+			if err := unlinkBins(pkgDir, dir); err != nil {
+				t.Fatal(err)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+				t.Errorf("%d shims left after unlinkBins", len(entries))
+			}
+		})
+	}
+}
+
+func TestLinkBinsCollision(t *testing.T) {
+	home := testHome(t)
+	writeBinIndex(t, home, map[string]string{"tool": "bin/tool"})
+	root := t.TempDir()
+	dir := filepath.Join(root, "bin")
+	for _, name := range []string{"tool", "other"} {
+		os.MkdirAll(filepath.Join(root, name, "bin"), 0755)
+		os.WriteFile(filepath.Join(root, name, "bin", "tool"), []byte("x"), 0755)
+	}
+	if err := linkBins("tool", filepath.Join(root, "other"), dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkBins("tool", filepath.Join(root, "tool"), dir); err == nil || !strings.Contains(err.Error(), "already provided by") {
+		t.Errorf("got %v, want a collision error", err)
+	}
+	// Reinstalling the same package replaces its own shims.
+	if err := linkBins("tool", filepath.Join(root, "other"), dir); err != nil {
+		t.Errorf("relinking the same package: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Bundle is a single-file offline bundle: a tar of index.json and the
+// package archives it lists, as written by the bundle command. Opening
+// one unpacks it into Dir, which then serves as a --from-dir registry.
+type Bundle struct {
+	Path  string
+	Dir   string
+	Index *Index
+}
+
+// openBundle unpacks the bundle at path into the cache, keyed by its
+// checksum so reopening the same file reuses the copy, and checks its
+// index. Only plain files at the top level of the tar are accepted.
+func openBundle(ctx context.Context, path string) (*Bundle, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(os.Getenv("HOME"), ".vira", "cache", "bundles", hex.EncodeToString(h.Sum(nil))[:16])
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err != nil {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := unpackBundle(ctx, file, dir, path); err != nil {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a package bundle: %v", path, err)
+	}
+	if err := validateIndex(data); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	b := &Bundle{Path: path, Dir: dir, Index: &Index{}}
+	if err := json.Unmarshal(data, b.Index); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// unpackBundle extracts r into dir through a staging directory, so an
+// interrupted unpack is never mistaken for a complete one.
+func unpackBundle(ctx context.Context, r io.Reader, dir string, path string) error {
+	staging := dir + ".staging"
+	os.RemoveAll(staging)
+	defer track(staging)()
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	tr := tar.NewReader(ctxReader{ctx, r})
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("%s is not a package bundle: %v", path, err)
+		}
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if hdr.Typeflag != tar.TypeReg || name != filepath.Base(name) || name == ".." || strings.HasPrefix(name, ".") {
+			return fmt.Errorf("%s: unexpected bundle entry %q", path, hdr.Name)
+		}
+		out, err := os.Create(filepath.Join(staging, name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	os.RemoveAll(dir)
+	return os.Rename(staging, dir)
+}
+
+// writeBundle fetches specs and their dependencies and packs them with
+// their index into the single file out.
+func writeBundle(ctx context.Context, specs []string, out string, maxDepth int) error {
+	if len(specs) == 0 {
+		return fmt.Errorf("nothing to bundle")
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(out), ".bundle-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if _, _, err := fetchBundle(ctx, specs, tmp, maxDepth); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		return err
+	}
+	part := out + ".part"
+	defer track(part)()
+	file, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(part)
+	tw := tar.NewWriter(file)
+	count := 0
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if err := addBundleFile(tw, filepath.Join(tmp, e.Name())); err != nil {
+			file.Close()
+			return err
+		}
+		if e.Name() != "index.json" {
+			count++
+		}
+	}
+	if err := tw.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(part, out); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s with %d packages\n", out, count)
+	return nil
+}
+
+func addBundleFile(tw *tar.Writer, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// projectBundleSpecs lists the dependencies of the project in the current
+// directory, for bundle without package names.
+func projectBundleSpecs() ([]string, error) {
+	if err := enterProjectRoot(); err != nil {
+		return nil, err
+	}
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := readLock(lockFile)
+	if err != nil {
+		return nil, err
+	}
+	deps, err := environmentDependencies(m, lock.Environment)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(deps, m.DevDependencies)
+	index, _ := loadIndex()
+	var specs []string
+	for _, name := range slices.Sorted(maps.Keys(deps)) {
+		specs = append(specs, dependencySpec(index, name, deps[name]))
+	}
+	return specs, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnpackBundleRejectsEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry tarEntry
+	}{
+		{"parent path", tarEntry{name: "../index.json", body: "{}"}},
+		{"subdirectory", tarEntry{name: "sub/math.tar.gz", body: "x"}},
+		{"absolute path", tarEntry{name: "/etc/passwd", body: "x"}},
+		{"hidden file", tarEntry{name: ".profile", body: "x"}},
+		{"directory", tarEntry{name: "sub/", typ: tar.TypeDir, mode: 0755}},
+		{"symlink", tarEntry{name: "math.tar.gz", typ: tar.TypeSymlink, link: "/etc/passwd"}},
+		{"hardlink", tarEntry{name: "math.tar.gz", typ: tar.TypeLink, link: "index.json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "bundle")
+			data := makeTar(t, []tarEntry{{name: "index.json", body: "{}"}, tt.entry})
+			err := unpackBundle(t.Context(), bytes.NewReader(data), dir, "test.tar")
+			if err == nil || !strings.Contains(err.Error(), "unexpected bundle entry") {
+				t.Fatalf("got %v, want the entry refused", err)
+			}
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Errorf("refused bundle left %s behind", dir)
+			}
+			if _, err := os.Stat(dir + ".staging"); !os.IsNotExist(err) {
+				t.Errorf("refused bundle left its staging directory behind")
+			}
+		})
+	}
+}
+
+func TestUnpackBundle(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "bundle")
+	data := makeTar(t, []tarEntry{{name: "index.json", body: "{}"}, {name: "./math.tar.gz", body: "archive"}})
+	if err := unpackBundle(t.Context(), bytes.NewReader(data), dir, "test.tar"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "math.tar.gz"))
+	if err != nil || string(got) != "archive" {
+		t.Fatalf("math.tar.gz = %q, %v", got, err)
+	}
+}
+
+// TestBundleRoundTripsPinnedVersion bundles a project that pins an older
+// math and installs it again from the bundle alone.
+func TestBundleRoundTripsPinnedVersion(t *testing.T) {
+	fetchFixture(t)
+	wd, _ := os.Getwd()
+	project := t.TempDir()
+	if err := os.Chdir(project); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	warningsQuiet = true
+	defer func() { warningsQuiet = false }()
+	manifest := "name: app\nversion: 0.1.0\ndependencies:\n  math: 1.0.0\n"
+	if err := os.WriteFile(manifestFile, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	specs, err := projectBundleSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(specs, " ") != "math@1.0.0" {
+		t.Fatalf("bundle specs %v, want [math@1.0.0]", specs)
+	}
+	path := filepath.Join(t.TempDir(), "deps.tar")
+	if _, err := captureStdout(t, func() error { return writeBundle(t.Context(), specs, path, defaultMaxDepth) }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Install with nothing but the bundle: no cached index, no registry.
+	testHome(t)
+	c, err := newHTTPClient(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	useClient(t, c)
+	b, err := openBundle(t.Context(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := useLocalRegistry(b.Dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { localRegistry = "" })
+	if _, err := captureStdout(t, func() error {
+		return installEnvironment(t.Context(), "", InstallOptions{InProject: true, MaxDepth: defaultMaxDepth})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join("build", "dependencies", "math@1.0.0", "lib.vira"))
+	if err != nil || string(got) != "1.0.0" {
+		t.Errorf("installed math is %q (%v), want 1.0.0", got, err)
+	}
+	lock, err := readLock(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := lock.Packages["math@1.0.0"]; entry == nil || entry.Version != "1.0.0" {
+		t.Errorf("lock entry for math@1.0.0 is %+v", entry)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxIncrementalAge is how old the cached index may be before refresh
+// stops asking for changes and fetches the whole index again.
+const maxIncrementalAge = 7 * 24 * time.Hour
+
+// refreshState is kept next to the cached index to make refreshes
+// incremental.
+type refreshState struct {
+	LastRefresh time.Time `json:"lastRefresh"`
+}
+
+// IndexChanges is the response of index/changes?since=<RFC 3339 time>:
+// the packages added or changed since then, with their full entries, and
+// the names removed. Until is the server time the changes run up to.
+type IndexChanges struct {
+	Until    time.Time               `json:"until"`
+	Packages map[string]IndexPackage `json:"packages"`
+	Removed  []string                `json:"removed,omitempty"`
+}
+
+func refreshStatePath() string {
+	return filepath.Join(filepath.Dir(indexPath()), "index.state")
+}
+
+func readRefreshState() refreshState {
+	var state refreshState
+	if data, err := os.ReadFile(refreshStatePath()); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+func writeRefreshState(t time.Time) error {
+	data, err := json.Marshal(refreshState{LastRefresh: t.UTC()})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(refreshStatePath(), data, 0644)
+}
+
+// defaultIndexTTL is how old the cached index may get before commands
+// suggest a refresh, unless index-ttl is configured.
+const defaultIndexTTL = 7 * 24 * time.Hour
+
+// indexTTL returns the configured index-ttl; 0 turns the warning off.
+func indexTTL() time.Duration {
+	values, err := readConfigValues()
+	if err != nil {
+		return defaultIndexTTL
+	}
+	if ttl, err := time.ParseDuration(values["index-ttl"]); err == nil {
+		return ttl
+	}
+	return defaultIndexTTL
+}
+
+// indexAge returns how long ago the cached index was refreshed. Caches
+// from before refresh kept a state file, and sharded ones, fall back to
+// the file's modification time. The age is negative when the recorded
+// time lies in the future.
+func indexAge() (time.Duration, error) {
+	if state := readRefreshState(); !state.LastRefresh.IsZero() {
+		return time.Since(state.LastRefresh), nil
+	}
+	info, err := os.Stat(indexPath())
+	if os.IsNotExist(err) {
+		info, err = os.Stat(filepath.Join(shardDir(), "shards.json"))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(info.ModTime()), nil
+}
+
+// warnStaleIndex warns when the cached index is older than the TTL, or
+// seems to come from the future because of clock skew. pkgName, when set,
+// is a package about to be installed at its latest version. Bundles
+// installed with --from-dir carry their own index and are never stale.
+func warnStaleIndex(pkgName string) {
+	ttl := indexTTL()
+	if localRegistry != "" || ttl <= 0 {
+		return
+	}
+	age, err := indexAge()
+	switch {
+	case err != nil:
+		return
+	case age < -time.Minute:
+		warn(codeClockSkew, "", "the cached index was refreshed in the future, check the system clock and run refresh")
+	case age > ttl:
+		days := int(age.Hours() / 24)
+		warn(codeStaleIndex, "", "the cached index is %d days old, run refresh", days)
+		if pkgName != "" {
+			warn(codeStaleIndex, pkgName, "a newer version of %s than the cached index knows may exist", pkgName)
+		}
+	}
+}
+
+// mergeIndexChanges applies changes to a cached index.
+func mergeIndexChanges(index *Index, changes *IndexChanges) {
+	for name, pkg := range changes.Packages {
+		index.Packages[name] = pkg
+	}
+	for _, name := range changes.Removed {
+		delete(index.Packages, name)
+	}
+}
+
+// refreshIncremental updates the cached index from index/changes,
+// returning the merged index and the time to record. It reports false
+// when a full fetch is needed instead: no usable cache, a cache older than
+// maxIncrementalAge, a signed index (changes are not signed), a local
+// bundle or a registry without the endpoint.
+func refreshIncremental(ctx context.Context) ([]byte, time.Time, bool) {
+	state := readRefreshState()
+	if state.LastRefresh.IsZero() || time.Since(state.LastRefresh) > maxIncrementalAge || os.Getenv("VIRA_INDEX_KEY") != "" || localRegistry != "" {
+		return nil, time.Time{}, false
+	}
+	cached, err := os.ReadFile(indexPath())
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	var index Index
+	if err := json.Unmarshal(cached, &index); err != nil || index.Packages == nil {
+		return nil, time.Time{}, false
+	}
+	started := time.Now()
+	data, _, err := fetchURL(ctx, registryURL()+"index/changes?since="+url.QueryEscape(state.LastRefresh.Format(time.RFC3339)))
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	var changes IndexChanges
+	if err := json.Unmarshal(data, &changes); err != nil {
+		warn(codeIndexChanges, "", "malformed index changes, fetching the full index: %v", err)
+		return nil, time.Time{}, false
+	}
+	mergeIndexChanges(&index, &changes)
+	merged, err := json.Marshal(index)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	if err := validateIndex(merged); err != nil {
+		warn(codeIndexChanges, "", "index changes do not apply, fetching the full index: %v", err)
+		return nil, time.Time{}, false
+	}
+	until := changes.Until
+	if until.IsZero() {
+		until = started
+	}
+	fmt.Printf("Applied %d changed and %d removed packages\n", len(changes.Packages), len(changes.Removed))
+	return merged, until, true
+}
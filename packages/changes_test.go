@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMergeIndexChanges(t *testing.T) {
+	index := &Index{Packages: map[string]IndexPackage{
+		"math": {Latest: "1.0.0"},
+		"io":   {Latest: "1.0.0"},
+		"old":  {Latest: "0.1.0"},
+	}}
+	mergeIndexChanges(index, &IndexChanges{
+		Packages: map[string]IndexPackage{"math": {Latest: "1.1.0"}, "json": {Latest: "0.4.0"}},
+		Removed:  []string{"old", "never-there"},
+	})
+	if names := slices.Sorted(maps.Keys(index.Packages)); !slices.Equal(names, []string{"io", "json", "math"}) {
+		t.Errorf("merged packages %v, want io, json and math", names)
+	}
+	if got := index.Packages["math"].Latest; got != "1.1.0" {
+		t.Errorf("math latest %s after the merge, want 1.1.0", got)
+	}
+	if got := index.Packages["io"].Latest; got != "1.0.0" {
+		t.Errorf("unchanged io latest %s, want 1.0.0", got)
+	}
+}
+
+func TestRefreshMergesChanges(t *testing.T) {
+	version := func(v string) IndexPackage {
+		return IndexPackage{Latest: v, Versions: map[string]IndexVersion{v: {}}}
+	}
+	until := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	changes, _ := json.Marshal(IndexChanges{
+		Until:    until,
+		Packages: map[string]IndexPackage{"math": version("1.1.0"), "json": version("0.4.0")},
+		Removed:  []string{"old"},
+	})
+	full, _ := json.Marshal(Index{Packages: map[string]IndexPackage{"math": version("2.0.0")}})
+	tests := []struct {
+		name        string
+		lastRefresh time.Duration // ago; 0 records none
+		endpoint    bool
+		want        []string
+		wantLatest  string
+		wantChanges bool
+	}{
+		{"changes merged", time.Hour, true, []string{"io", "json", "math"}, "1.1.0", true},
+		{"registry without changes", time.Hour, false, []string{"math"}, "2.0.0", true},
+		{"cache too old", 30 * 24 * time.Hour, true, []string{"math"}, "2.0.0", false},
+		{"never refreshed", 0, true, []string{"math"}, "2.0.0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := testHome(t)
+			writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+				"math": version("1.0.0"), "io": version("1.0.0"), "old": version("0.1.0"),
+			}})
+			if tt.lastRefresh != 0 {
+				if err := writeRefreshState(time.Now().Add(-tt.lastRefresh)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			files := map[string][]byte{"index.json": full}
+			if tt.endpoint {
+				files["index/changes"] = changes
+			}
+			reg := newTestRegistry(t, files)
+			started := time.Now()
+			if _, err := captureStdout(t, func() error { return refresh(t.Context(), false, false) }); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(indexPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var index Index
+			if err := json.Unmarshal(data, &index); err != nil {
+				t.Fatal(err)
+			}
+			if names := slices.Sorted(maps.Keys(index.Packages)); !slices.Equal(names, tt.want) {
+				t.Errorf("cached packages %v, want %v", names, tt.want)
+			}
+			if got := index.Packages["math"].Latest; got != tt.wantLatest {
+				t.Errorf("math latest %s, want %s", got, tt.wantLatest)
+			}
+			if asked := reg.count("index/changes") > 0; asked != tt.wantChanges {
+				t.Errorf("asked for changes: %v, want %v", asked, tt.wantChanges)
+			}
+			incremental := tt.endpoint && tt.wantChanges
+			if fetched := reg.count("index.json") > 0; fetched == incremental {
+				t.Errorf("fetched the full index: %v, want %v", fetched, !incremental)
+			}
+			state := readRefreshState()
+			if incremental && !state.LastRefresh.Equal(until) {
+				t.Errorf("recorded refresh %v, want the server's %v", state.LastRefresh, until)
+			}
+			if !incremental && state.LastRefresh.Before(started.Add(-time.Second)) {
+				t.Errorf("recorded refresh %v, want now", state.LastRefresh)
+			}
+		})
+	}
+}
+
+func TestWarnStaleIndex(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		name   string
+		age    time.Duration // of the recorded refresh
+		mtime  time.Duration // of the index file, when nothing is recorded
+		config string
+		want   []string
+	}{
+		{"fresh", time.Hour, 0, "", nil},
+		{"older than the default TTL", 30 * day, 0, "", []string{"the cached index is 30 days old, run refresh", "a newer version of math than the cached index knows may exist"}},
+		{"older than a configured TTL", 2 * day, 0, "index-ttl: 24h\n", []string{"the cached index is 2 days old, run refresh", "a newer version of math than the cached index knows may exist"}},
+		{"TTL turned off", 30 * day, 0, "index-ttl: 0\n", nil},
+		{"refreshed in the future", -time.Hour, 0, "", []string{"the cached index was refreshed in the future, check the system clock and run refresh"}},
+		{"old file without a recorded refresh", 0, 10 * day, "", []string{"the cached index is 10 days old, run refresh", "a newer version of math than the cached index knows may exist"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := testHome(t)
+			quietWarnings(t)
+			writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{}})
+			os.WriteFile(configPath(), []byte(tt.config), 0644)
+			if tt.age != 0 {
+				if err := writeRefreshState(time.Now().Add(-tt.age)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.mtime != 0 {
+				old := time.Now().Add(-tt.mtime)
+				os.Chtimes(indexPath(), old, old)
+			}
+			warnStaleIndex("math")
+			var got []string
+			for _, w := range collectedWarnings() {
+				got = append(got, w.Message)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("warnings %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("bundle", func(t *testing.T) {
+		home := testHome(t)
+		quietWarnings(t)
+		writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{}})
+		writeRefreshState(time.Now().Add(-30 * day))
+		localRegistry = t.TempDir()
+		defer func() { localRegistry = "" }()
+		warnStaleIndex("math")
+		if w := collectedWarnings(); len(w) != 0 {
+			t.Errorf("a --from-dir install warned %v", w)
+		}
+	})
+}
+
+func TestIndexAge(t *testing.T) {
+	home := testHome(t)
+	if _, err := indexAge(); err == nil {
+		t.Error("indexAge without a cached index gave no error")
+	}
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{}})
+	writeRefreshState(time.Now().Add(-3 * time.Hour))
+	if age, err := indexAge(); err != nil || age < 3*time.Hour || age > 3*time.Hour+time.Minute {
+		t.Errorf("indexAge = %v, %v, want 3h", age, err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CleanOptions are the flags accepted by clean.
+type CleanOptions struct {
+	InProject     bool
+	KeepInstalled bool
+}
+
+// clean removes the downloaded archives kept next to installed packages.
+// Archives the project's lockfile references are always kept, so a later
+// install of the locked set finds them; with KeepInstalled so are those of
+// every package that is still installed.
+func clean(opts CleanOptions) error {
+	dir := os.Getenv("HOME") + "/.vira/libs"
+	keep := map[string]bool{}
+	if opts.InProject {
+		dir = filepath.Join("build", "dependencies")
+		lock, err := readLock(lockFile)
+		if err != nil {
+			return err
+		}
+		for name := range lock.Packages {
+			keep[name] = true
+		}
+	}
+	if opts.KeepInstalled {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, e := range entries {
+			if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				keep[e.Name()] = true
+			}
+		}
+	}
+	freed, err := pruneCacheKeeping(dir, keep)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Freed %s\n", formatBytes(freed))
+	return nil
+}
+
+// pruneCacheKeeping deletes the package archives in dir except those of
+// the packages in keep, and returns the number of bytes reclaimed. Names
+// are compared without their version, so a lock entry or install of
+// math keeps math@1.2.0.tar.gz as well as math.tar.gz.
+func pruneCacheKeeping(dir string, keep map[string]bool) (freed int64, err error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	kept := map[string]bool{}
+	for full := range keep {
+		name, _ := splitSpec(full)
+		kept[name] = true
+	}
+	for _, e := range entries {
+		full, _, ok := strings.Cut(e.Name(), ".tar.")
+		name, _ := splitSpec(full)
+		if !ok || e.IsDir() || strings.HasSuffix(e.Name(), ".part") || kept[name] {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return freed, err
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			return freed, err
+		}
+		fmt.Println("Removed", e.Name())
+		freed += info.Size()
+	}
+	return freed, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPruneCacheKeeping(t *testing.T) {
+	files := []string{
+		"math@1.2.0.tar.gz",
+		"math.tar.zst",
+		"json@0.4.0.tar.gz",
+		"io.tar.gz",
+		"http.tar.gz.part",
+		"notes.txt",
+	}
+	tests := []struct {
+		name    string
+		keep    map[string]bool
+		removed int
+		want    []string
+	}{
+		{"keep nothing", nil, 4, []string{"http.tar.gz.part", "math", "notes.txt"}},
+		{"by name", map[string]bool{"math": true}, 2, []string{"http.tar.gz.part", "math", "math.tar.zst", "math@1.2.0.tar.gz", "notes.txt"}},
+		{"by locked version", map[string]bool{"json@0.4.0": true, "io": true}, 2, []string{"http.tar.gz.part", "io.tar.gz", "json@0.4.0.tar.gz", "math", "notes.txt"}},
+		{"another version of a kept package", map[string]bool{"json@0.5.0": true}, 3, []string{"http.tar.gz.part", "json@0.4.0.tar.gz", "math", "notes.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range files {
+				os.WriteFile(filepath.Join(dir, f), []byte("12345"), 0644)
+			}
+			// Extracted packages are never pruned.
+			os.Mkdir(filepath.Join(dir, "math"), 0755)
+			var freed int64
+			if _, err := captureStdout(t, func() error {
+				var err error
+				freed, err = pruneCacheKeeping(dir, tt.keep)
+				return err
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if want := int64(5 * tt.removed); freed != want {
+				t.Errorf("freed %d bytes, want %d", freed, want)
+			}
+			entries, _ := os.ReadDir(dir)
+			var left []string
+			for _, e := range entries {
+				left = append(left, e.Name())
+			}
+			if !slices.Equal(left, tt.want) {
+				t.Errorf("left %v, want %v", left, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanKeepsLockedArchives(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CleanOptions
+		want []string
+	}{
+		{"project", CleanOptions{InProject: true}, []string{"app", "io.tar.gz", "math@1.2.0.tar.gz"}},
+		{"project keeping installed", CleanOptions{InProject: true, KeepInstalled: true}, []string{"app", "app.tar.gz", "io.tar.gz", "math@1.2.0.tar.gz"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testHome(t)
+			wd, _ := os.Getwd()
+			if err := os.Chdir(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chdir(wd)
+			// Lock keys and archive names need not carry the same version.
+			lock := &Lock{Packages: map[string]*LockEntry{
+				"math":     {Version: "1.2.0"},
+				"io@1.0.0": {Version: "1.0.0"},
+			}}
+			if err := writeLock(lockFile, lock); err != nil {
+				t.Fatal(err)
+			}
+			destDir := filepath.Join("build", "dependencies")
+			os.MkdirAll(filepath.Join(destDir, "app"), 0755)
+			for _, f := range []string{"math@1.2.0.tar.gz", "io.tar.gz", "app.tar.gz", "stale.tar.gz"} {
+				os.WriteFile(filepath.Join(destDir, f), []byte("x"), 0644)
+			}
+			if _, err := captureStdout(t, func() error { return clean(tt.opts) }); err != nil {
+				t.Fatal(err)
+			}
+			entries, _ := os.ReadDir(destDir)
+			var left []string
+			for _, e := range entries {
+				left = append(left, e.Name())
+			}
+			if !slices.Equal(left, tt.want) {
+				t.Errorf("left %v, want %v", left, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// defaultMaxConns is the connection limit per registry host unless the
+// max-conns config setting says otherwise.
+const defaultMaxConns = 8
+
+var (
+	clientOnce sync.Once
+	client     *http.Client
+	clientErr  error
+)
+
+// offline fails every registry request, for commands that promise not to
+// touch the network.
+var offline bool
+
+var errOffline = fmt.Errorf("network access is disabled for this command")
+
+// httpClient returns the client shared by every registry request, set up
+// from the ca-file and pinned-key config settings. Configuration errors
+// surface on the first request.
+func httpClient() *http.Client {
+	if offline {
+		return &http.Client{Transport: errorTransport{errOffline}}
+	}
+	clientOnce.Do(func() {
+		client, clientErr = newHTTPClient(loadConfig())
+	})
+	if clientErr != nil {
+		return &http.Client{Transport: errorTransport{clientErr}}
+	}
+	return client
+}
+
+type errorTransport struct{ err error }
+
+func (t errorTransport) RoundTrip(*http.Request) (*http.Response, error) { return nil, t.err }
+
+func newHTTPClient(cfg Config) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// file:// registries serve offline bundles straight from disk.
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	// One invocation fetches many archives or index shards from the same
+	// host, so keep connections open and multiplex them over HTTP/2.
+	maxConns := cfg.MaxConns
+	if maxConns <= 0 {
+		maxConns = defaultMaxConns
+	}
+	transport.MaxIdleConnsPerHost = maxConns
+	transport.MaxConnsPerHost = maxConns
+	transport.ForceAttemptHTTP2 = true
+	if cfg.CAFile == "" && cfg.PinnedKey == "" {
+		return &http.Client{Transport: transport}, nil
+	}
+	tlsConfig := &tls.Config{}
+	if cfg.CAFile != "" {
+		// Keep the system roots and trust the extra CA on top of them.
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read ca-file: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca-file %s contains no certificates", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.PinnedKey != "" {
+		host := ""
+		if u, err := url.Parse(registryURL()); err == nil {
+			host = u.Hostname()
+		}
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return nil
+			}
+			// No SNI is sent for an IP address, so ServerName is empty;
+			// a certificate for the registry's address is then what marks
+			// the registry connection.
+			if cs.ServerName != host && (cs.ServerName != "" || cs.PeerCertificates[0].VerifyHostname(host) != nil) {
+				return nil
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+			if got := "sha256/" + base64.StdEncoding.EncodeToString(sum[:]); got != cfg.PinnedKey {
+				return fmt.Errorf("security error: certificate for %s does not match pinned key (got %s), refusing to connect", host, got)
+			}
+			return nil
+		}
+	}
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// newRequest builds a request, authenticated when a token is configured
+// and it goes to the registry. Release checks, override URLs and other
+// hosts never see the token.
+func newRequest(ctx context.Context, method string, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := loadConfig().Token; token != "" && isRegistryHost(req.URL) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// isRegistryHost reports whether u is served by the configured registry.
+func isRegistryHost(u *url.URL) bool {
+	registry, err := url.Parse(registryURL())
+	return err == nil && registry.Host != "" && strings.EqualFold(u.Host, registry.Host)
+}
+
+// drainBody reads what is left of a response body before it is closed, so
+// the connection can be reused for the next request.
+func drainBody(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// useClient makes registry requests go through c until the test ends.
+func useClient(t testing.TB, c *http.Client) {
+	clientOnce.Do(func() {})
+	client, clientErr = c, nil
+	t.Cleanup(func() {
+		clientOnce, client, clientErr = sync.Once{}, nil, nil
+	})
+}
+
+func TestTokenOnlyForRegistry(t *testing.T) {
+	home := testHome(t)
+	os.MkdirAll(filepath.Join(home, ".vira"), 0755)
+	os.WriteFile(filepath.Join(home, ".vira", "config.yml"), []byte("token: secret\n"), 0600)
+	var mu sync.Mutex
+	seen := map[string]string{}
+	stub := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			seen[name] = r.Header.Get("Authorization")
+			mu.Unlock()
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	registry, other := stub("registry"), stub("other")
+	registryOverride = registry.URL + "/"
+	defer func() { registryOverride = "" }()
+
+	for _, base := range []string{registry.URL, other.URL} {
+		req, err := newRequest(t.Context(), "GET", base+"/math.tar.gz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if got := seen["registry"]; got != "Bearer secret" {
+		t.Errorf("registry got Authorization %q, want the token", got)
+	}
+	if got, ok := seen["other"]; !ok || got != "" {
+		t.Errorf("other host got Authorization %q (requested %v), want none", got, ok)
+	}
+}
+
+func TestTLSTrustAndPinning(t *testing.T) {
+	testHome(t)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("index"))
+	}))
+	defer server.Close()
+	registryOverride = server.URL + "/"
+	defer func() { registryOverride = "" }()
+	cert := server.Certificate()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644)
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	pin := "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+	otherPin := "sha256/" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"self-signed without ca-file", Config{}, "certificate"},
+		{"ca-file", Config{CAFile: caFile}, ""},
+		{"ca-file and matching pin", Config{CAFile: caFile, PinnedKey: pin}, ""},
+		{"pin mismatch", Config{CAFile: caFile, PinnedKey: otherPin}, "security error: certificate for 127.0.0.1 does not match pinned key (got " + pin + ")"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newHTTPClient(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			useClient(t, c)
+			data, _, err := fetchURL(t.Context(), server.URL+"/index.json")
+			if tt.wantErr == "" {
+				if err != nil || string(data) != "index" {
+					t.Fatalf("fetch = %q, %v, want the index", data, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("fetch = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientBadCAFile(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.pem")
+	os.WriteFile(empty, []byte("not a certificate"), 0644)
+	tests := []struct {
+		caFile  string
+		wantErr string
+	}{
+		{filepath.Join(dir, "missing.pem"), "cannot read ca-file"},
+		{empty, "contains no certificates"},
+	}
+	for _, tt := range tests {
+		if _, err := newHTTPClient(Config{CAFile: tt.caFile}); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("newHTTPClient(ca-file %s) = %v, want an error containing %q", tt.caFile, err, tt.wantErr)
+		}
+	}
+}
+
+// BenchmarkDownload fetches a batch of archives from a TLS registry with
+// the shared client, which keeps connections open, and with keep-alives
+// disabled, which pays for a TCP and TLS handshake per archive.
+func BenchmarkDownload(b *testing.B) {
+	const batch = 16
+	archive := bytes.Repeat([]byte("vira"), 16<<10)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+	noProgress = true
+	defer func() { noProgress = false }()
+
+	for _, reuse := range []bool{true, false} {
+		name := "reused"
+		if !reuse {
+			name = "fresh"
+		}
+		b.Run(name, func(b *testing.B) {
+			testHome(b)
+			c, err := newHTTPClient(Config{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			transport := c.Transport.(*http.Transport)
+			transport.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+			transport.DisableKeepAlives = !reuse
+			useClient(b, c)
+			dir := b.TempDir()
+			b.SetBytes(int64(batch * len(archive)))
+			b.ResetTimer()
+			for range b.N {
+				for i := range batch {
+					path := filepath.Join(dir, fmt.Sprintf("pkg%d.tar.gz", i))
+					if _, err := downloadFile(b.Context(), fmt.Sprintf("%s/pkg%d.tar.gz", server.URL, i), path, false); err != nil {
+						b.Fatal(err)
+					}
+					os.Remove(path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings from ~/.vira/config.yml that the package
+// manager reads. The file is shared with the vira CLI.
+type Config struct {
+	Registry      string
+	Token         string
+	IgnoreScripts bool
+	// CAFile adds a trusted CA for the registry; PinnedKey pins the
+	// registry certificate's public key ("sha256/<base64>").
+	CAFile    string
+	PinnedKey string
+	// MaxConns limits concurrent connections per registry host.
+	MaxConns int
+	// MaxDepth bounds dependency chains when --max-depth is not given.
+	MaxDepth int
+}
+
+// configKey describes a known config setting.
+type configKey struct {
+	kind   string // "string", "bool", "int", "octal", "duration", "choice" or "url"
+	secret bool
+	// choices are the accepted values of a "choice" setting.
+	choices []string
+}
+
+var configKeys = map[string]configKey{
+	"registry":       {kind: "url"},
+	"token":          {kind: "string", secret: true},
+	"ignore-scripts": {kind: "bool"},
+	"ca-file":        {kind: "string"},
+	"pinned-key":     {kind: "string"},
+	"max-conns":      {kind: "int"},
+	"max-depth":      {kind: "int"},
+	"file-mask":      {kind: "octal"},
+	"no-exec-data":   {kind: "bool"},
+	"index-ttl":      {kind: "duration"},
+	"script-sandbox": {kind: "bool"},
+	"script-env":     {kind: "string"},
+	"script-wrapper": {kind: "string"},
+	"default-scope":  {kind: "choice", choices: []string{"project", "global"}},
+	// Written by the vira CLI.
+	"version": {kind: "string"},
+	"verbose": {kind: "bool"},
+}
+
+func configPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".vira", "config.yml")
+}
+
+// loadConfig reads the user config. A missing or unreadable file gives the
+// defaults, so a broken config never blocks installs.
+func loadConfig() Config {
+	var cfg Config
+	values, err := readConfigValues()
+	if err != nil {
+		return cfg
+	}
+	cfg.Registry = values["registry"]
+	cfg.Token = values["token"]
+	cfg.IgnoreScripts = values["ignore-scripts"] == "true"
+	cfg.CAFile = values["ca-file"]
+	cfg.PinnedKey = values["pinned-key"]
+	cfg.MaxConns, _ = strconv.Atoi(values["max-conns"])
+	cfg.MaxDepth, _ = strconv.Atoi(values["max-depth"])
+	return cfg
+}
+
+// configuredMaxDepth is the dependency chain limit from max-depth in the
+// config, or defaultMaxDepth. It is the default of the --max-depth flags,
+// so the flag takes precedence.
+func configuredMaxDepth() int {
+	if n := loadConfig().MaxDepth; n > 0 {
+		return n
+	}
+	return defaultMaxDepth
+}
+
+// registryOverride replaces the configured registry for this run and
+// localRegistry is the bundle directory behind it, both set by --from-dir.
+var (
+	registryOverride string
+	localRegistry    string
+)
+
+// registryURL is the base URL packages and the index are fetched from.
+func registryURL() string {
+	if registryOverride != "" {
+		return registryOverride
+	}
+	if r := loadConfig().Registry; r != "" {
+		return strings.TrimSuffix(r, "/") + "/"
+	}
+	return repoURL
+}
+
+func readConfigValues() (map[string]string, error) {
+	data, err := os.ReadFile(configPath())
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseYAML(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return root.scalars(), nil
+}
+
+func validateConfigValue(key string, value string) error {
+	switch configKeys[key].kind {
+	case "bool":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s must be true or false", key)
+		}
+	case "int":
+		if n, err := strconv.Atoi(value); err != nil || n < 1 {
+			return fmt.Errorf("%s must be a positive number", key)
+		}
+	case "octal":
+		if n, err := strconv.ParseUint(value, 8, 32); err != nil || n > 0777 {
+			return fmt.Errorf("%s must be an octal mode such as 022", key)
+		}
+	case "duration":
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return fmt.Errorf("%s must be a duration such as 72h, or 0 to disable", key)
+		}
+	case "choice":
+		if choices := configKeys[key].choices; !slices.Contains(choices, value) {
+			return fmt.Errorf("%s must be one of %s", key, strings.Join(choices, ", "))
+		}
+	case "url":
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || (u.Host == "" && !(u.Scheme == "file" && u.Path != "")) {
+			return fmt.Errorf("%s must be an absolute URL", key)
+		}
+	}
+	return nil
+}
+
+// projectScope decides whether install and remove act on the project:
+// --in-project or --global when given, otherwise default-scope from the
+// config, otherwise globally.
+func projectScope(inProject bool, global bool) (bool, error) {
+	if inProject && global {
+		return false, fmt.Errorf("--in-project and --global cannot be combined")
+	}
+	if inProject || global {
+		return inProject, nil
+	}
+	values, err := readConfigValues()
+	if err != nil {
+		return false, nil
+	}
+	switch values["default-scope"] {
+	case "project":
+		fmt.Fprintln(os.Stderr, "Using the project (default-scope is project, pass --global to override)")
+		return true, nil
+	case "global":
+		fmt.Fprintln(os.Stderr, "Using the global libs (default-scope is global, pass --in-project to override)")
+	}
+	return false, nil
+}
+
+func displayConfigValue(key string, value string, showSecrets bool) string {
+	if configKeys[key].secret && !showSecrets && value != "" {
+		return "********"
+	}
+	return value
+}
+
+func configGet(key string, showSecrets bool) error {
+	values, err := readConfigValues()
+	if err != nil {
+		return err
+	}
+	value, ok := values[key]
+	if !ok {
+		return fmt.Errorf("%s is not set", key)
+	}
+	fmt.Println(displayConfigValue(key, value, showSecrets))
+	return nil
+}
+
+func configList(showSecrets bool) error {
+	values, err := readConfigValues()
+	if err != nil {
+		return err
+	}
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		fmt.Printf("%s: %s\n", key, displayConfigValue(key, values[key], showSecrets))
+	}
+	return nil
+}
+
+// configSet writes key in place, keeping the rest of the file (comments,
+// ordering, keys written by the CLI) untouched. Unknown keys are refused
+// unless force is set.
+func configSet(key string, value string, force bool) error {
+	if _, ok := configKeys[key]; !ok && !force {
+		return fmt.Errorf("unknown config key %s (use --force to set it anyway)", key)
+	}
+	if err := validateConfigValue(key, value); err != nil {
+		return err
+	}
+	quoted, err := quoteConfigValue(value)
+	if err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	return rewriteConfig(key, func(lines []string, i int) []string {
+		line := key + ": " + quoted
+		if i < 0 {
+			return append(lines, line)
+		}
+		lines[i] = line
+		return lines
+	})
+}
+
+// quoteConfigValue quotes value when it would not read back as the same
+// plain scalar, such as when it holds ':' or '#' or starts with a YAML
+// indicator. Single quotes are used when possible, since neither YAML
+// nor parseYAML unescapes inside them.
+func quoteConfigValue(value string) (string, error) {
+	plain := value != "" && value == strings.TrimSpace(value) &&
+		!strings.ContainsAny(value, ":#'\"") && !strings.ContainsRune("-?,[]{}&*!|>%@`", rune(value[0]))
+	if plain {
+		return value, nil
+	}
+	switch {
+	case !strings.Contains(value, "'"):
+		return "'" + value + "'", nil
+	case !strings.ContainsAny(value, `"\`):
+		return `"` + value + `"`, nil
+	}
+	return "", fmt.Errorf("values holding both ' and \" or \\ cannot be written")
+}
+
+func configUnset(key string) error {
+	return rewriteConfig(key, func(lines []string, i int) []string {
+		if i < 0 {
+			return lines
+		}
+		return append(lines[:i], lines[i+1:]...)
+	})
+}
+
+// rewriteConfig calls edit with the config lines and the index of the
+// top-level line for key (-1 if absent), then writes the result back.
+func rewriteConfig(key string, edit func(lines []string, i int) []string) error {
+	data, err := os.ReadFile(configPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	text := strings.TrimSuffix(string(data), "\n")
+	var lines []string
+	if text != "" {
+		lines = strings.Split(text, "\n")
+	}
+	found := -1
+	for i, line := range lines {
+		if k, _, ok := strings.Cut(line, ":"); ok && strings.TrimRight(k, " ") == key {
+			found = i
+			break
+		}
+	}
+	lines = edit(lines, found)
+	if err := os.MkdirAll(filepath.Dir(configPath()), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(configPath(), []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+// useLocalRegistry points this run at a directory holding index.json and
+// package tarballs, for offline installs.
+func useLocalRegistry(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(abs, "index.json")); err != nil {
+		return fmt.Errorf("%s is not a package bundle: %v", dir, err)
+	}
+	registryOverride = "file://" + filepath.ToSlash(abs) + "/"
+	localRegistry = abs
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigSetRoundTrips(t *testing.T) {
+	testHome(t)
+	if err := os.MkdirAll(filepath.Dir(configPath()), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath(), []byte("# written by vira\nversion: 1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key   string
+		value string
+	}{
+		{"registry", "https://registry.example.com:8443/"},
+		{"script-env", "PATH=/usr/bin # not a comment"},
+		{"script-wrapper", "  padded  "},
+		{"script-env", `say "hi"`},
+		{"token", "it's:secret"},
+		{"ca-file", "-ca.pem"},
+		{"ca-file", ""},
+		{"pinned-key", "sha256/abc="},
+	}
+	for _, tt := range tests {
+		if err := configSet(tt.key, tt.value, false); err != nil {
+			t.Errorf("configSet(%q, %q): %v", tt.key, tt.value, err)
+			continue
+		}
+		values, err := readConfigValues()
+		if err != nil {
+			t.Fatalf("after setting %s to %q: %v", tt.key, tt.value, err)
+		}
+		if values[tt.key] != tt.value {
+			t.Errorf("%s set to %q reads back as %q", tt.key, tt.value, values[tt.key])
+		}
+		if values["version"] != "1.0" {
+			t.Errorf("setting %s to %q changed version to %q", tt.key, tt.value, values["version"])
+		}
+	}
+	if err := configSet("script-env", `it's "both"`, false); err == nil {
+		t.Error("configSet accepted a value with both quote kinds")
+	}
+}
+
+func TestConfiguredMaxDepth(t *testing.T) {
+	testHome(t)
+	if got := configuredMaxDepth(); got != defaultMaxDepth {
+		t.Errorf("without config: %d, want %d", got, defaultMaxDepth)
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath()), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := configSet("max-depth", "3", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := configuredMaxDepth(); got != 3 {
+		t.Errorf("with max-depth: 3: %d, want 3", got)
+	}
+	if err := configSet("max-depth", "0", false); err == nil {
+		t.Error("configSet accepted max-depth 0")
+	}
+}
+
+func TestProjectScope(t *testing.T) {
+	tests := []struct {
+		config    string
+		inProject bool
+		global    bool
+		want      bool
+		wantNote  string
+		wantErr   bool
+	}{
+		{"", false, false, false, "", false},
+		{"", true, false, true, "", false},
+		{"", false, true, false, "", false},
+		{"project", false, false, true, "default-scope is project", false},
+		{"project", true, false, true, "", false},
+		{"project", false, true, false, "", false},
+		{"global", false, false, false, "default-scope is global", false},
+		{"global", true, false, true, "", false},
+		{"global", false, true, false, "", false},
+		{"", true, true, false, "", true},
+		{"project", true, true, false, "", true},
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("default-scope %q in-project %v global %v", tt.config, tt.inProject, tt.global)
+		t.Run(name, func(t *testing.T) {
+			testHome(t)
+			if tt.config != "" {
+				os.MkdirAll(filepath.Dir(configPath()), 0755)
+				os.WriteFile(configPath(), []byte("default-scope: "+tt.config+"\n"), 0644)
+			}
+			var got bool
+			note, err := captureStderr(t, func() error {
+				var err error
+				got, err = projectScope(tt.inProject, tt.global)
+				return err
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("projectScope = %v, %v, want %v", got, err, tt.want)
+			}
+			if tt.wantNote == "" && note != "" {
+				t.Errorf("printed %q though the scope did not come from the config", note)
+			} else if !strings.Contains(note, tt.wantNote) {
+				t.Errorf("printed %q, want %q", note, tt.wantNote)
+			}
+		})
+	}
+}
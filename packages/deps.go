@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// DependencyList is what one package version declares it depends on, by
+// kind. Source says where it was read from: "override", "index" or
+// "installed".
+type DependencyList struct {
+	Name     string            `json:"name"`
+	Version  string            `json:"version,omitempty"`
+	Source   string            `json:"source"`
+	Runtime  map[string]string `json:"dependencies"`
+	Dev      map[string]string `json:"devDependencies"`
+	Optional map[string]string `json:"optionalDependencies"`
+	Peer     map[string]string `json:"peerDependencies"`
+	Warnings []Warning         `json:"warnings"`
+}
+
+func newDependencyList(name string, version string, source string) *DependencyList {
+	return &DependencyList{
+		Name:     name,
+		Version:  version,
+		Source:   source,
+		Runtime:  map[string]string{},
+		Dev:      map[string]string{},
+		Optional: map[string]string{},
+		Peer:     map[string]string{},
+	}
+}
+
+// addManifest adds the dependencies a bytes.yml declares.
+func (l *DependencyList) addManifest(m *Manifest) {
+	maps.Copy(l.Runtime, m.Dependencies)
+	maps.Copy(l.Dev, m.DevDependencies)
+}
+
+// declaredDependencies looks up the direct dependencies of spec (name or
+// name@version) without installing it: from a local override, the cached
+// index or, for packages the index does not know, an installed copy in
+// dir. The index has no dev dependencies; they are added from an
+// installed copy of the same version when there is one.
+func declaredDependencies(spec string, dir string) (*DependencyList, error) {
+	name, version := splitSpec(spec)
+	if target, ok := overrideFor(name); ok && !isOverrideURL(target) {
+		m, err := loadManifest(filepath.Join(target, manifestFile))
+		if err != nil {
+			return nil, err
+		}
+		list := newDependencyList(name, m.Version, "override")
+		list.addManifest(m)
+		return list, nil
+	}
+
+	index, err := loadIndex()
+	if err == nil {
+		if pkg, ok := index.lookup(name); ok {
+			if _, exact := pkg.Versions[version]; version != "" && !exact {
+				if _, err := resolveChannel(pkg, version); err != nil {
+					return nil, fmt.Errorf("%s has no version %s", name, version)
+				}
+			}
+			v := pickVersion(pkg, version)
+			meta := pkg.Versions[v]
+			list := newDependencyList(name, v, "index")
+			maps.Copy(list.Runtime, meta.Dependencies)
+			maps.Copy(list.Optional, meta.OptionalDependencies)
+			maps.Copy(list.Peer, meta.PeerDependencies)
+			if local := installedManifest(dir, name, v); local != nil {
+				maps.Copy(list.Dev, local.DevDependencies)
+			}
+			return list, nil
+		}
+	}
+	if local := installedManifest(dir, name, version); local != nil {
+		list := newDependencyList(name, local.Version, "installed")
+		list.addManifest(local)
+		return list, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, notFoundError(name, index)
+}
+
+// installedManifest returns the bytes.yml of an installed copy of name in
+// dir, of the given version unless that is empty.
+func installedManifest(dir string, name string, version string) *Manifest {
+	installed, _ := listInstalled(dir)
+	for _, full := range installed {
+		p := readInstalled(dir, full)
+		if p.name != name || (version != "" && p.version != version) {
+			continue
+		}
+		if m, err := loadManifest(filepath.Join(dir, full, manifestFile)); err == nil {
+			if m.Version == "" {
+				m.Version = p.version
+			}
+			return m
+		}
+	}
+	return nil
+}
+
+// printDependencyList prints the dependencies grouped by kind, or as JSON.
+func printDependencyList(list *DependencyList, asJSON bool) error {
+	if asJSON {
+		list.Warnings = collectedWarnings()
+		return printJSON(list)
+	}
+	label := list.Name
+	if list.Version != "" {
+		label += "@" + list.Version
+	}
+	fmt.Printf("%s (from %s)\n", label, list.Source)
+	kinds := []struct {
+		title string
+		deps  map[string]string
+	}{
+		{"dependencies", list.Runtime},
+		{"devDependencies", list.Dev},
+		{"optionalDependencies", list.Optional},
+		{"peerDependencies", list.Peer},
+	}
+	for _, kind := range kinds {
+		if len(kind.deps) == 0 {
+			continue
+		}
+		fmt.Println(kind.title + ":")
+		for _, dep := range slices.Sorted(maps.Keys(kind.deps)) {
+			fmt.Printf("  %s %s\n", dep, kind.deps[dep])
+		}
+	}
+	return nil
+}
+
+// depsDir is where deps looks for installed copies.
+func depsDir(inProject bool) string {
+	if inProject {
+		return filepath.Join("build", "dependencies")
+	}
+	return os.Getenv("HOME") + "/.vira/libs"
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// depsFixture caches an index where http declares runtime, optional and
+// peer dependencies, installs http@2.0.0 with its dev dependencies, and
+// installs local, which the index does not know. It returns the libs
+// directory.
+func depsFixture(t *testing.T) string {
+	t.Helper()
+	home := testHome(t)
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"http": {Latest: "2.0.0", Versions: map[string]IndexVersion{
+			"1.0.0": {Dependencies: map[string]string{"io": "^1.0"}},
+			"2.0.0": {
+				Dependencies:         map[string]string{"io": "^2.0", "math": "~1.1"},
+				OptionalDependencies: map[string]string{"zlib": "^1.0"},
+				PeerDependencies:     map[string]string{"tls": ">=1.0"},
+			},
+		}},
+	}})
+	libs := filepath.Join(home, ".vira", "libs")
+	for dir, manifest := range map[string]string{
+		"http@2.0.0": "name: http\nversion: 2.0.0\ndependencies:\n  io: ^2.0\ndev-dependencies:\n  testkit: ^0.3\n",
+		"local":      "name: local\nversion: 0.2.0\ndependencies:\n  math: ^1.0\ndev-dependencies:\n  testkit: ^0.3\n",
+	} {
+		os.MkdirAll(filepath.Join(libs, dir), 0755)
+		os.WriteFile(filepath.Join(libs, dir, manifestFile), []byte(manifest), 0644)
+	}
+	return libs
+}
+
+func TestDeclaredDependencies(t *testing.T) {
+	tests := []struct {
+		spec     string
+		want     DependencyList
+		wantErr  string
+		override bool
+	}{
+		{spec: "http", want: DependencyList{
+			Name: "http", Version: "2.0.0", Source: "index",
+			Runtime:  map[string]string{"io": "^2.0", "math": "~1.1"},
+			Dev:      map[string]string{"testkit": "^0.3"},
+			Optional: map[string]string{"zlib": "^1.0"},
+			Peer:     map[string]string{"tls": ">=1.0"},
+		}},
+		// No installed copy of 1.0.0, so nothing says what its dev
+		// dependencies are.
+		{spec: "http@1.0.0", want: DependencyList{
+			Name: "http", Version: "1.0.0", Source: "index",
+			Runtime: map[string]string{"io": "^1.0"},
+			Dev:     map[string]string{}, Optional: map[string]string{}, Peer: map[string]string{},
+		}},
+		{spec: "http@latest", want: DependencyList{
+			Name: "http", Version: "2.0.0", Source: "index",
+			Runtime:  map[string]string{"io": "^2.0", "math": "~1.1"},
+			Dev:      map[string]string{"testkit": "^0.3"},
+			Optional: map[string]string{"zlib": "^1.0"},
+			Peer:     map[string]string{"tls": ">=1.0"},
+		}},
+		{spec: "local", want: DependencyList{
+			Name: "local", Version: "0.2.0", Source: "installed",
+			Runtime:  map[string]string{"math": "^1.0"},
+			Dev:      map[string]string{"testkit": "^0.3"},
+			Optional: map[string]string{}, Peer: map[string]string{},
+		}},
+		{spec: "http", override: true, want: DependencyList{
+			Name: "http", Version: "3.0.0-dev", Source: "override",
+			Runtime:  map[string]string{"io": "^3.0"},
+			Dev:      map[string]string{"bench": "*"},
+			Optional: map[string]string{}, Peer: map[string]string{},
+		}},
+		{spec: "http@9.9.9", wantErr: "http has no version 9.9.9"},
+		{spec: "missing", wantErr: "missing"},
+	}
+	for _, tt := range tests {
+		name := tt.spec
+		if tt.override {
+			name += " overridden"
+		}
+		t.Run(name, func(t *testing.T) {
+			libs := depsFixture(t)
+			if tt.override {
+				checkout := t.TempDir()
+				os.WriteFile(filepath.Join(checkout, manifestFile), []byte("name: http\nversion: 3.0.0-dev\ndependencies:\n  io: ^3.0\ndev-dependencies:\n  bench: \"*\"\n"), 0644)
+				os.WriteFile(configPath(), []byte("overrides:\n  http: "+checkout+"\n"), 0644)
+			}
+			got, err := declaredDependencies(tt.spec, libs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("declaredDependencies(%q) = %v, want an error containing %q", tt.spec, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != tt.want.Name || got.Version != tt.want.Version || got.Source != tt.want.Source {
+				t.Errorf("got %s@%s from %s, want %s@%s from %s", got.Name, got.Version, got.Source, tt.want.Name, tt.want.Version, tt.want.Source)
+			}
+			for _, kind := range []struct {
+				name      string
+				got, want map[string]string
+			}{
+				{"runtime", got.Runtime, tt.want.Runtime},
+				{"dev", got.Dev, tt.want.Dev},
+				{"optional", got.Optional, tt.want.Optional},
+				{"peer", got.Peer, tt.want.Peer},
+			} {
+				if !maps.Equal(kind.got, kind.want) {
+					t.Errorf("%s dependencies %v, want %v", kind.name, kind.got, kind.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintDependencyList(t *testing.T) {
+	libs := depsFixture(t)
+	quietWarnings(t)
+	list, err := declaredDependencies("http", libs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := captureStdout(t, func() error { return printDependencyList(list, false) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `http@2.0.0 (from index)
+dependencies:
+  io ^2.0
+  math ~1.1
+devDependencies:
+  testkit ^0.3
+optionalDependencies:
+  zlib ^1.0
+peerDependencies:
+  tls >=1.0
+`
+	if out != want {
+		t.Errorf("text output:\n%s\nwant:\n%s", out, want)
+	}
+
+	out, err = captureStdout(t, func() error { return printDependencyList(list, true) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	for _, key := range []string{"name", "version", "source", "dependencies", "devDependencies", "optionalDependencies", "peerDependencies", "warnings"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("JSON output has no %q: %s", key, out)
+		}
+	}
+	if peers, _ := got["peerDependencies"].(map[string]any); peers["tls"] != ">=1.0" {
+		t.Errorf("peerDependencies = %v, want tls >=1.0", got["peerDependencies"])
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// toolchainVersion is the Vira version packages are checked against:
+// VIRA_RUNTIME_VERSION, else the version the vira CLI records in
+// ~/.vira/config.yml. It is "" when unknown.
+func toolchainVersion() string {
+	if v := os.Getenv("VIRA_RUNTIME_VERSION"); v != "" {
+		return v
+	}
+	values, err := readConfigValues()
+	if err != nil {
+		return ""
+	}
+	return values["version"]
+}
+
+// checkEngines reports an error when meta requires a Vira version, in
+// engines.vira, that runtimeVersion does not satisfy. An unknown runtime
+// version or a package without the constraint always passes.
+func checkEngines(meta *IndexVersion, runtimeVersion string) error {
+	constraint := meta.Engines["vira"]
+	if constraint == "" || runtimeVersion == "" {
+		return nil
+	}
+	ok, err := satisfies(runtimeVersion, constraint)
+	if err != nil {
+		return fmt.Errorf("invalid engines.vira constraint %q: %v", constraint, err)
+	}
+	if !ok {
+		return fmt.Errorf("requires vira %s, but the toolchain is %s", constraint, runtimeVersion)
+	}
+	return nil
+}
+
+// parseVersion reads up to three numeric components of a version such as
+// "v1.2.3-beta", returning how many were given. "x" and "*" end the
+// version early, as in "1.x".
+func parseVersion(s string) ([3]int, int, error) {
+	var v [3]int
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	if s == "" || s == "*" || s == "x" {
+		return v, 0, nil
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, 0, fmt.Errorf("bad version %q", s)
+	}
+	for i, p := range parts {
+		if p == "x" || p == "*" {
+			return v, i, nil
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, 0, fmt.Errorf("bad version %q", s)
+		}
+		v[i] = n
+	}
+	return v, len(parts), nil
+}
+
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// satisfies reports whether version matches constraint: comparators such
+// as ">=1.2", "<2", "^1.2.0", "~1.2", "1.2.x" or "*", combined with spaces
+// (all must match) and "||" (any group may match).
+func satisfies(version string, constraint string) (bool, error) {
+	v, _, err := parseVersion(version)
+	if err != nil {
+		return false, err
+	}
+	for _, group := range strings.Split(constraint, "||") {
+		ok := true
+		for _, c := range strings.Fields(group) {
+			match, err := matchComparator(v, c)
+			if err != nil {
+				return false, err
+			}
+			ok = ok && match
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchComparator(v [3]int, c string) (bool, error) {
+	op := strings.TrimRight(c[:min(len(c), 2)], "0123456789vx*.")
+	want, n, err := parseVersion(c[len(op):])
+	if err != nil {
+		return false, err
+	}
+	cmp := compareVersions(v, want)
+	switch op {
+	case ">=":
+		return cmp >= 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "^":
+		upper := [3]int{want[0] + 1}
+		if want[0] == 0 && n > 1 {
+			upper = [3]int{0, want[1] + 1}
+		}
+		return cmp >= 0 && compareVersions(v, upper) < 0, nil
+	case "~":
+		if n < 2 {
+			return cmp >= 0 && compareVersions(v, [3]int{want[0] + 1}) < 0, nil
+		}
+		return cmp >= 0 && compareVersions(v, [3]int{want[0], want[1] + 1}) < 0, nil
+	case "", "=":
+		// Components left out match anything: "1.2" is any 1.2.z.
+		for i := 0; i < n; i++ {
+			if v[i] != want[i] {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown operator %q", op)
+}
@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestSatisfies(t *testing.T) {
+	tests := []struct {
+		version    string
+		constraint string
+		want       bool
+	}{
+		{"1.2.3", "*", true},
+		{"1.2.3", "1.2.3", true},
+		{"1.2.3", "=1.2.3", true},
+		{"1.2.4", "1.2.3", false},
+		{"1.2.9", "1.2", true},
+		{"1.3.0", "1.2.x", false},
+		{"1.2.3", ">=1.2", true},
+		{"1.1.9", ">=1.2", false},
+		{"1.9.9", "<2", true},
+		{"2.0.0", "<2", false},
+		{"2.0.0", "<=2.0.0", true},
+		{"2.0.1", ">2", true},
+		{"1.9.0", "^1.2.0", true},
+		{"2.0.0", "^1.2.0", false},
+		{"1.1.0", "^1.2.0", false},
+		{"0.2.5", "^0.2.1", true},
+		{"0.3.0", "^0.2.1", false},
+		{"1.2.9", "~1.2", true},
+		{"1.3.0", "~1.2", false},
+		{"1.9.0", "~1", true},
+		{"v1.2.3-beta", "^1.2", true},
+		{"1.5.0", ">=1.2 <1.4", false},
+		{"1.3.0", ">=1.2 <1.4", true},
+		{"3.1.0", "^1 || ^3", true},
+		{"2.1.0", "^1 || ^3", false},
+	}
+	for _, tt := range tests {
+		got, err := satisfies(tt.version, tt.constraint)
+		if err != nil {
+			t.Errorf("satisfies(%q, %q): %v", tt.version, tt.constraint, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("satisfies(%q, %q) = %v, want %v", tt.version, tt.constraint, got, tt.want)
+		}
+	}
+}
+
+func TestSatisfiesInvalid(t *testing.T) {
+	for _, tt := range []struct{ version, constraint string }{
+		{"1.2.3.4", "*"},
+		{"one", "*"},
+		{"1.2.3", ">=1.a"},
+		{"1.2.3", "!1.2"},
+	} {
+		if _, err := satisfies(tt.version, tt.constraint); err == nil {
+			t.Errorf("satisfies(%q, %q) succeeded, want an error", tt.version, tt.constraint)
+		}
+	}
+}
+
+func TestCheckEngines(t *testing.T) {
+	tests := []struct {
+		engines map[string]string
+		runtime string
+		wantErr bool
+	}{
+		{nil, "1.0.0", false},
+		{map[string]string{"vira": "^1"}, "", false},
+		{map[string]string{"vira": "^1"}, "1.4.0", false},
+		{map[string]string{"vira": "^1"}, "2.0.0", true},
+		{map[string]string{"vira": "%1"}, "1.0.0", true},
+	}
+	for _, tt := range tests {
+		err := checkEngines(&IndexVersion{Engines: tt.engines}, tt.runtime)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkEngines(%v, %q) = %v, want error %v", tt.engines, tt.runtime, err, tt.wantErr)
+		}
+	}
+}
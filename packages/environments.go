@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// parseEnvironments collects environment overlays, written either as
+// [environments.<name>.dependencies] sections or nested under an
+// environments: mapping.
+func parseEnvironments(root *yamlNode) map[string]map[string]string {
+	envs := map[string]map[string]string{}
+	for _, env := range root.get("environments").keysOrNil() {
+		envs[env] = root.get("environments").get(env).get("dependencies").constraints()
+	}
+	for _, key := range root.Keys {
+		rest, ok := strings.CutPrefix(key, "environments.")
+		if !ok {
+			continue
+		}
+		if env, ok := strings.CutSuffix(rest, ".dependencies"); ok && env != "" {
+			if envs[env] == nil {
+				envs[env] = map[string]string{}
+			}
+			maps.Copy(envs[env], root.get(key).constraints())
+		}
+	}
+	return envs
+}
+
+func (n *yamlNode) keysOrNil() []string {
+	if n == nil {
+		return nil
+	}
+	return n.Keys
+}
+
+// environmentDependencies merges the base dependencies of m with the
+// overlay of env, whose entries add packages or replace their constraints.
+// An empty env is the base set.
+func environmentDependencies(m *Manifest, env string) (map[string]string, error) {
+	deps := map[string]string{}
+	maps.Copy(deps, m.Dependencies)
+	if env == "" {
+		return deps, nil
+	}
+	overlay, ok := m.Environments[env]
+	if !ok {
+		if len(m.Environments) == 0 {
+			return nil, fmt.Errorf("unknown environment %s, %s defines none", env, manifestFile)
+		}
+		return nil, fmt.Errorf("unknown environment %s, %s defines: %s", env, manifestFile, strings.Join(slices.Sorted(maps.Keys(m.Environments)), ", "))
+	}
+	maps.Copy(deps, overlay)
+	return deps, nil
+}
+
+// dependencySpec turns a manifest dependency into an install spec. Exact
+// versions and channels are kept, ranges pick the newest published
+// version satisfying them and "" or "*" installs the latest. A version
+// that is the latest installs by bare name, as transitive dependencies do.
+func dependencySpec(index *Index, name string, constraint string) string {
+	if constraint == "" || constraint == "*" {
+		return name
+	}
+	if index == nil {
+		return name + "@" + constraint
+	}
+	pkg, ok := index.lookup(name)
+	if !ok {
+		return name + "@" + constraint
+	}
+	if constraint == pkg.Latest {
+		return name
+	}
+	if _, ok := pkg.Versions[constraint]; ok {
+		return name + "@" + constraint
+	}
+	if _, ok := pkg.Channels[constraint]; ok || constraint == "latest" {
+		return name + "@" + constraint
+	}
+	best, ok := newestSatisfying(pkg, constraint)
+	if !ok {
+		return name + "@" + constraint
+	}
+	if best == pkg.Latest {
+		return name
+	}
+	return name + "@" + best
+}
+
+// installEnvironment installs the project's dependencies for env into the
+// project and records env as the environment bytes.lock was resolved for.
+func installEnvironment(ctx context.Context, env string, opts InstallOptions) error {
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	deps, err := environmentDependencies(m, env)
+	if err != nil {
+		return err
+	}
+	lock, err := readLock(lockFile)
+	if err != nil {
+		return err
+	}
+	if lock.Environment != env && len(lock.Packages) > 0 && !opts.DryRun {
+		warn(codeLockEnvironment, "", "%s was resolved for environment %s, now resolving for %s", lockFile, envName(lock.Environment), envName(env))
+	}
+	index, _ := loadIndex()
+	for _, name := range slices.Sorted(maps.Keys(deps)) {
+		spec := dependencySpec(index, name, deps[name])
+		if err := install(ctx, spec, opts); err != nil {
+			return fmt.Errorf("%s: %w", spec, err)
+		}
+		if !opts.Events && !opts.DryRun && !opts.LockfileOnly {
+			fmt.Println("Installed", spec)
+		}
+	}
+	if opts.DryRun {
+		return nil
+	}
+	if lock, err = readLock(lockFile); err != nil {
+		return err
+	}
+	lock.Environment = env
+	return writeLock(lockFile, lock)
+}
+
+// updateEnvironment re-resolves the project's dependencies for env from
+// scratch, restoring the previous bytes.lock if that fails.
+func updateEnvironment(ctx context.Context, env string) error {
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	if _, err := environmentDependencies(m, env); err != nil {
+		return err
+	}
+	old, err := readLock(lockFile)
+	if err != nil {
+		return err
+	}
+	noOptional = old.NoOptional
+	if err := writeLock(lockFile, &Lock{Packages: map[string]*LockEntry{}, Environment: env, NoOptional: old.NoOptional}); err != nil {
+		return err
+	}
+	if err := installEnvironment(ctx, env, InstallOptions{InProject: true, MaxDepth: configuredMaxDepth(), Force: true}); err != nil {
+		if werr := writeLock(lockFile, old); werr != nil {
+			return fmt.Errorf("%v (restoring %s also failed: %v)", err, lockFile, werr)
+		}
+		return err
+	}
+	return nil
+}
+
+func envName(env string) string {
+	if env == "" {
+		return "default"
+	}
+	return env
+}
+
+// environmentSpec applies the constraint env gives pkgName, unless the
+// spec already names a version.
+func environmentSpec(pkgName string, env string) (string, error) {
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		return "", err
+	}
+	deps, err := environmentDependencies(m, env)
+	if err != nil {
+		return "", err
+	}
+	name, version := splitSpec(pkgName)
+	constraint, ok := deps[name]
+	if version != "" || !ok {
+		return pkgName, nil
+	}
+	index, _ := loadIndex()
+	return dependencySpec(index, name, constraint), nil
+}
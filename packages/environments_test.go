@@ -0,0 +1,149 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// envManifest depends on math and io, pins math to 1.0.0 and adds testkit
+// for test, and adds zlib for production.
+const envManifest = `name: app
+version: 0.1.0
+dependencies:
+  math: ^1.0
+  io: "*"
+
+[environments.test.dependencies]
+math: 1.0.0
+testkit: "*"
+
+[environments.production.dependencies]
+zlib: "*"
+`
+
+func TestEnvironmentDependencies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), manifestFile)
+	os.WriteFile(path, []byte(envManifest), 0644)
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		env     string
+		want    map[string]string
+		wantErr string
+	}{
+		{"", map[string]string{"math": "^1.0", "io": "*"}, ""},
+		{"test", map[string]string{"math": "1.0.0", "io": "*", "testkit": "*"}, ""},
+		{"production", map[string]string{"math": "^1.0", "io": "*", "zlib": "*"}, ""},
+		{"staging", nil, "unknown environment staging, bytes.yml defines: production, test"},
+	}
+	for _, tt := range tests {
+		got, err := environmentDependencies(m, tt.env)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("environment %q gave %v, want %q", tt.env, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !maps.Equal(got, tt.want) {
+			t.Errorf("environment %q = %v, %v, want %v", tt.env, got, err, tt.want)
+		}
+	}
+	if m.Dependencies["math"] != "^1.0" {
+		t.Error("resolving an environment changed the base dependencies")
+	}
+	if _, err := environmentDependencies(&Manifest{}, "test"); err == nil || !strings.Contains(err.Error(), "defines none") {
+		t.Errorf("environment of a manifest without any gave %v", err)
+	}
+}
+
+func TestInstallTwoEnvironments(t *testing.T) {
+	archive := func(name string, version string) []byte {
+		return gzipBytes(t, makeTar(t, []tarEntry{{name: name + "/lib.vira", body: version}}))
+	}
+	tests := []struct {
+		env  string
+		want map[string]string // installed package -> the version it holds
+	}{
+		{"test", map[string]string{"math@1.0.0": "1.0.0", "io": "1.0.0", "testkit": "0.3.0"}},
+		{"production", map[string]string{"math": "1.1.0", "io": "1.0.0", "zlib": "1.2.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			home := testHome(t)
+			noProgress = true
+			defer func() { noProgress = false }()
+			quietWarnings(t)
+			writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+				"math":    {Latest: "1.1.0", Versions: map[string]IndexVersion{"1.0.0": {}, "1.1.0": {}}},
+				"io":      {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+				"testkit": {Latest: "0.3.0", Versions: map[string]IndexVersion{"0.3.0": {}}},
+				"zlib":    {Latest: "1.2.0", Versions: map[string]IndexVersion{"1.2.0": {}}},
+			}})
+			newTestRegistry(t, map[string][]byte{
+				"math.tar.gz":       archive("math", "1.1.0"),
+				"math@1.0.0.tar.gz": archive("math", "1.0.0"),
+				"io.tar.gz":         archive("io", "1.0.0"),
+				"testkit.tar.gz":    archive("testkit", "0.3.0"),
+				"zlib.tar.gz":       archive("zlib", "1.2.0"),
+			})
+			wd, _ := os.Getwd()
+			if err := os.Chdir(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chdir(wd)
+			os.WriteFile(manifestFile, []byte(envManifest), 0644)
+
+			if _, err := captureStdout(t, func() error {
+				return installEnvironment(t.Context(), tt.env, InstallOptions{InProject: true, MaxDepth: defaultMaxDepth, NoScripts: true})
+			}); err != nil {
+				t.Fatal(err)
+			}
+			deps := filepath.Join("build", "dependencies")
+			installed, err := listInstalled(deps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for _, full := range installed {
+				data, _ := os.ReadFile(filepath.Join(deps, full, "lib.vira"))
+				got[full] = string(data)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("installed %v, want %v", got, tt.want)
+			}
+			lock, err := readLock(lockFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lock.Environment != tt.env {
+				t.Errorf("lockfile records environment %q, want %q", lock.Environment, tt.env)
+			}
+			if keys := slices.Sorted(maps.Keys(lock.Packages)); !slices.Equal(keys, slices.Sorted(maps.Keys(tt.want))) {
+				t.Errorf("lockfile holds %v, want %v", keys, slices.Sorted(maps.Keys(tt.want)))
+			}
+		})
+	}
+}
+
+func TestInstallUnknownEnvironment(t *testing.T) {
+	testHome(t)
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	os.WriteFile(manifestFile, []byte(envManifest), 0644)
+	err := installEnvironment(t.Context(), "staging", InstallOptions{InProject: true, MaxDepth: defaultMaxDepth, NoScripts: true})
+	if err == nil || !strings.Contains(err.Error(), "unknown environment staging") {
+		t.Fatalf("got %v, want an unknown environment error", err)
+	}
+	if _, err := os.Stat(filepath.Join("build", "dependencies")); !os.IsNotExist(err) {
+		t.Error("an unknown environment installed packages")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is one line of the --events stream: newline-delimited JSON on
+// stdout, for IDEs that render their own progress. Types are
+//
+//	resolve_start      package                 the install begins resolving package
+//	download_progress  package, bytes, total   periodically while downloading
+//	download_done      package, bytes, url     archive fully downloaded
+//	extract_done       package                 archive unpacked
+//	install_done       package                 package and dependencies installed
+//	message            package, message        human-readable progress, such as "math@1.2.0 already installed"
+//	warning            package, code, message  see Warning; package may be empty
+//	error              package, error          the command failed
+//
+// total is omitted when the server sends no Content-Length.
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Package string    `json:"package,omitempty"`
+	URL     string    `json:"url,omitempty"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	Total   int64     `json:"total,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Code    string    `json:"code,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+var (
+	eventsMu  sync.Mutex
+	eventsOut io.Writer // nil unless --events was given
+)
+
+func eventsEnabled() bool {
+	return eventsOut != nil
+}
+
+func emit(e Event) {
+	if eventsOut == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	eventsOut.Write(append(data, '\n'))
+}
+
+// notify prints a human-readable progress message about pkg, which may be
+// empty. With --events it becomes a message event instead, keeping stdout
+// NDJSON.
+func notify(pkg string, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if eventsEnabled() {
+		emit(Event{Type: "message", Package: pkg, Message: msg})
+		return
+	}
+	fmt.Println(msg)
+}
+
+// printError prints a failure the way fmt.Println would, or as an error
+// event with --events.
+func printError(a ...any) {
+	if eventsEnabled() {
+		emit(Event{Type: "error", Error: strings.TrimSuffix(fmt.Sprintln(a...), "\n")})
+		return
+	}
+	fmt.Println(a...)
+}
+
+// scriptOutput is where lifecycle scripts write their stdout: stderr with
+// --events, so it does not mix with the event stream.
+func scriptOutput() io.Writer {
+	if eventsEnabled() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// progressReader reports download progress at most every interval, as
+// download_progress events or as human progress output.
+type progressReader struct {
+	r        io.Reader
+	pkg      string
+	total    int64
+	read     int64
+	last     time.Time
+	interval time.Duration
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if now := time.Now(); now.Sub(p.last) >= p.interval {
+		p.last = now
+		total := p.total
+		if total < 0 {
+			total = 0
+		}
+		emit(Event{Type: "download_progress", Package: p.pkg, Bytes: p.read, Total: total})
+		showProgress(p.pkg, p.read, p.total)
+	}
+	return n, err
+}
+
+// enableEvents switches the process to event output on stdout.
+func enableEvents() {
+	eventsOut = os.Stdout
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMessagesWithEvents(t *testing.T) {
+	var buf bytes.Buffer
+	eventsOut = &buf
+	defer func() { eventsOut = nil }()
+
+	out, _ := captureStdout(t, func() error {
+		notify("math", "%s@%s already installed", "math", "1.2.0")
+		printError(errors.New("no such package"))
+		return nil
+	})
+	if out != "" {
+		t.Errorf("printed %q outside the event stream", out)
+	}
+	if scriptOutput() == os.Stdout {
+		t.Error("lifecycle scripts write to stdout")
+	}
+	var got []Event
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("event line %q: %v", line, err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want 2: %s", len(got), buf.String())
+	}
+	if e := got[0]; e.Type != "message" || e.Package != "math" || e.Message != "math@1.2.0 already installed" {
+		t.Errorf("notify sent %+v", e)
+	}
+	if e := got[1]; e.Type != "error" || e.Error != "no such package" {
+		t.Errorf("printError sent %+v", e)
+	}
+}
+
+func TestInstallEventSequence(t *testing.T) {
+	home := testHome(t)
+	noProgress = true
+	defer func() { noProgress = false }()
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+	}})
+	newTestRegistry(t, map[string][]byte{
+		"math.tar.gz": gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.0.0"}})),
+	})
+	var buf bytes.Buffer
+	eventsOut = &buf
+	defer func() { eventsOut = nil }()
+
+	out, err := captureStdout(t, func() error {
+		return install(t.Context(), "math", InstallOptions{Prefix: t.TempDir(), MaxDepth: 8, NoScripts: true})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "" {
+		t.Errorf("printed %q outside the event stream", out)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("event line %q is not JSON: %v", line, err)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("event %s has no time", line)
+		}
+		if e.Type == "download_progress" {
+			// How many are sent depends on timing.
+			continue
+		}
+		got = append(got, e.Type+" "+e.Package)
+	}
+	want := []string{"resolve_start math", "download_done math", "extract_done math", "install_done math"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
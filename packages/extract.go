@@ -0,0 +1,294 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Archive compression formats, by preference. Every version is published
+// as gzip; zstd is used when a version advertises it.
+var (
+	formatPreference = []string{"zst", "gz"}
+	formatMediaTypes = map[string]string{"zst": "application/zstd", "gz": "application/gzip"}
+)
+
+// pickFormat chooses the preferred supported format among those a package
+// version advertises. Versions that advertise nothing are gzip.
+func pickFormat(available []string) string {
+	if len(available) == 0 {
+		return "gz"
+	}
+	for _, f := range formatPreference {
+		if slices.Contains(available, f) {
+			return f
+		}
+	}
+	return "gz"
+}
+
+// acceptHeader lists the supported archive media types for downloads.
+func acceptHeader() string {
+	var types []string
+	for _, f := range formatPreference {
+		types = append(types, formatMediaTypes[f])
+	}
+	return strings.Join(types, ", ")
+}
+
+// archiveExt is the tarball extension to request for pkgName, based on the
+// formats the version it resolves to advertises in the cached index.
+func archiveExt(pkgName string) string {
+	meta, _ := indexVersion(pkgName)
+	return ".tar." + pickFormat(meta.Formats)
+}
+
+// detectFormat identifies an archive from its magic bytes, falling back to
+// the extension after ".tar.", so that unsupported formats are named in
+// the error.
+func detectFormat(path string, header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return "gz"
+	case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return "zst"
+	}
+	if _, ext, ok := strings.Cut(filepath.Base(path), ".tar."); ok {
+		return ext
+	}
+	return "gz"
+}
+
+func decompressReader(r io.Reader, format string) (io.Reader, error) {
+	switch format {
+	case "gz":
+		return gzip.NewReader(r)
+	case "zst":
+		return newZstdReader(r), nil
+	}
+	return nil, fmt.Errorf("unknown archive format %q", format)
+}
+
+// stripComponents drops that many leading path components from archive
+// entries, set by --strip-components. The default, -1, strips a single
+// top-level directory named after the package (math/ or math-1.2.0/) and
+// nothing otherwise. noPreserveMtime, set by --no-preserve-mtime, leaves
+// extracted files with the current time instead of the archive's.
+var (
+	stripComponents = -1
+	noPreserveMtime bool
+)
+
+// extractPackage unpacks archive into dest, replacing what was there.
+func extractPackage(ctx context.Context, archive string, dest string) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return extractStream(ctx, file, archive, dest, nil)
+}
+
+// extractStream unpacks the archive read from r, named archive, into dest.
+// verify, when set, runs once everything is extracted and before dest is
+// replaced; if it fails dest is left untouched.
+func extractStream(ctx context.Context, r io.Reader, archive string, dest string, verify func() error) error {
+	buf := bufio.NewReader(ctxReader{ctx, r})
+	header, err := buf.Peek(4)
+	if len(header) == 0 {
+		if ctx.Err() != nil {
+			return err
+		}
+		return fmt.Errorf("package archive is empty")
+	}
+	tr, err := decompressReader(buf, detectFormat(archive, header))
+	if err != nil {
+		return err
+	}
+
+	// Unpack into a staging directory that replaces dest only once the
+	// whole archive is extracted.
+	staging := filepath.Clean(dest) + ".staging"
+	defer track(staging)()
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return err
+	}
+	pkgName, _, _ := strings.Cut(filepath.Base(archive), ".tar.")
+	if err := extractTar(tr, pkgName, staging, max(stripComponents, 0), packageBins(pkgName), packageGroups(pkgName)); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+	if verify != nil {
+		if err := verify(); err != nil {
+			os.RemoveAll(staging)
+			return err
+		}
+	}
+	root := staging
+	if stripComponents < 0 {
+		name, _ := splitSpec(pkgName)
+		root = wrappingDir(staging, name)
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	if err := os.Rename(root, dest); err != nil {
+		return err
+	}
+	return os.RemoveAll(staging)
+}
+
+// wrappingDir returns the directory inside dir that holds the whole
+// package when the archive wraps everything in pkgName/ or pkgName-<ver>/,
+// and dir itself otherwise.
+func wrappingDir(dir string, pkgName string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return dir
+	}
+	name := entries[0].Name()
+	if name == pkgName || strings.HasPrefix(name, pkgName+"-") {
+		return filepath.Join(dir, name)
+	}
+	return dir
+}
+
+// extractTar writes the entries of a tar stream below dest, dropping
+// strip leading path components and limiting file modes by the configured
+// PermPolicy; bins are the package's declared executables. Entries of
+// asset groups not selected by extractGroups are skipped, as are links and
+// special files, which are reported as warnings against pkgName.
+// Directory times are applied last, as writing their contents changes
+// them.
+//
+// An archive without a single file is an error. When stripping leaves
+// nothing but the archive held exactly one file, that file is kept under
+// its base name rather than dropped.
+func extractTar(r io.Reader, pkgName string, dest string, strip int, bins map[string]string, groups map[string]AssetGroup) error {
+	policy := loadPermPolicy()
+	type dirTime struct {
+		path string
+		time time.Time
+	}
+	var dirs []dirTime
+	var files int
+	var dropped []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if strip > 0 {
+			parts := strings.Split(name, "/")
+			if len(parts) <= strip {
+				if hdr.Typeflag == tar.TypeReg {
+					dropped = append(dropped, path.Base(name))
+					if len(dropped) == 1 {
+						// Kept aside in case it turns out to be the whole package.
+						if err := writeEntry(filepath.Join(dest, ".dropped"), tr, applyPermPolicy(hdr.FileInfo().Mode(), policy)); err != nil {
+							return err
+						}
+					}
+				}
+				continue
+			}
+			name = strings.Join(parts[strip:], "/")
+		}
+		if !shouldExtractEntry(name, groups, extractGroups) {
+			// Left out on purpose, so it still counts towards a non-empty package.
+			if hdr.Typeflag == tar.TypeReg {
+				files++
+			}
+			continue
+		}
+		target := filepath.Join(dest, name)
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) && target != filepath.Clean(dest) {
+			return fmt.Errorf("archive entry %s escapes package directory", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirTime{target, hdr.ModTime})
+		case tar.TypeReg:
+			p := policy
+			if needsExec(name, bins) {
+				p.NoExec = false
+			}
+			if err := writeEntry(target, tr, applyPermPolicy(hdr.FileInfo().Mode(), p)); err != nil {
+				return err
+			}
+			files++
+			if !noPreserveMtime && !hdr.ModTime.IsZero() {
+				os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+			}
+		case tar.TypeSymlink:
+			warn(codeSkippedEntry, pkgName, "%s: skipped symlink %s -> %s", pkgName, name, hdr.Linkname)
+		case tar.TypeLink:
+			warn(codeSkippedEntry, pkgName, "%s: skipped hard link %s -> %s", pkgName, name, hdr.Linkname)
+		case tar.TypeXGlobalHeader:
+			// Metadata written by git archive and others, not a file.
+		default:
+			warn(codeSkippedEntry, pkgName, "%s: skipped special file %s", pkgName, name)
+		}
+	}
+	if len(dropped) > 0 {
+		kept := filepath.Join(dest, ".dropped")
+		if files > 0 || len(dropped) > 1 {
+			os.Remove(kept)
+		} else if err := os.Rename(kept, filepath.Join(dest, dropped[0])); err != nil {
+			return err
+		} else {
+			files++
+		}
+	}
+	if files == 0 {
+		return fmt.Errorf("package archive is empty")
+	}
+	if !noPreserveMtime {
+		for i := len(dirs) - 1; i >= 0; i-- {
+			if !dirs[i].time.IsZero() {
+				os.Chtimes(dirs[i].path, dirs[i].time, dirs[i].time)
+			}
+		}
+	}
+	return nil
+}
+
+func writeEntry(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// OpenFile only applies the mode to new files, and only under umask.
+	return os.Chmod(target, mode.Perm())
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// listTree returns the files below dir as slash paths with their modes.
+func listTree(t *testing.T, dir string) map[string]os.FileMode {
+	t.Helper()
+	files := map[string]os.FileMode{}
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !d.IsDir() {
+			info, _ := d.Info()
+			rel, _ := filepath.Rel(dir, path)
+			files[filepath.ToSlash(rel)] = info.Mode().Perm()
+		}
+		return nil
+	})
+	return files
+}
+
+func TestExtractTarStrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		strip   int
+		entries []tarEntry
+		want    []string
+		wantErr string
+	}{
+		{"no strip", 0,
+			[]tarEntry{{name: "math/"}, {name: "math/lib.vira", body: "x"}},
+			[]string{"math/lib.vira"}, ""},
+		{"strip one", 1,
+			[]tarEntry{{name: "math-1.2.0/lib.vira", body: "x"}, {name: "math-1.2.0/src/a.vira", body: "y"}},
+			[]string{"lib.vira", "src/a.vira"}, ""},
+		{"strip keeps a lone file", 1,
+			[]tarEntry{{name: "tool", body: "#!/bin/sh"}},
+			[]string{"tool"}, ""},
+		{"strip drops top-level files beside others", 1,
+			[]tarEntry{{name: "README", body: "r"}, {name: "pkg/lib.vira", body: "x"}},
+			[]string{"lib.vira"}, ""},
+		{"dot slash prefix", 0,
+			[]tarEntry{{name: "./lib.vira", body: "x"}},
+			[]string{"lib.vira"}, ""},
+		{"escaping entry", 0,
+			[]tarEntry{{name: "../evil", body: "x"}},
+			nil, "escapes package directory"},
+		{"only directories", 0,
+			[]tarEntry{{name: "empty/", typ: tar.TypeDir}},
+			nil, "archive is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testHome(t)
+			for i := range tt.entries {
+				if strings.HasSuffix(tt.entries[i].name, "/") {
+					tt.entries[i].typ, tt.entries[i].mode = tar.TypeDir, 0755
+				}
+			}
+			dest := t.TempDir()
+			err := extractTar(bytes.NewReader(makeTar(t, tt.entries)), "math", dest, tt.strip, nil, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for f := range listTree(t, dest) {
+				got = append(got, f)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("extracted %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractTarPermissions(t *testing.T) {
+	entries := []tarEntry{
+		{name: "lib.vira", mode: 0666},
+		{name: "run.sh", mode: 0777},
+		{name: "setuid", mode: 04755},
+		{name: "bin/tool", mode: 0755},
+		{name: "declared", mode: 0755},
+	}
+	bins := map[string]string{"declared": "declared"}
+	tests := []struct {
+		name   string
+		config string
+		want   map[string]os.FileMode
+	}{
+		{"default mask", "",
+			map[string]os.FileMode{"lib.vira": 0644, "run.sh": 0755, "setuid": 0755, "bin/tool": 0755, "declared": 0755}},
+		{"no-exec-data", "no-exec-data: true\n",
+			map[string]os.FileMode{"lib.vira": 0644, "run.sh": 0644, "setuid": 0644, "bin/tool": 0755, "declared": 0755}},
+		{"file-mask", "file-mask: 077\n",
+			map[string]os.FileMode{"lib.vira": 0600, "run.sh": 0700, "setuid": 0700, "bin/tool": 0700, "declared": 0700}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := testHome(t)
+			if tt.config != "" {
+				os.MkdirAll(filepath.Join(home, ".vira"), 0755)
+				os.WriteFile(filepath.Join(home, ".vira", "config.yml"), []byte(tt.config), 0644)
+			}
+			dest := t.TempDir()
+			if err := extractTar(bytes.NewReader(makeTar(t, entries)), "tool", dest, 0, bins, nil); err != nil {
+				t.Fatal(err)
+			}
+			got := listTree(t, dest)
+			for name, mode := range tt.want {
+				if got[name] != mode {
+					t.Errorf("%s has mode %o, want %o", name, got[name], mode)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractTarReportsSkippedEntries(t *testing.T) {
+	testHome(t)
+	warningsQuiet = true
+	defer func() { warningsQuiet = false }()
+	entries := []tarEntry{
+		{typ: tar.TypeXGlobalHeader, body: "0123abc"},
+		{name: "lib.vira", body: "x"},
+		{name: "current", typ: tar.TypeSymlink, link: "lib.vira"},
+		{name: "copy", typ: tar.TypeLink, link: "lib.vira"},
+		{name: "pipe", typ: tar.TypeFifo},
+	}
+	dest := t.TempDir()
+	before := len(collectedWarnings())
+	if err := extractTar(bytes.NewReader(makeTar(t, entries)), "math", dest, 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := listTree(t, dest); len(got) != 1 {
+		t.Errorf("extracted %v, want only lib.vira", got)
+	}
+	var got []string
+	for _, w := range collectedWarnings()[before:] {
+		if w.Code != codeSkippedEntry || w.Package != "math" {
+			t.Errorf("unexpected warning %+v", w)
+		}
+		got = append(got, w.Message)
+	}
+	want := []string{
+		"math: skipped symlink current -> lib.vira",
+		"math: skipped hard link copy -> lib.vira",
+		"math: skipped special file pipe",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("warnings %q, want %q", got, want)
+	}
+}
+
+func TestPickFormat(t *testing.T) {
+	tests := []struct {
+		available []string
+		want      string
+	}{
+		{nil, "gz"},
+		{[]string{"gz"}, "gz"},
+		{[]string{"gz", "zst"}, "zst"},
+		{[]string{"zst"}, "zst"},
+		{[]string{"xz"}, "gz"},
+	}
+	for _, tt := range tests {
+		if got := pickFormat(tt.available); got != tt.want {
+			t.Errorf("pickFormat(%q) = %q, want %q", tt.available, got, tt.want)
+		}
+	}
+}
+
+func TestDecompressReader(t *testing.T) {
+	tarball := makeTar(t, []tarEntry{{name: "lib.vira", body: "x"}})
+	zst, err := os.ReadFile(filepath.Join("testdata", "math.tar.zst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		path    string
+		data    []byte
+		wantErr string
+	}{
+		{"gzip", "math.tar.gz", gzipBytes(t, tarball), ""},
+		{"zstd", "math.tar.zst", zst, ""},
+		{"gzip magic wins over the name", "math.tar.zst", gzipBytes(t, tarball), ""},
+		{"zstd magic wins over the name", "math.tar.gz", zst, ""},
+		{"unsupported format", "math.tar.xz", []byte{0xfd, '7', 'z', 'X', 'Z'}, `unknown archive format "xz"`},
+		{"not gzip", "math.tar.gz", tarball, "gzip: invalid header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := decompressReader(bytes.NewReader(tt.data), detectFormat(tt.path, tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			hdr, err := tar.NewReader(r).Next()
+			if err != nil || path.Base(hdr.Name) != "lib.vira" {
+				t.Errorf("first entry %v, %v, want lib.vira", hdr, err)
+			}
+		})
+	}
+}
+
+func TestInstallPrefersAdvertisedZstd(t *testing.T) {
+	home := testHome(t)
+	noProgress = true
+	defer func() { noProgress = false }()
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{
+			"1.0.0": {Formats: []string{"gz", "zst"}, Dependencies: map[string]string{"io": "1.0.0"}},
+		}},
+		"io": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+	}})
+	zst, err := os.ReadFile(filepath.Join("testdata", "math.tar.zst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := newTestRegistry(t, map[string][]byte{
+		"math.tar.zst": zst,
+		"math.tar.gz":  gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "gz"}})),
+		"io.tar.gz":    gzipBytes(t, makeTar(t, []tarEntry{{name: "io/io.vira", body: "io"}})),
+	})
+	prefix := t.TempDir()
+	if _, err := captureStdout(t, func() error {
+		return install(t.Context(), "math", InstallOptions{Prefix: prefix, MaxDepth: 8, NoScripts: true})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// io advertises no formats, so it falls back to gzip.
+	for name, want := range map[string]int{"math.tar.zst": 1, "math.tar.gz": 0, "io.tar.gz": 1, "io.tar.zst": 0} {
+		if n := reg.count(name); n != want {
+			t.Errorf("%s fetched %d times, want %d", name, n, want)
+		}
+	}
+	dir, err := globalLibsDir(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]string{"math/lib.vira": "zst", "io/io.vira": "io"} {
+		if got, _ := os.ReadFile(filepath.Join(dir, file)); string(got) != want {
+			t.Errorf("%s holds %q, want %q", file, got, want)
+		}
+	}
+}
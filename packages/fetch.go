@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fetchStateFile lists the archives of a bundle that are complete and
+// verified, so a rerun of fetch skips them.
+const fetchStateFile = ".fetch-state.json"
+
+type fetchState struct {
+	Done map[string]string `json:"done"` // archive file name -> integrity
+}
+
+func readFetchState(out string) *fetchState {
+	state := &fetchState{Done: map[string]string{}}
+	if data, err := os.ReadFile(filepath.Join(out, fetchStateFile)); err == nil {
+		json.Unmarshal(data, state)
+	}
+	if state.Done == nil {
+		state.Done = map[string]string{}
+	}
+	return state
+}
+
+func (s *fetchState) save(out string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(out, fetchStateFile), data, 0644)
+}
+
+// recordBundleIntegrity publishes the checksum of a bundled archive of
+// version in the bundle's index when the registry's index did not, so
+// installs from the bundle verify it.
+func recordBundleIntegrity(entry IndexPackage, version string, integrity string) {
+	if meta, ok := entry.Versions[version]; ok && meta.Integrity == "" {
+		meta.Integrity = integrity
+		entry.Versions[version] = meta
+	}
+}
+
+// bundleSpec is what an install asks a registry for to get version of pkg:
+// the bare name for the latest version and name@version otherwise, as
+// dependencySpec writes them. Bundled archives are named after it.
+func bundleSpec(name string, version string, pkg IndexPackage) string {
+	if version == pkg.Latest {
+		return name
+	}
+	return name + "@" + version
+}
+
+// fetchBundle downloads specs and their dependencies into out as an
+// offline bundle for install --from-dir. Archives finished by an earlier
+// run are skipped once their checksum still matches, and interrupted
+// downloads resume where they stopped. It returns how many archives were
+// downloaded and how many were already complete.
+func fetchBundle(ctx context.Context, specs []string, out string, maxDepth int) (fetched int, complete int, err error) {
+	index, err := loadIndex()
+	if err != nil {
+		return fetched, complete, err
+	}
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return fetched, complete, err
+	}
+	var deps []Dependency
+	seen := map[string]int{}
+	for _, spec := range specs {
+		res, err := resolveDependencies(index, spec, maxDepth)
+		if err != nil {
+			return fetched, complete, err
+		}
+		for _, dep := range res.Packages {
+			key := dep.Name + "@" + dep.Version
+			if i, ok := seen[key]; !ok {
+				seen[key] = len(deps)
+				deps = append(deps, dep)
+			} else if !dep.Optional {
+				deps[i].Optional = false
+			}
+		}
+	}
+
+	state := readFetchState(out)
+	bundle := Index{Packages: map[string]IndexPackage{}}
+	bundled := map[string]bool{}
+	for _, dep := range deps {
+		name := dep.Name
+		pkg, ok := index.lookup(name)
+		if !ok {
+			continue
+		}
+		entry, ok := bundle.Packages[name]
+		if !ok {
+			entry = bundleEntry(pkg)
+			bundle.Packages[name] = entry
+		}
+		version := pickVersion(pkg, dep.Version)
+		meta := pkg.Versions[version]
+		spec := bundleSpec(name, version, pkg)
+		ext := ".tar." + pickFormat(meta.Formats)
+		file := filepath.Join(out, spec+ext)
+		if integrity, ok := state.Done[spec+ext]; ok && verifyChecksum(file, integrity) == nil {
+			recordBundleIntegrity(entry, version, integrity)
+			bundled[name] = true
+			complete++
+			continue
+		}
+		url := meta.URL
+		if url == "" {
+			url = registryURL() + spec + ext
+		}
+		integrity, err := downloadFile(ctx, url, file, true)
+		if err != nil && dep.Optional {
+			warn(codeOptionalSkipped, name, "optional dependency %s could not be fetched, leaving it out: %v", spec, err)
+			continue
+		}
+		if err != nil {
+			return fetched, complete, fmt.Errorf("fetching %s failed after %d of %d packages, rerun fetch to resume: %v", spec, fetched, len(deps), err)
+		}
+		if err := checkIndexIntegrity(spec, file, integrity); err != nil {
+			return fetched, complete, err
+		}
+		recordBundleIntegrity(entry, version, integrity)
+		state.Done[spec+ext] = integrity
+		if err := state.save(out); err != nil {
+			return fetched, complete, err
+		}
+		bundled[name] = true
+		fetched++
+	}
+	// Optional dependencies that could not be fetched are left out.
+	for name := range bundle.Packages {
+		if !bundled[name] {
+			delete(bundle.Packages, name)
+		}
+	}
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return fetched, complete, err
+	}
+	if err := writeFileAtomic(filepath.Join(out, "index.json"), data, 0644); err != nil {
+		return fetched, complete, err
+	}
+	return fetched, complete, nil
+}
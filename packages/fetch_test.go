@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fetchFixture caches an index in which math has an older 1.0.0 besides
+// its latest 1.1.0, and serves their archives and io's as the registry.
+func fetchFixture(t *testing.T) (*testRegistry, map[string][]byte) {
+	t.Helper()
+	home := testHome(t)
+	noProgress = true
+	t.Cleanup(func() { noProgress = false })
+	files := map[string][]byte{
+		"math.tar.gz":       gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.1.0"}})),
+		"math@1.0.0.tar.gz": gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.0.0"}})),
+		"io.tar.gz":         gzipBytes(t, makeTar(t, []tarEntry{{name: "io/io.vira", body: "io"}})),
+	}
+	sum := sha256.Sum256(files["math@1.0.0.tar.gz"])
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math": {Latest: "1.1.0", Versions: map[string]IndexVersion{
+			"1.0.0": {Integrity: "sha256-" + hex.EncodeToString(sum[:]), Dependencies: map[string]string{"io": "1.0.0"}},
+			"1.1.0": {Dependencies: map[string]string{"io": "1.0.0"}},
+		}},
+		"io": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+	}})
+	return newTestRegistry(t, files), files
+}
+
+func readBundleIndex(t *testing.T, dir string) Index {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func TestFetchBundleKeepsVersionsApart(t *testing.T) {
+	_, files := fetchFixture(t)
+	out := t.TempDir()
+	fetched, complete, err := fetchBundle(t.Context(), []string{"math@1.0.0", "math"}, out, defaultMaxDepth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched != 3 || complete != 0 {
+		t.Errorf("fetched %d, complete %d, want 3 and 0", fetched, complete)
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil || string(got) != string(want) {
+			t.Errorf("%s in the bundle differs from the registry's (%v)", name, err)
+		}
+	}
+	math := readBundleIndex(t, out).Packages["math"]
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		if !strings.HasPrefix(math.Versions[version].Integrity, "sha256-") {
+			t.Errorf("bundle index has no integrity for math@%s", version)
+		}
+	}
+}
+
+func TestFetchBundleChecksResolvedVersion(t *testing.T) {
+	reg, _ := fetchFixture(t)
+	// Serve 1.1.0's archive in place of 1.0.0's, whose checksum is known.
+	reg.mu.Lock()
+	reg.files["math@1.0.0.tar.gz"] = reg.files["math.tar.gz"]
+	reg.mu.Unlock()
+	_, _, err := fetchBundle(t.Context(), []string{"math@1.0.0"}, t.TempDir(), defaultMaxDepth)
+	if _, ok := err.(*IntegrityError); !ok {
+		t.Fatalf("got %v, want an integrity error for math@1.0.0", err)
+	}
+}
+
+func TestFetchBundleResumes(t *testing.T) {
+	reg, _ := fetchFixture(t)
+	out := t.TempDir()
+	reg.mu.Lock()
+	reg.fail["io.tar.gz"] = true
+	reg.mu.Unlock()
+	if _, _, err := fetchBundle(t.Context(), []string{"math@1.0.0", "math"}, out, defaultMaxDepth); err == nil || !strings.Contains(err.Error(), "rerun fetch to resume") {
+		t.Fatalf("got %v, want the failed fetch reported", err)
+	}
+	reg.mu.Lock()
+	reg.fail["io.tar.gz"] = false
+	reg.mu.Unlock()
+	fetched, complete, err := fetchBundle(t.Context(), []string{"math@1.0.0", "math"}, out, defaultMaxDepth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// math@1.0.0 was done before io failed; io and math are left.
+	if fetched != 2 || complete != 1 {
+		t.Errorf("second run fetched %d, complete %d, want 2 and 1", fetched, complete)
+	}
+	if n := reg.count("math@1.0.0.tar.gz"); n != 1 {
+		t.Errorf("math@1.0.0.tar.gz requested %d times, want once", n)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Drift categories reported by checkFrozen, in report order.
+const (
+	driftOutOfSync = "out of sync"
+	driftMissing   = "missing"
+	driftChecksum  = "checksum mismatch"
+	driftUnlocked  = "no locked checksum"
+)
+
+var driftOrder = []string{driftOutOfSync, driftMissing, driftChecksum, driftUnlocked}
+
+// Drift is one way the project differs from its lockfile.
+type Drift struct {
+	Category string `json:"category"`
+	Package  string `json:"package"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// lockSyncDrift compares bytes.lock with the manifest: every dependency of
+// the locked environment must be locked at a version its constraint
+// allows, and, when the cached index can resolve the tree, nothing else
+// may be locked.
+func lockSyncDrift(m *Manifest, lock *Lock) ([]Drift, error) {
+	deps, err := environmentDependencies(m, lock.Environment)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(deps, m.DevDependencies)
+	locked := map[string]string{}
+	for key := range lock.Packages {
+		name, _ := splitSpec(key)
+		locked[name] = key
+	}
+
+	var drift []Drift
+	for _, name := range slices.Sorted(maps.Keys(deps)) {
+		key, ok := locked[name]
+		if !ok {
+			drift = append(drift, Drift{driftOutOfSync, name, "in " + manifestFile + " but not locked"})
+			continue
+		}
+		constraint := deps[name]
+		version := lockedVersion(key, lock.Packages[key])
+		if constraint == "" || constraint == "*" || version == "" {
+			continue
+		}
+		if ok, err := satisfies(version, constraint); err == nil && !ok {
+			drift = append(drift, Drift{driftOutOfSync, name, fmt.Sprintf("locked at %s, %s wants %s", version, manifestFile, constraint)})
+		}
+	}
+
+	index, err := loadIndex()
+	if err != nil {
+		return drift, nil
+	}
+	wanted := map[string]bool{}
+	for name := range deps {
+		res, err := resolveDependencies(index, dependencySpec(index, name, deps[name]), configuredMaxDepth())
+		if err != nil {
+			// The tree cannot be resolved offline; only direct
+			// dependencies are checked.
+			return drift, nil
+		}
+		for _, dep := range res.Packages {
+			wanted[dep.Name] = true
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(locked)) {
+		if !wanted[name] {
+			drift = append(drift, Drift{driftOutOfSync, name, "locked but no longer needed by " + manifestFile})
+		}
+	}
+	return drift, nil
+}
+
+// installedDrift checks that every locked package is installed in destDir
+// with an archive matching its locked checksum.
+func installedDrift(lock *Lock, destDir string) []Drift {
+	var drift []Drift
+	for _, key := range slices.Sorted(maps.Keys(lock.Packages)) {
+		name, _ := splitSpec(key)
+		if _, ok := overrideFor(name); ok {
+			continue
+		}
+		locked, ok := lock.Packages[key].resolved(currentPlatform())
+		if !ok || locked.Integrity == "" {
+			drift = append(drift, Drift{driftUnlocked, key, "no checksum for " + currentPlatform() + " in " + lockFile})
+			continue
+		}
+		archives, _ := filepath.Glob(filepath.Join(destDir, key+".tar.*"))
+		if len(archives) != 1 {
+			drift = append(drift, Drift{driftMissing, key, "not installed in " + destDir})
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(destDir, key)); err != nil {
+			drift = append(drift, Drift{driftMissing, key, "archive present but not extracted"})
+			continue
+		}
+		if err := verifyChecksum(archives[0], locked.Integrity); err != nil {
+			drift = append(drift, Drift{driftChecksum, key, err.Error()})
+		}
+	}
+	return drift
+}
+
+// checkFrozen runs the frozen-lockfile gate for the project in the
+// current directory. It only reads local files: the network is disabled
+// for the rest of the run.
+func checkFrozen(verifyInstalled bool) ([]Drift, error) {
+	offline = true
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(lockFile); err != nil {
+		return nil, fmt.Errorf("%s is missing, run install --in-project to create it", lockFile)
+	}
+	lock, err := readLock(lockFile)
+	if err != nil {
+		return nil, err
+	}
+	drift, err := lockSyncDrift(m, lock)
+	if err != nil {
+		return nil, err
+	}
+	if verifyInstalled {
+		drift = append(drift, installedDrift(lock, filepath.Join("build", "dependencies"))...)
+	}
+	return drift, nil
+}
+
+// printDrift writes the gate's report grouped by category, or as JSON.
+func printDrift(drift []Drift, asJSON bool) error {
+	if asJSON {
+		if drift == nil {
+			drift = []Drift{}
+		}
+		return printJSON(map[string]any{"ok": len(drift) == 0, "drift": drift, "warnings": collectedWarnings()})
+	}
+	if len(drift) == 0 {
+		notify("", "%s is in sync and every locked package is installed intact", lockFile)
+		return nil
+	}
+	if eventsEnabled() {
+		for _, d := range drift {
+			notify(d.Package, "%s: %s: %s", d.Category, d.Package, d.Detail)
+		}
+		return nil
+	}
+	for _, category := range driftOrder {
+		var lines []string
+		for _, d := range drift {
+			if d.Category == category {
+				lines = append(lines, "  "+d.Package+": "+d.Detail)
+			}
+		}
+		if len(lines) > 0 {
+			fmt.Printf("%s (%d):\n%s\n", category, len(lines), strings.Join(lines, "\n"))
+		}
+	}
+	return nil
+}
+
+// hasChecksumDrift reports whether drift includes tampered archives,
+// which exit with the integrity status rather than a plain failure.
+func hasChecksumDrift(drift []Drift) bool {
+	return slices.ContainsFunc(drift, func(d Drift) bool { return d.Category == driftChecksum })
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockSyncDriftResolvesConstraints(t *testing.T) {
+	home := testHome(t)
+	warningsQuiet = true
+	defer func() { warningsQuiet = false }()
+	// math 2.0.0 swapped its old dependency for a new one; the project
+	// still asks for math 1.0.0.
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math": {Latest: "2.0.0", Versions: map[string]IndexVersion{
+			"1.0.0": {Dependencies: map[string]string{"old": "1.0.0"}},
+			"2.0.0": {Dependencies: map[string]string{"new": "1.0.0"}},
+		}},
+		"old": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+		"new": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+	}})
+	path := filepath.Join(t.TempDir(), manifestFile)
+	if err := os.WriteFile(path, []byte("name: app\nversion: 0.1.0\ndependencies:\n  math: 1.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := &Lock{Packages: map[string]*LockEntry{
+		"math@1.0.0": {Version: "1.0.0"},
+		"old":        {Version: "1.0.0"},
+	}}
+	drift, err := lockSyncDrift(m, lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift) != 0 {
+		t.Errorf("drift %+v, want none", drift)
+	}
+
+	lock.Packages["new"] = &LockEntry{Version: "1.0.0"}
+	drift, err = lockSyncDrift(m, lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift) != 1 || drift[0].Package != "new" || drift[0].Category != driftOutOfSync {
+		t.Errorf("drift %+v, want new reported as no longer needed", drift)
+	}
+}
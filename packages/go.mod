@@ -0,0 +1,3 @@
+module github.com/Vira-Lang/vira/packages
+
+go 1.24
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// AssetGroup tags archive entries such as docs or examples so installs
+// can leave them out. Paths are package-relative directories, files or
+// path.Match patterns. Optional groups are skipped unless asked for.
+type AssetGroup struct {
+	Paths    []string `json:"paths"`
+	Optional bool     `json:"optional,omitempty"`
+}
+
+// ExtractOpts selects asset groups by name: With adds optional groups,
+// Without drops groups that would otherwise be extracted.
+type ExtractOpts struct {
+	With    map[string]bool
+	Without map[string]bool
+}
+
+// extractGroups is the selection made by install's --with and --without.
+var extractGroups ExtractOpts
+
+// parseGroupSelection builds ExtractOpts from comma-separated group lists.
+func parseGroupSelection(with string, without string) (ExtractOpts, error) {
+	opts := ExtractOpts{With: map[string]bool{}, Without: map[string]bool{}}
+	for _, g := range strings.Split(with, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			opts.With[g] = true
+		}
+	}
+	for _, g := range strings.Split(without, ",") {
+		if g = strings.TrimSpace(g); g == "" {
+			continue
+		} else if opts.With[g] {
+			return opts, fmt.Errorf("group %s is given to both --with and --without", g)
+		}
+		opts.Without[g] = true
+	}
+	return opts, nil
+}
+
+// packageGroups returns the asset groups pkgName declares in the cached
+// index.
+func packageGroups(pkgName string) map[string]AssetGroup {
+	meta, _ := indexVersion(pkgName)
+	return meta.Groups
+}
+
+// contains reports whether the entry name falls under one of the paths.
+func (g AssetGroup) contains(name string) bool {
+	for _, p := range g.Paths {
+		p = path.Clean(strings.TrimPrefix(p, "./"))
+		if name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldExtractEntry decides whether the archive entry name is written.
+// Entries outside every group always are; an entry in a group is skipped
+// when the group is excluded, or optional and not asked for.
+func shouldExtractEntry(name string, groups map[string]AssetGroup, opts ExtractOpts) bool {
+	for group, g := range groups {
+		if !g.contains(name) {
+			continue
+		}
+		if opts.Without[group] || (g.Optional && !opts.With[group]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestShouldExtractEntry(t *testing.T) {
+	groups := map[string]AssetGroup{
+		"docs":     {Paths: []string{"docs"}},
+		"examples": {Paths: []string{"./examples/"}, Optional: true},
+		"fixtures": {Paths: []string{"testdata/*.bin"}, Optional: true},
+	}
+	tests := []struct {
+		name  string
+		entry string
+		opts  ExtractOpts
+		want  bool
+	}{
+		{"outside every group", "lib.vira", ExtractOpts{}, true},
+		{"default group", "docs/guide.md", ExtractOpts{}, true},
+		{"default group excluded", "docs/guide.md", ExtractOpts{Without: map[string]bool{"docs": true}}, false},
+		{"group directory itself excluded", "docs", ExtractOpts{Without: map[string]bool{"docs": true}}, false},
+		{"name sharing a prefix is not in the group", "docsgen.vira", ExtractOpts{Without: map[string]bool{"docs": true}}, true},
+		{"optional group skipped by default", "examples/hello.vira", ExtractOpts{}, false},
+		{"optional group included", "examples/hello.vira", ExtractOpts{With: map[string]bool{"examples": true}}, true},
+		{"other group included", "examples/hello.vira", ExtractOpts{With: map[string]bool{"docs": true}}, false},
+		{"pattern match", "testdata/big.bin", ExtractOpts{}, false},
+		{"pattern match included", "testdata/big.bin", ExtractOpts{With: map[string]bool{"fixtures": true}}, true},
+		{"pattern miss", "testdata/small.txt", ExtractOpts{}, true},
+		{"excluded group outside the entry", "lib.vira", ExtractOpts{Without: map[string]bool{"docs": true}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldExtractEntry(tt.entry, groups, tt.opts); got != tt.want {
+				t.Errorf("shouldExtractEntry(%q, %+v) = %v, want %v", tt.entry, tt.opts, got, tt.want)
+			}
+		})
+	}
+	if !shouldExtractEntry("docs/guide.md", nil, ExtractOpts{Without: map[string]bool{"docs": true}}) {
+		t.Error("a package without groups had an entry skipped")
+	}
+}
+
+func TestShouldExtractEntryOverlappingGroups(t *testing.T) {
+	// An entry in two groups is kept only if neither leaves it out.
+	groups := map[string]AssetGroup{
+		"docs":     {Paths: []string{"docs"}},
+		"examples": {Paths: []string{"docs/examples"}, Optional: true},
+	}
+	entry := "docs/examples/hello.vira"
+	if shouldExtractEntry(entry, groups, ExtractOpts{}) {
+		t.Error("entry of an optional group was kept because another group holds it too")
+	}
+	if !shouldExtractEntry(entry, groups, ExtractOpts{With: map[string]bool{"examples": true}}) {
+		t.Error("entry was skipped with both of its groups selected")
+	}
+	if shouldExtractEntry(entry, groups, ExtractOpts{With: map[string]bool{"examples": true}, Without: map[string]bool{"docs": true}}) {
+		t.Error("entry was kept with one of its groups excluded")
+	}
+}
+
+func TestParseGroupSelection(t *testing.T) {
+	opts, err := parseGroupSelection("examples, fixtures", "docs,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.With["examples"] || !opts.With["fixtures"] || len(opts.With) != 2 {
+		t.Errorf("With = %v, want examples and fixtures", opts.With)
+	}
+	if !opts.Without["docs"] || len(opts.Without) != 1 {
+		t.Errorf("Without = %v, want docs", opts.Without)
+	}
+	if _, err := parseGroupSelection("docs", "docs"); err == nil || !strings.Contains(err.Error(), "both --with and --without") {
+		t.Errorf("a group in both lists gave %v", err)
+	}
+}
+
+func TestExtractTarSkipsGroups(t *testing.T) {
+	entries := []tarEntry{
+		{name: "lib.vira", body: "x"},
+		{name: "docs/guide.md", body: "g"},
+		{name: "examples/hello.vira", body: "h"},
+	}
+	groups := map[string]AssetGroup{
+		"docs":     {Paths: []string{"docs"}},
+		"examples": {Paths: []string{"examples"}, Optional: true},
+	}
+	tests := []struct {
+		name string
+		opts ExtractOpts
+		want []string
+	}{
+		{"default", ExtractOpts{}, []string{"docs/guide.md", "lib.vira"}},
+		{"with examples", ExtractOpts{With: map[string]bool{"examples": true}}, []string{"docs/guide.md", "examples/hello.vira", "lib.vira"}},
+		{"without docs", ExtractOpts{Without: map[string]bool{"docs": true}}, []string{"lib.vira"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testHome(t)
+			extractGroups = tt.opts
+			defer func() { extractGroups = ExtractOpts{} }()
+			dest := t.TempDir()
+			if err := extractTar(bytes.NewReader(makeTar(t, entries)), "math", dest, 0, nil, groups); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for f := range listTree(t, dest) {
+				got = append(got, f)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("extracted %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Skipped entries still make a package that is not empty.
+	testHome(t)
+	extractGroups = ExtractOpts{Without: map[string]bool{"docs": true}}
+	defer func() { extractGroups = ExtractOpts{} }()
+	onlyDocs := makeTar(t, []tarEntry{{name: "docs/guide.md", body: "g"}})
+	if err := extractTar(bytes.NewReader(onlyDocs), "math", t.TempDir(), 0, nil, groups); err != nil {
+		t.Errorf("archive of excluded docs only: %v", err)
+	}
+}
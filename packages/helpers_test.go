@@ -0,0 +1,185 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testHome points HOME at an empty directory, so config, overrides and
+// caches start out empty.
+func testHome(t testing.TB) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	return dir
+}
+
+// tarEntry is one entry of an archive built by makeTar. Regular files are
+// the default type.
+type tarEntry struct {
+	name string
+	body string
+	mode int64
+	typ  byte
+	link string
+}
+
+func makeTar(t testing.TB, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: e.mode, Typeflag: e.typ, Linkname: e.link}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.body))
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			// As written by git archive, which records the commit.
+			hdr = &tar.Header{Typeflag: e.typ, PAXRecords: map[string]string{"comment": e.body}}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipBytes(t testing.TB, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// captureStdout returns what f prints to stdout.
+func captureStdout(t testing.TB, f func() error) (string, error) {
+	t.Helper()
+	return capture(t, &os.Stdout, f)
+}
+
+// captureStderr returns what f prints to stderr.
+func captureStderr(t testing.TB, f func() error) (string, error) {
+	t.Helper()
+	return capture(t, &os.Stderr, f)
+}
+
+func capture(t testing.TB, file **os.File, f func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *file
+	*file = w
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	ferr := f()
+	*file = saved
+	w.Close()
+	return string(<-done), ferr
+}
+
+// writeCachedIndex stores index as the cached registry index below home.
+func writeCachedIndex(t testing.TB, home string, index Index) {
+	t.Helper()
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(home, ".vira", "cache", "index.json")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testRegistry serves files by name as the registry until the test ends
+// and counts the requests for each.
+type testRegistry struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	requests map[string]int
+	// fail makes requests for these files fail with a server error.
+	fail map[string]bool
+}
+
+func newTestRegistry(t testing.TB, files map[string][]byte) *testRegistry {
+	t.Helper()
+	reg := &testRegistry{files: files, requests: map[string]int{}, fail: map[string]bool{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		reg.mu.Lock()
+		reg.requests[name]++
+		data, ok := reg.files[name]
+		fail := reg.fail[name]
+		reg.mu.Unlock()
+		switch {
+		case fail:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case !ok:
+			http.NotFound(w, r)
+		default:
+			w.Write(data)
+		}
+	}))
+	t.Cleanup(server.Close)
+	useClient(t, server.Client())
+	registryOverride = server.URL + "/"
+	t.Cleanup(func() { registryOverride = "" })
+	return reg
+}
+
+func (reg *testRegistry) count(name string) int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.requests[name]
+}
+
+// quietWarnings collects warnings from an empty list without printing
+// them, as a --json command does, until the test ends.
+func quietWarnings(t testing.TB) {
+	warningsMu.Lock()
+	saved := warnings
+	warnings = nil
+	warningsMu.Unlock()
+	warningsQuiet = true
+	t.Cleanup(func() {
+		warningsMu.Lock()
+		warnings = saved
+		warningsMu.Unlock()
+		warningsQuiet = false
+	})
+}
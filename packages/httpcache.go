@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tarballCache is what a registry's caching headers said about a
+// downloaded archive, kept in .etags next to it so a later download can
+// revalidate it instead of transferring it again. Records of archives
+// that are gone, or that were downloaded from another URL, are ignored.
+type tarballCache struct {
+	URL     string    `json:"url"`
+	ETag    string    `json:"etag,omitempty"`
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+func tarballCachePath(filePath string) string {
+	return filepath.Join(filepath.Dir(filePath), ".etags", filepath.Base(filePath)+".json")
+}
+
+// readTarballCache returns the caching record of the archive at filePath,
+// if both exist and the archive was downloaded from url.
+func readTarballCache(filePath string, url string) (*tarballCache, bool) {
+	if _, err := os.Stat(filePath); err != nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(tarballCachePath(filePath))
+	if err != nil {
+		return nil, false
+	}
+	var c tarballCache
+	if json.Unmarshal(data, &c) != nil || c.URL != url {
+		return nil, false
+	}
+	return &c, true
+}
+
+// fresh reports whether Cache-Control allows using the archive without
+// asking the registry.
+func (c *tarballCache) fresh() bool {
+	return !c.Expires.IsZero() && time.Now().Before(c.Expires)
+}
+
+// saveTarballCache records the caching headers of the response from url
+// for the archive at filePath. Responses marked no-store, or with nothing
+// to revalidate against, leave no record.
+func saveTarballCache(filePath string, url string, h http.Header) {
+	c := tarballCache{URL: url, ETag: h.Get("ETag")}
+	directives := map[string]string{}
+	for _, d := range strings.Split(h.Get("Cache-Control"), ",") {
+		key, value, _ := strings.Cut(strings.ToLower(strings.TrimSpace(d)), "=")
+		directives[key] = value
+	}
+	_, noStore := directives["no-store"]
+	if _, noCache := directives["no-cache"]; !noCache {
+		if secs, err := strconv.Atoi(directives["max-age"]); err == nil && secs > 0 {
+			c.Expires = time.Now().Add(time.Duration(secs) * time.Second)
+		}
+	}
+	if noStore || (c.ETag == "" && c.Expires.IsZero()) {
+		os.Remove(tarballCachePath(filePath))
+		return
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	// The record only saves a transfer; failing to write it is harmless.
+	os.MkdirAll(filepath.Dir(tarballCachePath(filePath)), 0755)
+	writeFileAtomic(tarballCachePath(filePath), data, 0644)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// etagServer serves a fixed archive under any path with an ETag and the
+// given Cache-Control, answering 304 to a matching If-None-Match, and
+// counts full transfers and revalidations.
+func etagServer(t *testing.T, body []byte, cacheControl string) (*httptest.Server, func() (int, int)) {
+	t.Helper()
+	var mu sync.Mutex
+	var full, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	useClient(t, server.Client())
+	return server, func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return full, notModified
+	}
+}
+
+func TestDownloadRevalidatesWithETag(t *testing.T) {
+	testHome(t)
+	noProgress = true
+	defer func() { noProgress = false }()
+	body := gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.0.0"}}))
+	server, counts := etagServer(t, body, "")
+	filePath := filepath.Join(t.TempDir(), "math.tar.gz")
+	url := server.URL + "/math.tar.gz"
+
+	first, err := downloadFile(t.Context(), url, filePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := downloadFile(t.Context(), url, filePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full, notModified := counts(); full != 1 || notModified != 1 {
+		t.Errorf("%d full transfers and %d revalidations, want 1 and 1", full, notModified)
+	}
+	if second != first {
+		t.Errorf("integrity after 304 is %s, want %s", second, first)
+	}
+	if got, _ := os.ReadFile(filePath); string(got) != string(body) {
+		t.Error("cached archive changed across the 304")
+	}
+
+	// The record is for the other URL, so this download starts afresh.
+	if _, err := downloadFile(t.Context(), server.URL+"/mirror/math.tar.gz", filePath, false); err != nil {
+		t.Fatal(err)
+	}
+	if full, notModified := counts(); full != 2 || notModified != 1 {
+		t.Errorf("after a URL change, %d full transfers and %d revalidations, want 2 and 1", full, notModified)
+	}
+}
+
+func TestDownloadSkipsFreshArchive(t *testing.T) {
+	testHome(t)
+	noProgress = true
+	defer func() { noProgress = false }()
+	body := gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.0.0"}}))
+	server, counts := etagServer(t, body, "max-age=3600")
+	filePath := filepath.Join(t.TempDir(), "math.tar.gz")
+	for range 2 {
+		if _, err := downloadFile(t.Context(), server.URL+"/math.tar.gz", filePath, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if full, notModified := counts(); full != 1 || notModified != 0 {
+		t.Errorf("%d full transfers and %d revalidations, want 1 and 0", full, notModified)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Index is the registry's package catalogue, cached in ~/.vira/cache.
+type Index struct {
+	Packages map[string]IndexPackage `json:"packages"`
+
+	// Set for sharded indexes, whose Packages fill in as shards load.
+	shards *ShardMeta
+	loaded map[string]bool
+}
+
+type IndexPackage struct {
+	Description string                  `json:"description,omitempty"`
+	Latest      string                  `json:"latest,omitempty"`
+	Versions    map[string]IndexVersion `json:"versions"`
+	Downloads   int64                   `json:"downloads,omitempty"`
+	Updated     time.Time               `json:"updated,omitzero"`
+	// Channels maps names such as stable, beta or nightly to the version
+	// they currently point at.
+	Channels map[string]string `json:"channels,omitempty"`
+	// Replaces lists former names of the package, which resolve to it.
+	Replaces []string `json:"replaces,omitempty"`
+}
+
+type IndexVersion struct {
+	URL                  string                `json:"url,omitempty"`
+	Integrity            string                `json:"integrity,omitempty"`
+	Dependencies         map[string]string     `json:"dependencies,omitempty"`
+	OptionalDependencies map[string]string     `json:"optionalDependencies,omitempty"`
+	PeerDependencies     map[string]string     `json:"peerDependencies,omitempty"`
+	Formats              []string              `json:"formats,omitempty"`
+	Bin                  map[string]string     `json:"bin,omitempty"`
+	Scripts              map[string]string     `json:"scripts,omitempty"`
+	Engines              map[string]string     `json:"engines,omitempty"`
+	Groups               map[string]AssetGroup `json:"groups,omitempty"`
+	Yanked               bool                  `json:"yanked,omitempty"`
+	Deprecated           string                `json:"deprecated,omitempty"`
+	Size                 int64                 `json:"size,omitempty"`
+	InstalledSize        int64                 `json:"installedSize,omitempty"`
+}
+
+func indexPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".vira", "cache", "index.json")
+}
+
+// validateIndex checks that data is a well-formed index: every package has
+// at least one version, "latest" and channels name one of them and
+// integrity strings carry an algorithm prefix.
+func validateIndex(data []byte) error {
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return fmt.Errorf("invalid index: %v", err)
+	}
+	if index.Packages == nil {
+		return fmt.Errorf("invalid index: missing packages")
+	}
+	for name, pkg := range index.Packages {
+		if name == "" {
+			return fmt.Errorf("invalid index: package with empty name")
+		}
+		if len(pkg.Versions) == 0 {
+			return fmt.Errorf("invalid index: %s has no versions", name)
+		}
+		if _, ok := pkg.Versions[pkg.Latest]; pkg.Latest != "" && !ok {
+			return fmt.Errorf("invalid index: %s latest %s is not a known version", name, pkg.Latest)
+		}
+		for channel, version := range pkg.Channels {
+			if _, ok := pkg.Versions[version]; !ok {
+				return fmt.Errorf("invalid index: %s channel %s points at unknown version %s", name, channel, version)
+			}
+		}
+		for version, v := range pkg.Versions {
+			if v.Integrity != "" && !strings.Contains(v.Integrity, "-") {
+				return fmt.Errorf("invalid index: %s@%s has malformed integrity %q", name, version, v.Integrity)
+			}
+		}
+	}
+	return nil
+}
+
+// verifyIndexSignature checks an ed25519 signature of the index against the
+// base64 public key in VIRA_INDEX_KEY. Without a key there is nothing to
+// verify against and the signature is ignored.
+func verifyIndexSignature(data []byte, sig []byte) error {
+	key := os.Getenv("VIRA_INDEX_KEY")
+	if key == "" {
+		return nil
+	}
+	pub, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("VIRA_INDEX_KEY is not a valid ed25519 public key")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return fmt.Errorf("malformed index signature: %v", err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pub), data, raw) {
+		return fmt.Errorf("index signature does not match")
+	}
+	return nil
+}
+
+func indexURL() string {
+	return registryURL() + "index.json"
+}
+
+// maxIndexSize bounds a decompressed index, so a hostile registry cannot
+// fill memory with a small archive.
+const maxIndexSize = 512 << 20
+
+var errNoGzipIndex = errors.New("registry has no gzipped index")
+
+// fetchGzipIndex downloads index.json.gz, checks it against the integrity
+// string published as index.json.gz.integrity and decompresses it. The
+// checksum is required: a gzipped index without one is rejected rather
+// than trusted.
+func fetchGzipIndex(ctx context.Context) ([]byte, error) {
+	compressed, status, err := fetchURL(ctx, indexURL()+".gz")
+	if status == http.StatusNotFound {
+		return nil, errNoGzipIndex
+	}
+	if err != nil {
+		return nil, err
+	}
+	integrity, status, err := fetchURL(ctx, indexURL()+".gz.integrity")
+	if status == http.StatusNotFound {
+		return nil, fmt.Errorf("index.json.gz has no published checksum (index.json.gz.integrity)")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyDataIntegrity(compressed, strings.TrimSpace(string(integrity))); err != nil {
+		return nil, fmt.Errorf("index.json.gz: %v", err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("index.json.gz: %v", err)
+	}
+	defer gz.Close()
+	data, err := io.ReadAll(io.LimitReader(gz, maxIndexSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("index.json.gz: %v", err)
+	}
+	if len(data) > maxIndexSize {
+		return nil, fmt.Errorf("index.json.gz: decompressed index exceeds %s", formatBytes(maxIndexSize))
+	}
+	return data, nil
+}
+
+// verifyDataIntegrity is verifyChecksum for bytes in memory.
+func verifyDataIntegrity(data []byte, integrity string) error {
+	return verifyReader(bytes.NewReader(data), integrity)
+}
+
+func fetchURL(ctx context.Context, url string) ([]byte, int, error) {
+	req, err := newRequest(ctx, "GET", url)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		drainBody(resp)
+		return nil, resp.StatusCode, fmt.Errorf("failed to download: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	return data, resp.StatusCode, err
+}
+
+// fetchIndex downloads and validates the registry index, checking its
+// signature when the registry publishes one. The gzipped index is
+// preferred when the registry has it.
+func fetchIndex(ctx context.Context) ([]byte, error) {
+	defer stopwatch.phase("refresh")()
+	data, err := fetchGzipIndex(ctx)
+	if errors.Is(err, errNoGzipIndex) {
+		data, _, err = fetchURL(ctx, indexURL())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := validateIndex(data); err != nil {
+		return nil, err
+	}
+	sig, status, err := fetchURL(ctx, indexURL()+".sig")
+	if err != nil && status != http.StatusNotFound {
+		return nil, err
+	}
+	if err == nil {
+		if err := verifyIndexSignature(data, sig); err != nil {
+			return nil, err
+		}
+	} else if os.Getenv("VIRA_INDEX_KEY") != "" {
+		warn(codeUnsignedIndex, "", "the registry publishes no index signature, VIRA_INDEX_KEY was not checked")
+	}
+	return data, nil
+}
+
+// indexFile identifies the file an index was parsed from, so the parsed
+// copy is reused until a refresh or another registry replaces it.
+type indexFile struct {
+	path string
+	size int64
+	mod  time.Time
+}
+
+func statIndexFile(path string) (indexFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return indexFile{}, err
+	}
+	return indexFile{path, info.Size(), info.ModTime()}, nil
+}
+
+var (
+	indexMu     sync.Mutex
+	cachedIndex *Index
+	cachedFrom  indexFile
+)
+
+// loadIndex returns the cached index written by refresh, or the bundle's
+// index when installing from a local directory. It is read, validated
+// and parsed once per command and shared afterwards; callers must not
+// modify it.
+func loadIndex() (*Index, error) {
+	path := indexPath()
+	sharded := false
+	if localRegistry != "" {
+		path = filepath.Join(localRegistry, "index.json")
+	} else if _, err := os.Stat(filepath.Join(shardDir(), "shards.json")); err == nil {
+		path, sharded = filepath.Join(shardDir(), "shards.json"), true
+	}
+	from, err := statIndexFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no cached index, run refresh first")
+	}
+	if err != nil {
+		return nil, err
+	}
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if cachedIndex != nil && cachedFrom == from {
+		return cachedIndex, nil
+	}
+	index, err := readIndexFile(path, sharded)
+	if err != nil {
+		return nil, err
+	}
+	cachedIndex, cachedFrom = index, from
+	return index, nil
+}
+
+func readIndexFile(path string, sharded bool) (*Index, error) {
+	if sharded {
+		meta, err := loadShardMeta()
+		if err != nil {
+			return nil, err
+		}
+		return &Index{Packages: map[string]IndexPackage{}, shards: meta, loaded: map[string]bool{}}, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no cached index, run refresh first")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := validateIndex(data); err != nil {
+		return nil, fmt.Errorf("cached index is corrupt, run refresh: %v", err)
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+// indexVersion returns the index metadata of the version of pkgName
+// (name or name@version) an install would pick.
+func indexVersion(pkgName string) (IndexVersion, bool) {
+	index, err := loadIndex()
+	if err != nil {
+		return IndexVersion{}, false
+	}
+	name, version := splitSpec(pkgName)
+	pkg, ok := index.lookup(name)
+	if !ok {
+		return IndexVersion{}, false
+	}
+	meta, ok := pkg.Versions[pickVersion(pkg, version)]
+	return meta, ok
+}
+
+// indexIntegrity returns the integrity the cached index publishes for
+// pkgName, if any.
+func indexIntegrity(pkgName string) string {
+	meta, _ := indexVersion(pkgName)
+	return meta.Integrity
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadIndexIsReused(t *testing.T) {
+	home := testHome(t)
+	path := filepath.Join(home, ".vira", "cache", "index.json")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	write := func(latest string, mod time.Time) {
+		data := `{"packages": {"math": {"latest": "` + latest + `", "versions": {"` + latest + `": {}}}}}`
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mod, mod)
+	}
+	write("1.0.0", time.Now().Add(-time.Hour))
+
+	first, err := loadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := loadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != again {
+		t.Error("unchanged index was parsed again")
+	}
+
+	write("1.1.0", time.Now())
+	refreshed, err := loadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refreshed.Packages["math"].Latest; got != "1.1.0" {
+		t.Errorf("after refresh latest is %s, want 1.1.0", got)
+	}
+}
+
+func TestRefreshVerifiesIndex(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := base64.StdEncoding.EncodeToString(pub)
+	fresh, _ := json.Marshal(Index{Packages: map[string]IndexPackage{
+		"math": {Latest: "2.0.0", Versions: map[string]IndexVersion{"2.0.0": {}}},
+	}})
+	tampered := []byte(strings.ReplaceAll(string(fresh), "2.0.0", "6.6.6"))
+	sign := func(data []byte) []byte {
+		return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data)) + "\n")
+	}
+	integrity := func(data []byte) []byte {
+		sum := sha256.Sum256(data)
+		return []byte("sha256-" + hex.EncodeToString(sum[:]) + "\n")
+	}
+	gz := gzipBytes(t, fresh)
+	tamperedGz := gzipBytes(t, tampered)
+	tests := []struct {
+		name    string
+		files   map[string][]byte
+		key     string
+		wantErr string
+		warned  bool
+	}{
+		{"plain index", map[string][]byte{"index.json": fresh}, "", "", false},
+		{"gzipped index", map[string][]byte{"index.json.gz": gz, "index.json.gz.integrity": integrity(gz)}, "", "", false},
+		{"gzipped and signed index", map[string][]byte{
+			"index.json.gz": gz, "index.json.gz.integrity": integrity(gz), "index.json.sig": sign(fresh),
+		}, key, "", false},
+		{"signature without a key to check it", map[string][]byte{
+			"index.json.gz": gz, "index.json.gz.integrity": integrity(gz), "index.json.sig": []byte("garbage"),
+		}, "", "", false},
+		{"key without a signature", map[string][]byte{"index.json.gz": gz, "index.json.gz.integrity": integrity(gz)}, key, "", true},
+		{"gzipped index without a checksum", map[string][]byte{"index.json.gz": gz}, "", "has no published checksum", false},
+		{"tampered gzipped index", map[string][]byte{"index.json.gz": tamperedGz, "index.json.gz.integrity": integrity(gz)}, "", "index.json.gz:", false},
+		// A checksum published alongside proves nothing against a
+		// registry that was tampered with; the signature does.
+		{"tampered index with a fresh checksum", map[string][]byte{
+			"index.json.gz": tamperedGz, "index.json.gz.integrity": integrity(tamperedGz), "index.json.sig": sign(fresh),
+		}, key, "index signature does not match", false},
+		{"tampered plain index", map[string][]byte{"index.json": tampered, "index.json.sig": sign(fresh)}, key, "index signature does not match", false},
+		{"malformed signature", map[string][]byte{"index.json": fresh, "index.json.sig": []byte("not base64!")}, key, "malformed index signature", false},
+		{"gzipped garbage", map[string][]byte{"index.json.gz": []byte("plain"), "index.json.gz.integrity": integrity([]byte("plain"))}, "", "index.json.gz:", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := testHome(t)
+			quietWarnings(t)
+			t.Setenv("VIRA_INDEX_KEY", tt.key)
+			writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+				"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+			}})
+			reg := newTestRegistry(t, tt.files)
+			_, err := captureStdout(t, func() error { return refresh(t.Context(), false, true) })
+
+			index, lerr := loadIndex()
+			if lerr != nil {
+				t.Fatal(lerr)
+			}
+			latest := index.Packages["math"].Latest
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				if latest != "1.0.0" {
+					t.Errorf("a rejected index replaced the cache: math latest is %s", latest)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if latest != "2.0.0" {
+				t.Errorf("cached math latest is %s, want 2.0.0", latest)
+			}
+			if _, ok := tt.files["index.json.gz"]; ok && reg.count("index.json") != 0 {
+				t.Error("index.json was fetched though the gzipped index was available")
+			}
+			var warned bool
+			for _, w := range collectedWarnings() {
+				warned = warned || w.Code == codeUnsignedIndex
+			}
+			if warned != tt.warned {
+				t.Errorf("unsigned index warning: %v, want %v", warned, tt.warned)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// installedFile is written into each package directory after a
+// successful install.
+const installedFile = ".installed.json"
+
+// InstalledMeta records what was installed into a package directory, so
+// installing the same version again can be skipped.
+type InstalledMeta struct {
+	Version   string `json:"version,omitempty"`
+	URL       string `json:"url"`
+	Integrity string `json:"integrity,omitempty"`
+	// Channel is set when the package was installed as name@channel, so
+	// update can follow the channel.
+	Channel string `json:"channel,omitempty"`
+}
+
+func readInstalledMeta(pkgDir string) (*InstalledMeta, error) {
+	data, err := os.ReadFile(filepath.Join(pkgDir, installedFile))
+	if err != nil {
+		return nil, err
+	}
+	var meta InstalledMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func writeInstalledMeta(pkgDir string, meta InstalledMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(pkgDir, installedFile), data, 0644)
+}
+
+// Package is a package as an install resolved it: its name, the version
+// picked from the cached index ("" when the index does not list it) and
+// the archive downloaded for it.
+type Package struct {
+	Name    string
+	Version string
+	Archive string
+}
+
+// resolvedPackage describes pkgName (name or name@version) downloaded to
+// archive.
+func resolvedPackage(pkgName string, archive string) Package {
+	name, _ := splitSpec(pkgName)
+	return Package{Name: name, Version: pickedVersion(pkgName), Archive: archive}
+}
+
+// pickedVersion is the version of pkgName (name or name@version) an
+// install would pick from the cached index, or "" without one.
+func pickedVersion(pkgName string) string {
+	index, err := loadIndex()
+	if err != nil {
+		return ""
+	}
+	name, version := splitSpec(pkgName)
+	pkg, ok := index.lookup(name)
+	if !ok {
+		return ""
+	}
+	return pickVersion(pkg, version)
+}
+
+// upToDate reports whether destDir already holds the version of pkgName an
+// install would fetch, with the checksum recorded in the lockfile (when
+// lock is set) or published by the index, and the one pinned in bytes.yml.
+// Without a version or checksum to compare against, nothing counts as up
+// to date.
+func upToDate(pkgName string, destDir string, lock *Lock) (*InstalledMeta, bool) {
+	if _, ok := overrideFor(pkgName); ok {
+		return nil, false
+	}
+	meta, err := readInstalledMeta(filepath.Join(destDir, pkgName))
+	if err != nil {
+		return nil, false
+	}
+	var expected string
+	if lock != nil {
+		entry := lock.Packages[pkgName]
+		if entry == nil {
+			return nil, false
+		}
+		locked, ok := entry.resolved(currentPlatform())
+		if !ok {
+			return nil, false
+		}
+		expected = locked.Integrity
+	} else {
+		expected = indexIntegrity(pkgName)
+	}
+	pinned, isPinned := pinnedIntegrity(pkgName)
+	version := pickedVersion(pkgName)
+	if version == "" && expected == "" && !isPinned {
+		return nil, false
+	}
+	if version != "" && meta.Version != version {
+		return nil, false
+	}
+	for _, integrity := range []string{expected, pinned} {
+		if integrity != "" && !installedMatches(meta, pkgName, destDir, integrity) {
+			return nil, false
+		}
+	}
+	return meta, true
+}
+
+// installedMatches reports whether the install of pkgName in destDir has
+// the checksum expected, checking the archive kept beside it when meta
+// records a digest in another algorithm.
+func installedMatches(meta *InstalledMeta, pkgName string, destDir string, expected string) bool {
+	if sameIntegrity(meta.Integrity, expected) {
+		return true
+	}
+	// The same archive may have been hashed with another algorithm.
+	algo, _, _ := strings.Cut(expected, "-")
+	if strings.HasPrefix(meta.Integrity, algo+"-") {
+		return false
+	}
+	archives, _ := filepath.Glob(filepath.Join(destDir, pkgName+".tar.*"))
+	return len(archives) == 1 && verifyChecksum(archives[0], expected) == nil
+}
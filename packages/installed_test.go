@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpToDateChecksPinnedIntegrity(t *testing.T) {
+	archive := gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.0.0"}}))
+	sum256 := sha256.Sum256(archive)
+	sum512 := sha512.Sum512(archive)
+	integrity := "sha256-" + hex.EncodeToString(sum256[:])
+	tests := []struct {
+		name   string
+		pinned string
+		want   bool
+	}{
+		{"nothing pinned", "", true},
+		{"pin matches the install", integrity, true},
+		{"pin in another algorithm matches the archive", "sha512-" + base64.StdEncoding.EncodeToString(sum512[:]), true},
+		{"pin added after install differs", "sha256-" + strings.Repeat("0", 64), false},
+		{"pin in another algorithm differs", "sha512-" + base64.StdEncoding.EncodeToString(make([]byte, sha512.Size)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := testHome(t)
+			writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+				"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Integrity: integrity}}},
+			}})
+			destDir := t.TempDir()
+			os.MkdirAll(filepath.Join(destDir, "math"), 0755)
+			os.WriteFile(filepath.Join(destDir, "math.tar.gz"), archive, 0644)
+			if err := writeInstalledMeta(filepath.Join(destDir, "math"), InstalledMeta{Version: "1.0.0", URL: "math.tar.gz", Integrity: integrity}); err != nil {
+				t.Fatal(err)
+			}
+			pinnedManifest = &Manifest{Integrity: map[string]string{}}
+			if tt.pinned != "" {
+				pinnedManifest.Integrity["math"] = tt.pinned
+			}
+			defer func() { pinnedManifest = nil }()
+			lock := &Lock{Packages: map[string]*LockEntry{"math": {Version: "1.0.0", URL: "math.tar.gz", Integrity: integrity}}}
+
+			for _, l := range []*Lock{lock, nil} {
+				if _, got := upToDate("math", destDir, l); got != tt.want {
+					t.Errorf("upToDate with lock %v = %v, want %v", l != nil, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReinstallMakesNoRequest(t *testing.T) {
+	home := testHome(t)
+	noProgress = true
+	defer func() { noProgress = false }()
+	archive := gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.0.0"}}))
+	sum := sha256.Sum256(archive)
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Integrity: "sha256-" + hex.EncodeToString(sum[:])}}},
+	}})
+	reg := newTestRegistry(t, map[string][]byte{"math.tar.gz": archive})
+	requests := func() int {
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+		n := 0
+		for _, c := range reg.requests {
+			n += c
+		}
+		return n
+	}
+	prefix := t.TempDir()
+	opts := InstallOptions{Prefix: prefix, MaxDepth: 8, NoScripts: true}
+	if _, err := captureStdout(t, func() error { return install(t.Context(), "math", opts) }); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := globalLibsDir(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Extracting again would replace the directory and drop this file.
+	marker := filepath.Join(dir, "math", "marker")
+	os.WriteFile(marker, nil, 0644)
+
+	out, err := captureStdout(t, func() error { return install(t.Context(), "math", opts) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := requests(); n != 1 {
+		t.Errorf("%d requests over both installs, want 1", n)
+	}
+	if !strings.Contains(out, "math@1.0.0 already installed") {
+		t.Errorf("output %q does not report math as installed", out)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("second install extracted math again: %v", err)
+	}
+
+	opts.Force = true
+	if _, err := captureStdout(t, func() error { return install(t.Context(), "math", opts) }); err != nil {
+		t.Fatal(err)
+	}
+	if n := reg.count("math.tar.gz"); n != 2 {
+		t.Errorf("with --force, math.tar.gz requested %d times in all, want twice", n)
+	}
+}
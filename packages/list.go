@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ListOptions are the flags accepted by list.
+type ListOptions struct {
+	InProject bool
+	Tree      bool
+	Depth     int
+	// Outdated lists packages with newer versions instead; Fix then
+	// updates them within their constraints.
+	Outdated bool
+	Fix      bool
+}
+
+// installedPackage describes one package found in a libs directory.
+type installedPackage struct {
+	dir     string
+	name    string
+	version string
+}
+
+func findInstalled(dir string, name string) (installedPackage, bool) {
+	installed, _ := listInstalled(dir)
+	for _, full := range installed {
+		if n, _ := splitSpec(full); n == name {
+			return readInstalled(dir, full), true
+		}
+	}
+	return installedPackage{dir: dir, name: name}, false
+}
+
+// readInstalled takes the version from a pinned name@version directory,
+// the install record or the bytes.yml shipped inside the package.
+func readInstalled(dir string, full string) installedPackage {
+	name, version := splitSpec(full)
+	if version == "" {
+		if meta, err := readInstalledMeta(filepath.Join(dir, full)); err == nil {
+			version = meta.Version
+		}
+	}
+	if version == "" {
+		if m, err := loadManifest(filepath.Join(dir, full, manifestFile)); err == nil {
+			version = m.Version
+		}
+	}
+	return installedPackage{dir: dir, name: name, version: version}
+}
+
+// label is how a package is shown by both the flat and the tree view.
+func (p installedPackage) label(installed bool) string {
+	s := p.name
+	if p.version != "" {
+		s += "@" + p.version
+	}
+	if target, ok := overrideFor(p.name); ok {
+		s += " (override: " + target + ")"
+	}
+	if !installed {
+		s += " (missing)"
+	}
+	return s
+}
+
+// dependencies returns the direct dependencies of an installed package,
+// taken from its override's bytes.yml or from the cached index.
+func (p installedPackage) dependencies(index *Index) []string {
+	if target, ok := overrideFor(p.name); ok && !isOverrideURL(target) {
+		return slices.Sorted(maps.Keys(overrideDependencies(target)))
+	}
+	if index == nil {
+		return nil
+	}
+	pkg, ok := index.lookup(p.name)
+	if !ok {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(pkg.Versions[pickVersion(pkg, p.version)].Dependencies))
+}
+
+// listPackages prints the installed packages. The flat view shows every
+// package; the tree view starts from the top-level packages (the project's
+// dependencies, or globally those nothing else depends on) and nests their
+// dependencies down to opts.Depth levels.
+func listPackages(ctx context.Context, opts ListOptions) error {
+	dir := os.Getenv("HOME") + "/.vira/libs"
+	if opts.InProject {
+		dir = filepath.Join("build", "dependencies")
+	}
+	if opts.Outdated {
+		return listOutdated(ctx, dir, opts)
+	}
+	installed, err := listInstalled(dir)
+	if err != nil {
+		return err
+	}
+	slices.Sort(installed)
+	if !opts.Tree {
+		for _, full := range installed {
+			fmt.Println(readInstalled(dir, full).label(true))
+		}
+		return nil
+	}
+
+	// Without a cached index only overrides contribute dependencies.
+	index, _ := loadIndex()
+	for _, root := range listRoots(dir, installed, index, opts.InProject) {
+		p, ok := findInstalled(dir, root)
+		fmt.Println(p.label(ok))
+		if ok {
+			printDependencies(p, index, "", opts.Depth, map[string]bool{root: true})
+		}
+	}
+	return nil
+}
+
+func listRoots(dir string, installed []string, index *Index, inProject bool) []string {
+	if inProject {
+		if m, err := loadManifest(manifestFile); err == nil {
+			deps := maps.Clone(m.Dependencies)
+			maps.Copy(deps, m.DevDependencies)
+			return slices.Sorted(maps.Keys(deps))
+		}
+	}
+	required := map[string]bool{}
+	for _, full := range installed {
+		for _, dep := range readInstalled(dir, full).dependencies(index) {
+			required[dep] = true
+		}
+	}
+	var roots []string
+	for _, full := range installed {
+		if name, _ := splitSpec(full); !required[name] {
+			roots = append(roots, name)
+		}
+	}
+	return roots
+}
+
+// printDependencies renders the dependencies of p below it. path holds the
+// packages on the way down, so cycles end with a "(cycle)" marker.
+func printDependencies(p installedPackage, index *Index, indent string, depth int, path map[string]bool) {
+	if depth <= 0 {
+		return
+	}
+	deps := p.dependencies(index)
+	for i, dep := range deps {
+		branch, next := "├── ", "│   "
+		if i == len(deps)-1 {
+			branch, next = "└── ", "    "
+		}
+		child, ok := findInstalled(p.dir, dep)
+		if path[dep] {
+			fmt.Println(indent + branch + child.label(ok) + " (cycle)")
+			continue
+		}
+		fmt.Println(indent + branch + child.label(ok))
+		if ok {
+			path[dep] = true
+			printDependencies(child, index, indent+next, depth-1, path)
+			delete(path, dep)
+		}
+	}
+}
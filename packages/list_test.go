@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListDepth(t *testing.T) {
+	home := testHome(t)
+	deps := func(names ...string) map[string]string {
+		m := map[string]string{}
+		for _, n := range names {
+			m[n] = "*"
+		}
+		return m
+	}
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"app":  {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Dependencies: deps("math", "json")}}},
+		"math": {Latest: "1.2.0", Versions: map[string]IndexVersion{"1.2.0": {Dependencies: deps("core")}}},
+		"json": {Latest: "0.4.0", Versions: map[string]IndexVersion{"0.4.0": {}}},
+		"core": {Latest: "3.0.0", Versions: map[string]IndexVersion{"3.0.0": {}}},
+		"tool": {Latest: "0.1.0", Versions: map[string]IndexVersion{"0.1.0": {}}},
+	}})
+	libs := filepath.Join(home, ".vira", "libs")
+	for name, version := range map[string]string{"app": "1.0.0", "math": "1.2.0", "json": "0.4.0", "core": "3.0.0", "tool": "0.1.0"} {
+		os.MkdirAll(filepath.Join(libs, name), 0755)
+		if err := writeInstalledMeta(filepath.Join(libs, name), InstalledMeta{Version: version}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name string
+		opts ListOptions
+		want string
+	}{
+		{"flat", ListOptions{}, "app@1.0.0\ncore@3.0.0\njson@0.4.0\nmath@1.2.0\ntool@0.1.0\n"},
+		{"tree depth 0", ListOptions{Tree: true, Depth: 0}, "app@1.0.0\ntool@0.1.0\n"},
+		{"tree depth 1", ListOptions{Tree: true, Depth: 1}, "" +
+			"app@1.0.0\n" +
+			"├── json@0.4.0\n" +
+			"└── math@1.2.0\n" +
+			"tool@0.1.0\n"},
+		{"tree depth 2", ListOptions{Tree: true, Depth: 2}, "" +
+			"app@1.0.0\n" +
+			"├── json@0.4.0\n" +
+			"└── math@1.2.0\n" +
+			"    └── core@3.0.0\n" +
+			"tool@0.1.0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := captureStdout(t, func() error { return listPackages(t.Context(), tt.opts) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != tt.want {
+				t.Errorf("list printed\n%s\nwant\n%s", out, tt.want)
+			}
+		})
+	}
+}
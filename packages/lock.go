@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const lockFile = "bytes.lock"
+
+// PlatformEntry is the resolution of a package for a single os/arch.
+type PlatformEntry struct {
+	URL       string `json:"url"`
+	Integrity string `json:"integrity"`
+}
+
+// LockEntry records how a package was resolved. Packages with per-platform
+// variants keep one entry per os/arch in Platforms instead of URL/Integrity.
+type LockEntry struct {
+	// Version is the version resolved when the entry was recorded; older
+	// lockfiles lack it.
+	Version   string                   `json:"version,omitempty"`
+	URL       string                   `json:"url,omitempty"`
+	Integrity string                   `json:"integrity,omitempty"`
+	Platforms map[string]PlatformEntry `json:"platforms,omitempty"`
+}
+
+type Lock struct {
+	// Environment is the bytes.yml environment the packages were resolved
+	// for with install --env; empty means the base dependencies.
+	Environment string `json:"environment,omitempty"`
+	// NoOptional is set when optional dependencies were left out with
+	// --no-optional.
+	NoOptional bool                  `json:"noOptional,omitempty"`
+	Packages   map[string]*LockEntry `json:"packages"`
+}
+
+// noOptional leaves optional dependencies out of every resolution, for
+// install and ci --no-optional.
+var noOptional bool
+
+// checkLockOptional warns when lock was resolved with a different
+// --no-optional setting than this run uses.
+func checkLockOptional(lock *Lock) {
+	switch {
+	case len(lock.Packages) == 0 || lock.NoOptional == noOptional:
+	case lock.NoOptional:
+		warn(codeLockOptional, "", "%s was resolved without optional dependencies, this run includes them (pass --no-optional to keep them out)", lockFile)
+	default:
+		warn(codeLockOptional, "", "%s was resolved with optional dependencies, this run leaves them out but keeps those already locked", lockFile)
+	}
+}
+
+func currentPlatform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+func readLock(path string) (*Lock, error) {
+	lock := &Lock{Packages: map[string]*LockEntry{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("%s is corrupt (%v), delete it and run install to re-resolve", path, err)
+	}
+	if lock.Packages == nil {
+		lock.Packages = map[string]*LockEntry{}
+	}
+	return lock, nil
+}
+
+func writeLock(path string, lock *Lock) error {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0644)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so an interrupted write never leaves a truncated file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// resolved returns the locked URL and integrity for platform. It reports
+// false when the package has per-platform entries but none for platform,
+// or when nothing has been locked yet.
+func (e *LockEntry) resolved(platform string) (PlatformEntry, bool) {
+	if len(e.Platforms) > 0 {
+		p, ok := e.Platforms[platform]
+		return p, ok
+	}
+	if e.URL == "" {
+		return PlatformEntry{}, false
+	}
+	return PlatformEntry{URL: e.URL, Integrity: e.Integrity}, true
+}
+
+// set records a resolution, keeping entries for other platforms intact.
+func (e *LockEntry) set(platform string, perPlatform bool, p PlatformEntry) {
+	if !perPlatform && len(e.Platforms) == 0 {
+		e.URL, e.Integrity = p.URL, p.Integrity
+		return
+	}
+	if e.Platforms == nil {
+		e.Platforms = map[string]PlatformEntry{}
+	}
+	e.Platforms[platform] = p
+}
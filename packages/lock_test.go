@@ -0,0 +1,245 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadLockLegacyEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lockFile)
+	legacy := `{"packages": {
+  "math": {"url": "https://r/math.tar.gz", "integrity": "sha256-aa"},
+  "io": {"platforms": {"linux/amd64": {"url": "https://r/io-linux.tar.gz", "integrity": "sha256-bb"}}}
+}}`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := readLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		platform string
+		want     PlatformEntry
+		ok       bool
+	}{
+		{"math", "linux/amd64", PlatformEntry{"https://r/math.tar.gz", "sha256-aa"}, true},
+		{"math", "darwin/arm64", PlatformEntry{"https://r/math.tar.gz", "sha256-aa"}, true},
+		{"io", "linux/amd64", PlatformEntry{"https://r/io-linux.tar.gz", "sha256-bb"}, true},
+		{"io", "darwin/arm64", PlatformEntry{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := lock.Packages[tt.name].resolved(tt.platform)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s on %s: resolved() = %v, %v, want %v, %v", tt.name, tt.platform, got, ok, tt.want, tt.ok)
+		}
+	}
+	if lock.Environment != "" || lock.NoOptional {
+		t.Errorf("legacy lock read as environment %q, noOptional %v", lock.Environment, lock.NoOptional)
+	}
+}
+
+func TestReadLockMissingAndCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := readLock(filepath.Join(dir, "missing.lock"))
+	if err != nil || lock.Packages == nil || len(lock.Packages) != 0 {
+		t.Fatalf("missing lockfile: %v, %v", lock, err)
+	}
+	corrupt := filepath.Join(dir, lockFile)
+	os.WriteFile(corrupt, []byte("{"), 0644)
+	if _, err := readLock(corrupt); err == nil {
+		t.Fatal("corrupt lockfile read without an error")
+	}
+}
+
+func TestReadLockTruncatedOrCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.lock")
+	lock := &Lock{Packages: map[string]*LockEntry{
+		"math": {Version: "1.2.0", URL: "https://registry/math.tar.gz", Integrity: "sha256-aa"},
+		"json": {Version: "0.4.0", URL: "https://registry/json.tar.gz", Integrity: "sha256-bb"},
+	}}
+	if err := writeLock(good, lock); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(good)
+	if leftover, _ := filepath.Glob(filepath.Join(dir, ".*.tmp-*")); len(leftover) != 0 {
+		t.Errorf("writeLock left %v behind", leftover)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated to half", data[:len(data)/2]},
+		{"missing the closing brace", data[:len(data)-2]},
+		{"binary garbage", []byte{0x1f, 0x8b, 0x08, 0x00}},
+		{"wrong shape", []byte(`{"packages": ["math"]}`)},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, lockFile)
+		os.WriteFile(path, tt.data, 0644)
+		_, err := readLock(path)
+		if err == nil || !strings.Contains(err.Error(), "is corrupt") || !strings.Contains(err.Error(), "run install to re-resolve") {
+			t.Errorf("%s lockfile: %v, want a corrupt lockfile error telling how to recover", tt.name, err)
+		}
+	}
+}
+
+func TestLockEntrySet(t *testing.T) {
+	a := PlatformEntry{URL: "https://r/a", Integrity: "sha256-aa"}
+	b := PlatformEntry{URL: "https://r/b", Integrity: "sha256-bb"}
+
+	// A shared archive stays a single legacy entry.
+	e := &LockEntry{}
+	e.set("linux/amd64", false, a)
+	if e.URL != a.URL || e.Platforms != nil {
+		t.Fatalf("shared resolution stored as %+v", e)
+	}
+
+	// The first per-platform variant moves the entry to Platforms and
+	// keeps resolutions of other platforms.
+	e = &LockEntry{}
+	e.set("linux/amd64", true, a)
+	e.set("darwin/arm64", true, b)
+	if e.URL != "" || len(e.Platforms) != 2 {
+		t.Fatalf("per-platform resolutions stored as %+v", e)
+	}
+	e.set("linux/amd64", false, b)
+	if got := e.Platforms["linux/amd64"]; got != b {
+		t.Fatalf("linux/amd64 = %v after re-resolving, want %v", got, b)
+	}
+}
+
+func TestInstallWithAndWithoutOptional(t *testing.T) {
+	archive := func(name string) []byte {
+		return gzipBytes(t, makeTar(t, []tarEntry{{name: name + "/lib.vira", body: name}}))
+	}
+	// app needs io and can use zlib, which brings compress along.
+	index := Index{Packages: map[string]IndexPackage{
+		"app": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {
+			Dependencies:         map[string]string{"io": "*"},
+			OptionalDependencies: map[string]string{"zlib": "*"},
+		}}},
+		"io":       {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+		"zlib":     {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Dependencies: map[string]string{"compress": "*"}}}},
+		"compress": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+	}}
+	files := map[string][]byte{}
+	for name := range index.Packages {
+		files[name+".tar.gz"] = archive(name)
+	}
+	tests := []struct {
+		noOptional bool
+		want       []string
+		// What a later ci with the opposite setting warns about; only ci
+		// --no-optional checks a lockfile's setting.
+		wantWarning string
+	}{
+		{false, []string{"app", "compress", "io", "zlib"}, "resolved with optional dependencies, this run leaves them out"},
+		{true, []string{"app", "io"}, ""},
+	}
+	sets := map[bool][]string{}
+	for _, tt := range tests {
+		name := "with optional"
+		if tt.noOptional {
+			name = "without optional"
+		}
+		t.Run(name, func(t *testing.T) {
+			home := testHome(t)
+			noProgress = true
+			defer func() { noProgress, noOptional = false, false }()
+			quietWarnings(t)
+			writeCachedIndex(t, home, index)
+			newTestRegistry(t, files)
+			wd, _ := os.Getwd()
+			if err := os.Chdir(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chdir(wd)
+
+			noOptional = tt.noOptional
+			if _, err := captureStdout(t, func() error {
+				return install(t.Context(), "app", InstallOptions{InProject: true, MaxDepth: defaultMaxDepth, NoScripts: true})
+			}); err != nil {
+				t.Fatal(err)
+			}
+			deps := filepath.Join("build", "dependencies")
+			installed, err := listInstalled(deps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(installed)
+			if !slices.Equal(installed, tt.want) {
+				t.Errorf("installed %v, want %v", installed, tt.want)
+			}
+			lock, err := readLock(lockFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keys := slices.Sorted(maps.Keys(lock.Packages)); !slices.Equal(keys, tt.want) {
+				t.Errorf("locked %v, want %v", keys, tt.want)
+			}
+			if lock.NoOptional != tt.noOptional {
+				t.Errorf("lockfile records noOptional %v, want %v", lock.NoOptional, tt.noOptional)
+			}
+			sets[tt.noOptional] = installed
+
+			// ci installs what was locked, and says so when asked for
+			// the other setting.
+			os.RemoveAll(deps)
+			noOptional = !tt.noOptional
+			if _, err := captureStdout(t, func() error { return ci(t.Context(), 2) }); err != nil {
+				t.Fatal(err)
+			}
+			if installed, _ := listInstalled(deps); !slices.Equal(slices.Sorted(slices.Values(installed)), tt.want) {
+				t.Errorf("ci installed %v, want the locked %v", installed, tt.want)
+			}
+			var warning string
+			for _, w := range collectedWarnings() {
+				if w.Code == codeLockOptional {
+					warning = w.Message
+				}
+			}
+			if (warning == "") != (tt.wantWarning == "") || !strings.Contains(warning, tt.wantWarning) {
+				t.Errorf("ci --no-optional=%v warned %q, want %q", noOptional, warning, tt.wantWarning)
+			}
+		})
+	}
+	if slices.Equal(sets[false], sets[true]) {
+		t.Errorf("installs with and without optional dependencies both resolved %v", sets[false])
+	}
+}
+
+func TestCheckLockOptional(t *testing.T) {
+	locked := map[string]*LockEntry{"app": {}}
+	tests := []struct {
+		lock       Lock
+		noOptional bool
+		want       string
+	}{
+		{Lock{Packages: locked}, false, ""},
+		{Lock{Packages: locked, NoOptional: true}, true, ""},
+		{Lock{Packages: locked, NoOptional: true}, false, "resolved without optional dependencies"},
+		{Lock{Packages: locked}, true, "resolved with optional dependencies"},
+		{Lock{Packages: map[string]*LockEntry{}}, true, ""},
+	}
+	for _, tt := range tests {
+		quietWarnings(t)
+		noOptional = tt.noOptional
+		checkLockOptional(&tt.lock)
+		noOptional = false
+		var got string
+		if w := collectedWarnings(); len(w) > 0 {
+			got = w[0].Message
+		}
+		if (tt.want == "") != (got == "") || !strings.Contains(got, tt.want) {
+			t.Errorf("lock noOptional %v, run noOptional %v: warned %q, want %q", tt.lock.NoOptional, tt.noOptional, got, tt.want)
+		}
+	}
+}
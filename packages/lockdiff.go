@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+)
+
+// LockChange is one package that differs between two lockfiles. From and
+// To are versions, empty when a side does not know one.
+type LockChange struct {
+	Name string `json:"name"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// LockDiff groups the differences between two lockfiles. Changed holds
+// packages whose URL or checksum moved without a known version change.
+type LockDiff struct {
+	Added      []LockChange `json:"added"`
+	Removed    []LockChange `json:"removed"`
+	Upgraded   []LockChange `json:"upgraded"`
+	Downgraded []LockChange `json:"downgraded"`
+	Changed    []LockChange `json:"changed"`
+	Warnings   []Warning    `json:"warnings"`
+}
+
+func (d LockDiff) empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Upgraded)+len(d.Downgraded)+len(d.Changed) == 0
+}
+
+// lockedVersion is the version entry records for key, falling back to a
+// name@version key.
+func lockedVersion(key string, entry *LockEntry) string {
+	if entry.Version != "" {
+		return entry.Version
+	}
+	_, version := splitSpec(key)
+	return version
+}
+
+// diffLocks compares two lockfiles; either may be empty. Entries are
+// matched by package name, since a root package is keyed by the spec it
+// was installed with (math or math@1.2.0), and changes are judged by the
+// versions they resolved to.
+func diffLocks(old, new *Lock) LockDiff {
+	diff := LockDiff{Added: []LockChange{}, Removed: []LockChange{}, Upgraded: []LockChange{}, Downgraded: []LockChange{}, Changed: []LockChange{}}
+	oldKeys, newKeys := keysByName(old), keysByName(new)
+	names := slices.Collect(maps.Keys(oldKeys))
+	for name := range newKeys {
+		if _, ok := oldKeys[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		before, after := pairKeys(oldKeys[name], newKeys[name])
+		for i := range before {
+			switch {
+			case before[i] == "":
+				diff.Added = append(diff.Added, LockChange{Name: name, To: lockedVersion(after[i], new.Packages[after[i]])})
+			case after[i] == "":
+				diff.Removed = append(diff.Removed, LockChange{Name: name, From: lockedVersion(before[i], old.Packages[before[i]])})
+			default:
+				from, to := old.Packages[before[i]], new.Packages[after[i]]
+				change := LockChange{Name: name, From: lockedVersion(before[i], from), To: lockedVersion(after[i], to)}
+				switch versionOrder(change.From, change.To) {
+				case -1:
+					diff.Upgraded = append(diff.Upgraded, change)
+				case 1:
+					diff.Downgraded = append(diff.Downgraded, change)
+				default:
+					if change.From != change.To || !sameResolution(from, to) {
+						diff.Changed = append(diff.Changed, change)
+					}
+				}
+			}
+		}
+	}
+	return diff
+}
+
+// keysByName groups the keys of lock by the package name they lock.
+func keysByName(lock *Lock) map[string][]string {
+	keys := map[string][]string{}
+	for _, key := range slices.Sorted(maps.Keys(lock.Packages)) {
+		name, _ := splitSpec(key)
+		keys[name] = append(keys[name], key)
+	}
+	return keys
+}
+
+// pairKeys lines up the old and new lock keys of one package: identical
+// keys first, then the rest in order. A side without a partner is "".
+func pairKeys(old, new []string) (before, after []string) {
+	var restOld, restNew []string
+	for _, key := range old {
+		if slices.Contains(new, key) {
+			before, after = append(before, key), append(after, key)
+		} else {
+			restOld = append(restOld, key)
+		}
+	}
+	for _, key := range new {
+		if !slices.Contains(old, key) {
+			restNew = append(restNew, key)
+		}
+	}
+	for i := range max(len(restOld), len(restNew)) {
+		var o, n string
+		if i < len(restOld) {
+			o = restOld[i]
+		}
+		if i < len(restNew) {
+			n = restNew[i]
+		}
+		before, after = append(before, o), append(after, n)
+	}
+	return before, after
+}
+
+// versionOrder compares two known versions, and is 0 when either is
+// missing or unparsable.
+func versionOrder(a, b string) int {
+	va, _, errA := parseVersion(a)
+	vb, _, errB := parseVersion(b)
+	if a == "" || b == "" || errA != nil || errB != nil {
+		return 0
+	}
+	return compareVersions(va, vb)
+}
+
+func withVersion(name string, version string) string {
+	if version == "" {
+		return name
+	}
+	return name + " " + version
+}
+
+func sameResolution(a, b *LockEntry) bool {
+	return samePlatformEntry(PlatformEntry{a.URL, a.Integrity}, PlatformEntry{b.URL, b.Integrity}) &&
+		maps.EqualFunc(a.Platforms, b.Platforms, samePlatformEntry)
+}
+
+// samePlatformEntry compares entries by digest, so a lockfile rewritten
+// with base64 integrity strings where it had hex does not show as changed.
+func samePlatformEntry(a, b PlatformEntry) bool {
+	return a.URL == b.URL && sameIntegrity(a.Integrity, b.Integrity)
+}
+
+// printLockDiff renders diff as one line per package, or as JSON.
+func printLockDiff(diff LockDiff, asJSON bool) error {
+	if asJSON {
+		diff.Warnings = collectedWarnings()
+		return printJSON(diff)
+	}
+	if diff.empty() {
+		fmt.Println("No dependency changes")
+		return nil
+	}
+	for _, c := range diff.Added {
+		fmt.Println("+", withVersion(c.Name, c.To))
+	}
+	for _, c := range diff.Removed {
+		fmt.Println("-", withVersion(c.Name, c.From))
+	}
+	for _, c := range diff.Upgraded {
+		fmt.Printf("↑ %s %s → %s\n", c.Name, c.From, c.To)
+	}
+	for _, c := range diff.Downgraded {
+		fmt.Printf("↓ %s %s → %s\n", c.Name, c.From, c.To)
+	}
+	for _, c := range diff.Changed {
+		if c.From != c.To {
+			fmt.Printf("~ %s %s → %s\n", c.Name, c.From, c.To)
+		} else {
+			fmt.Println("~", withVersion(c.Name, c.To), "(checksum changed)")
+		}
+	}
+	return nil
+}
+
+// committedLock reads the lockfile as committed at git HEAD. A lockfile
+// that is not committed, or a project outside git, compares as empty.
+func committedLock() (*Lock, error) {
+	lock := &Lock{Packages: map[string]*LockEntry{}}
+	data, err := exec.Command("git", "show", "HEAD:./"+lockFile).Output()
+	if err != nil {
+		return lock, nil
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("committed %s is corrupt: %v", lockFile, err)
+	}
+	if lock.Packages == nil {
+		lock.Packages = map[string]*LockEntry{}
+	}
+	return lock, nil
+}
+
+// lockDiff compares the working lockfile against against, or the
+// committed one when against is empty.
+func lockDiff(against string, asJSON bool) error {
+	var old *Lock
+	var err error
+	if against == "" {
+		old, err = committedLock()
+	} else {
+		if _, statErr := os.Stat(against); statErr != nil {
+			return statErr
+		}
+		old, err = readLock(against)
+	}
+	if err != nil {
+		return err
+	}
+	current, err := readLock(lockFile)
+	if err != nil {
+		return err
+	}
+	return printLockDiff(diffLocks(old, current), asJSON)
+}
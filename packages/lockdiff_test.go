@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffLocks(t *testing.T) {
+	entry := func(version string, integrity string) *LockEntry {
+		return &LockEntry{Version: version, URL: "https://r/x.tar.gz", Integrity: integrity}
+	}
+	tests := []struct {
+		name     string
+		old, new map[string]*LockEntry
+		want     LockDiff
+	}{
+		{"added and removed",
+			map[string]*LockEntry{"io": entry("1.0.0", "sha256-a")},
+			map[string]*LockEntry{"math": entry("1.2.0", "sha256-b")},
+			LockDiff{Added: []LockChange{{"math", "", "1.2.0"}}, Removed: []LockChange{{"io", "1.0.0", ""}}}},
+		{"upgrade under the same key",
+			map[string]*LockEntry{"math": entry("1.2.0", "sha256-a")},
+			map[string]*LockEntry{"math": entry("1.3.0", "sha256-b")},
+			LockDiff{Upgraded: []LockChange{{"math", "1.2.0", "1.3.0"}}}},
+		{"pinned root upgraded",
+			map[string]*LockEntry{"math@1.2.0": entry("1.2.0", "sha256-a")},
+			map[string]*LockEntry{"math@1.3.0": entry("1.3.0", "sha256-b")},
+			LockDiff{Upgraded: []LockChange{{"math", "1.2.0", "1.3.0"}}}},
+		{"pinned root unpinned",
+			map[string]*LockEntry{"math@1.2.0": entry("1.2.0", "sha256-a")},
+			map[string]*LockEntry{"math": entry("1.3.0", "sha256-b")},
+			LockDiff{Upgraded: []LockChange{{"math", "1.2.0", "1.3.0"}}}},
+		{"pinned root downgraded, legacy entry without version",
+			map[string]*LockEntry{"math": entry("2.0.0", "sha256-a")},
+			map[string]*LockEntry{"math@1.0.0": entry("", "sha256-b")},
+			LockDiff{Downgraded: []LockChange{{"math", "2.0.0", "1.0.0"}}}},
+		{"same version under another key",
+			map[string]*LockEntry{"math": entry("1.2.0", "sha256-a")},
+			map[string]*LockEntry{"math@1.2.0": entry("1.2.0", "sha256-a")},
+			LockDiff{}},
+		{"checksum changed",
+			map[string]*LockEntry{"math": entry("1.2.0", "sha256-a")},
+			map[string]*LockEntry{"math": entry("1.2.0", "sha256-b")},
+			LockDiff{Changed: []LockChange{{"math", "1.2.0", "1.2.0"}}}},
+		{"two versions, one upgraded",
+			map[string]*LockEntry{"math@1.0.0": entry("1.0.0", "sha256-a"), "math@1.2.0": entry("1.2.0", "sha256-b")},
+			map[string]*LockEntry{"math@1.0.0": entry("1.0.0", "sha256-a"), "math@1.3.0": entry("1.3.0", "sha256-c")},
+			LockDiff{Upgraded: []LockChange{{"math", "1.2.0", "1.3.0"}}}},
+		{"one side empty",
+			nil,
+			map[string]*LockEntry{"math@1.2.0": entry("1.2.0", "sha256-a")},
+			LockDiff{Added: []LockChange{{"math", "", "1.2.0"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, new := &Lock{Packages: tt.old}, &Lock{Packages: tt.new}
+			if old.Packages == nil {
+				old.Packages = map[string]*LockEntry{}
+			}
+			got := diffLocks(old, new)
+			want := tt.want
+			for _, list := range []*[]LockChange{&want.Added, &want.Removed, &want.Upgraded, &want.Downgraded, &want.Changed} {
+				if *list == nil {
+					*list = []LockChange{}
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("diffLocks = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
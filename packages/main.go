@@ -1,146 +1,1470 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
 )
 
 const repoURL = "https://github.com/Bytes-Repository/bytes.io/blob/main/repository/"
 
-func downloadPackage(pkgName string, destDir string) error {
-	url := repoURL + pkgName + ".tar.gz"
-	resp, err := http.Get(url)
+func downloadPackage(ctx context.Context, pkgName string, destDir string) (PlatformEntry, error) {
+	ext := archiveExt(pkgName)
+	url := registryURL() + pkgName + ext
+	filePath := filepath.Join(destDir, pkgName+ext)
+	integrity, err := fetchPackage(ctx, url, filePath)
 	if err != nil {
-		return err
+		return PlatformEntry{URL: url}, err
+	}
+	resolved := PlatformEntry{URL: url, Integrity: integrity}
+	if err := checkIndexIntegrity(pkgName, filePath, integrity); err != nil {
+		return resolved, err
+	}
+	if err := tofuCheck(resolvedPackage(pkgName, filePath), integrity); err != nil {
+		return resolved, err
+	}
+	return resolved, nil
+}
+
+// checkIndexIntegrity compares a fresh download with the checksum the
+// index publishes, or the one bytes.yml pins, deleting the file on a
+// mismatch.
+func checkIndexIntegrity(pkgName string, filePath string, integrity string) error {
+	expected := expectedIntegrity(pkgName, indexIntegrity(pkgName))
+	if expected == "" || sameIntegrity(expected, integrity) {
+		return nil
+	}
+	defer stopwatch.phase("verify")()
+	// The index may use another algorithm than the download was hashed with.
+	err := verifyChecksum(filePath, expected)
+	if err == nil {
+		return nil
+	}
+	os.Remove(filePath)
+	return &IntegrityError{Mismatches: []string{integrityMismatch(pkgName, err)}}
+}
+
+// fetchPackage downloads url to filePath and returns the SRI-style
+// integrity of the downloaded bytes, using checksumAlgo.
+func fetchPackage(ctx context.Context, url string, filePath string) (string, error) {
+	pkgName, _, _ := strings.Cut(filepath.Base(filePath), ".tar.")
+	defer stopwatch.download(pkgName)()
+	return downloadFile(ctx, url, filePath, false)
+}
+
+// downloadFile fetches url into filePath.part and renames it into place
+// once complete, so an interrupted download never leaves a truncated
+// archive behind. Normally the partial file is removed on failure; with
+// resume it is kept, and a later call continues it with a Range request
+// when the server supports that.
+func downloadFile(ctx context.Context, url string, filePath string, resume bool) (string, error) {
+	hash, err := newDigest(checksumAlgo)
+	if err != nil {
+		return "", err
+	}
+	part := filePath + ".part"
+	var offset int64
+	if info, err := os.Stat(part); err == nil && resume {
+		offset = info.Size()
+	}
+	req, err := newRequest(ctx, "GET", url)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", acceptHeader())
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	cached, revalidate := readTarballCache(filePath, url)
+	if revalidate && offset == 0 {
+		if cached.fresh() {
+			return fileIntegrity(filePath)
+		}
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return "", err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download: %s", resp.Status)
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flags = os.O_WRONLY | os.O_APPEND
+	case resp.StatusCode == http.StatusNotModified && req.Header.Get("If-None-Match") != "":
+		// The archive from the last download is still current.
+		drainBody(resp)
+		saveTarballCache(filePath, url, resp.Header)
+		return fileIntegrity(filePath)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The partial file does not fit the current archive; start over.
+		drainBody(resp)
+		os.Remove(part)
+		return downloadFile(ctx, url, filePath, resume)
+	case resp.StatusCode != http.StatusOK:
+		drainBody(resp)
+		return "", fmt.Errorf("failed to download: %s", resp.Status)
+	default:
+		offset = 0
 	}
 
-	filePath := filepath.Join(destDir, pkgName+".tar.gz")
-	file, err := os.Create(filePath)
+	pkgName, _, _ := strings.Cut(filepath.Base(filePath), ".tar.")
+	if err := checkDiskSpace(pkgName, filepath.Dir(filePath), resp.ContentLength); err != nil {
+		return "", err
+	}
+	if !resume {
+		defer track(part)()
+	}
+	if offset > 0 {
+		existing, err := os.Open(part)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(hash, io.LimitReader(existing, offset))
+		existing.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	file, err := os.OpenFile(part, flags, 0644)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer file.Close()
 
-	_, err = io.Copy(file, resp.Body)
-	return err
+	total := resp.ContentLength
+	if total >= 0 {
+		total += offset
+	}
+	body := &progressReader{r: resp.Body, pkg: pkgName, total: total, read: offset, interval: progressInterval()}
+	if eventsEnabled() {
+		body.interval = 200 * time.Millisecond
+	}
+	n, err := io.Copy(io.MultiWriter(file, hash), body)
+	endProgress()
+	if err == nil {
+		err = file.Close()
+	}
+	if err == nil {
+		err = os.Rename(part, filePath)
+	}
+	if err != nil {
+		if !resume {
+			os.Remove(part)
+		}
+		return "", err
+	}
+	saveTarballCache(filePath, url, resp.Header)
+	emit(Event{Type: "download_done", Package: pkgName, URL: url, Bytes: offset + n})
+	return formatIntegrity(checksumAlgo, hash), nil
 }
 
-func install(pkgName string, inProject bool) error {
+// resolvePackageURL prefers a per-platform variant (math-linux-amd64.tar.gz)
+// and falls back to the generic tarball when the registry has none.
+func resolvePackageURL(ctx context.Context, pkgName string, platform string) (string, bool) {
+	ext := archiveExt(pkgName)
+	url := registryURL() + pkgName + "-" + strings.ReplaceAll(platform, "/", "-") + ext
+	req, err := newRequest(ctx, "HEAD", url)
+	if err != nil {
+		return registryURL() + pkgName + ext, false
+	}
+	resp, err := httpClient().Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return url, true
+		}
+	}
+	return registryURL() + pkgName + ext, false
+}
+
+// writableDir reports an error if files cannot be created in dir.
+func writableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// checkDiskSpace fails early when the filesystem holding dir cannot take
+// a download of pkgName. The size comes from the response's Content-Length
+// or, for chunked responses without one, from the size the index declares;
+// with neither, or no way to ask the filesystem, nothing is checked.
+func checkDiskSpace(pkgName string, dir string, contentLength int64) error {
+	meta, _ := indexVersion(pkgName)
+	need := contentLength
+	if need < 0 {
+		need = meta.Size
+	}
+	if need <= 0 {
+		return nil
+	}
+	need += meta.InstalledSize
+	free, ok := diskFree(dir)
+	if !ok || free >= need {
+		return nil
+	}
+	return fmt.Errorf("not enough disk space for %s in %s: need %s, %s free", pkgName, dir, formatBytes(need), formatBytes(free))
+}
+
+// globalLibsDir picks the directory for a global install: prefix when
+// given, otherwise ~/.vira/libs, falling back to VIRA_LIBS when the default
+// is not writable (for example a shared install owned by root).
+func globalLibsDir(prefix string) (string, error) {
+	if prefix != "" {
+		if err := writableDir(prefix); err != nil {
+			return "", fmt.Errorf("cannot install into %s: %v", prefix, err)
+		}
+		return prefix, nil
+	}
+	dir := os.Getenv("HOME") + "/.vira/libs"
+	if writableDir(dir) == nil {
+		return dir, nil
+	}
+	if override := os.Getenv("VIRA_LIBS"); override != "" && writableDir(override) == nil {
+		return override, nil
+	}
+	return "", fmt.Errorf("libs directory %s is read-only, try --in-project or --prefix", dir)
+}
+
+// InstallOptions are the flags accepted by install.
+type InstallOptions struct {
+	InProject bool
+	Prefix    string
+	Events    bool
+	DryRun    bool
+	JSON      bool
+	MaxDepth  int
+	GlobalBin bool
+	// NoScripts skips lifecycle scripts for this run; AllowScripts runs
+	// them even when ignore-scripts is set in the config.
+	NoScripts    bool
+	AllowScripts bool
+	// Force reinstalls packages that are already installed.
+	Force bool
+	// StrictEngines fails instead of warning when a package's engines.vira
+	// does not match the toolchain.
+	StrictEngines bool
+	// SaveBundle copies the project's dependencies into vendor/vira;
+	// Vendored installs only from there.
+	SaveBundle bool
+	Vendored   bool
+	// LockfileOnly resolves and writes bytes.lock without downloading.
+	LockfileOnly bool
+	// ParallelExtract unpacks archives while they download, fetching up
+	// to Jobs packages at once.
+	ParallelExtract bool
+	Jobs            int
+}
+
+func install(ctx context.Context, pkgName string, opts InstallOptions) (err error) {
+	var resolved PlatformEntry
+	spec := replacedSpec(pkgName)
+	pkgName, channel, err := channelSpec(spec)
+	if err != nil {
+		return err
+	}
+	if channel != "" {
+		notify(pkgName, "Resolved %s to %s", spec, pkgName)
+	}
+	if opts.LockfileOnly {
+		return lockInstall(pkgName, opts.MaxDepth)
+	}
+	if opts.DryRun {
+		destDir := filepath.Join("build", "dependencies")
+		if !opts.InProject {
+			destDir = opts.Prefix
+			if destDir == "" {
+				destDir = os.Getenv("HOME") + "/.vira/libs"
+			}
+		}
+		plan, err := planInstall(pkgName, destDir, opts.MaxDepth)
+		if err != nil {
+			return err
+		}
+		return printPlan(plan, opts.JSON)
+	}
+	defer func() { recordAudit("install", pkgName, resolved, err) }()
+	emit(Event{Type: "resolve_start", Package: pkgName})
+
 	var destDir string
-	if inProject {
+	var lock *Lock
+	if opts.InProject {
 		destDir = filepath.Join("build", "dependencies")
 		os.MkdirAll(destDir, 0755)
+		lock, err = readLock(lockFile)
+		if err != nil {
+			return err
+		}
+		checkLockOptional(lock)
+		lock.NoOptional = noOptional
 	} else {
-		destDir = os.Getenv("HOME") + "/.vira/libs"
+		destDir, err = globalLibsDir(opts.Prefix)
+		if err != nil {
+			return err
+		}
+	}
+	var pipe *pipeline
+	if opts.ParallelExtract {
+		var names []string
+		for _, name := range installOrder(pkgName, opts.MaxDepth) {
+			if _, overridden := overrideFor(name); overridden {
+				continue
+			}
+			if _, ok := upToDate(name, destDir, lock); ok && !opts.Force {
+				continue
+			}
+			names = append(names, name)
+		}
+		pipe = startPipeline(ctx, names, destDir, lock, opts.Jobs)
+		defer pipe.stop()
+	}
+	fetch := func(name string) (PlatformEntry, error) {
+		if !opts.Force {
+			if meta, ok := upToDate(name, destDir, lock); ok {
+				if meta.Version != "" {
+					notify(name, "%s@%s already installed", name, meta.Version)
+				} else {
+					notify(name, "%s already installed", name)
+				}
+				return PlatformEntry{URL: meta.URL, Integrity: meta.Integrity}, nil
+			}
+		}
+		if meta, ok := indexVersion(name); ok {
+			n, _ := splitSpec(name)
+			warnDeprecated(n, pickedVersion(name), meta)
+			if err := checkEngines(&meta, toolchainVersion()); err != nil {
+				if opts.StrictEngines {
+					return PlatformEntry{}, fmt.Errorf("%s %v", name, err)
+				}
+				warn(codeEngineMismatch, name, "%s %v", name, err)
+			}
+		}
+		var resolved PlatformEntry
+		var err error
+		if target, ok := overrideFor(name); ok {
+			resolved, err = installOverride(ctx, name, target, destDir)
+		} else if s, ok := pipe.wait(name); ok {
+			resolved, err = s.resolved, s.err
+			if err == nil {
+				s.record(lock)
+				err = writeInstalledMeta(filepath.Join(destDir, name), InstalledMeta{Version: pickedVersion(name), URL: resolved.URL, Integrity: resolved.Integrity})
+			}
+		} else {
+			if lock != nil {
+				resolved, err = installLocked(ctx, lock, name, destDir)
+			} else {
+				resolved, err = downloadPackage(ctx, name, destDir)
+			}
+			if err == nil {
+				err = unpack(ctx, name, destDir)
+			}
+			if err == nil {
+				err = writeInstalledMeta(filepath.Join(destDir, name), InstalledMeta{Version: pickedVersion(name), URL: resolved.URL, Integrity: resolved.Integrity})
+			}
+		}
+		if err != nil {
+			return resolved, err
+		}
+		if err := postinstall(name, filepath.Join(destDir, name), opts); err != nil {
+			return resolved, err
+		}
+		if opts.GlobalBin || !opts.InProject {
+			if err := linkBins(name, filepath.Join(destDir, name), binDir()); err != nil {
+				return resolved, err
+			}
+		}
+		if opts.InProject {
+			return resolved, linkBins(name, filepath.Join(destDir, name), projectBinDir())
+		}
+		return resolved, nil
+	}
+
+	resolved, err = fetch(pkgName)
+	if err != nil {
+		if index, ierr := loadIndex(); ierr == nil {
+			name, _ := splitSpec(pkgName)
+			_, overridden := overrideFor(name)
+			if _, ok := index.lookup(name); !ok && !overridden {
+				return notFoundError(name, index)
+			}
+		}
+		return err
+	}
+	if err := installDependencies(pkgName, destDir, opts.MaxDepth, fetch); err != nil {
+		return err
+	}
+	if channel != "" {
+		pkgDir := filepath.Join(destDir, pkgName)
+		if meta, err := readInstalledMeta(pkgDir); err == nil {
+			meta.Channel = channel
+			if err := writeInstalledMeta(pkgDir, *meta); err != nil {
+				return err
+			}
+		}
 	}
-	return downloadPackage(pkgName, destDir)
+	if lock != nil {
+		if err := writeLock(lockFile, lock); err != nil {
+			return err
+		}
+	}
+	if opts.SaveBundle {
+		if err := saveBundle(destDir, lock); err != nil {
+			return err
+		}
+	}
+	emit(Event{Type: "install_done", Package: pkgName})
+	return nil
 }
 
-func remove(pkgName string) error {
-	// Stub: remove from libs
-	path := os.Getenv("HOME") + "/.vira/libs/" + pkgName + ".tar.gz"
-	return os.Remove(path)
+// postinstall runs the package's postinstall script unless scripts are
+// disabled for this run or by the ignore-scripts config setting.
+func postinstall(pkgName string, pkgDir string, opts InstallOptions) error {
+	if opts.NoScripts || packageScripts(pkgName)["postinstall"] == "" {
+		return nil
+	}
+	if loadConfig().IgnoreScripts && !opts.AllowScripts {
+		warn(codeSkippedScript, pkgName, "skipped postinstall script for %s (ignore-scripts is set, use --allow-scripts to run it)", pkgName)
+		return nil
+	}
+	return runLifecycleScript(pkgName, "postinstall", pkgDir)
 }
 
-func update() error {
-	// Stub: update all
-	fmt.Println("Updating all packages...")
+// unpack extracts the downloaded tarball of pkgName into destDir/pkgName.
+func unpack(ctx context.Context, pkgName string, destDir string) error {
+	defer stopwatch.phase("extract")()
+	matches, _ := filepath.Glob(filepath.Join(destDir, pkgName+".tar.*"))
+	if len(matches) == 0 {
+		return fmt.Errorf("no archive for %s in %s", pkgName, destDir)
+	}
+	if err := extractPackage(ctx, matches[0], filepath.Join(destDir, pkgName)); err != nil {
+		return err
+	}
+	emit(Event{Type: "extract_done", Package: pkgName})
 	return nil
 }
 
-func upgrade() error {
-	// Stub: upgrade binaries
-	fmt.Println("Upgrading Vira...")
+// installDependencies installs what pkgName depends on according to the
+// cached index. Without an index only the package itself is installed.
+func installDependencies(pkgName string, destDir string, maxDepth int, fetch func(string) (PlatformEntry, error)) error {
+	index, err := loadIndex()
+	if err != nil {
+		return nil
+	}
+	name, _ := splitSpec(pkgName)
+	if _, ok := index.lookup(name); !ok {
+		if _, overridden := overrideFor(name); !overridden {
+			return nil
+		}
+	}
+	res, err := resolveDependencies(index, pkgName, maxDepth)
+	if err != nil {
+		return err
+	}
+	for _, dep := range res.Packages[1:] {
+		spec := dep.spec(index)
+		resolved, err := fetch(spec)
+		recordAudit("install", spec, resolved, err)
+		if err != nil && dep.Optional {
+			warn(codeOptionalSkipped, dep.Name, "optional dependency %s failed to install: %v", dep.Name, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	checkPeers(res, destDir)
 	return nil
 }
 
-func refresh() error {
-	// Stub: refresh cache
-	fmt.Println("Refreshing repo...")
-	return nil
+// installLocked installs pkgName using its lockfile entry for the current
+// platform, resolving and recording a new entry when there is none.
+func installLocked(ctx context.Context, lock *Lock, pkgName string, destDir string) (PlatformEntry, error) {
+	d, err := downloadLocked(ctx, lock, pkgName, destDir)
+	if err != nil {
+		return d.Expected, err
+	}
+	if err := verifyDownloads([]Download{d}, 1); err != nil {
+		return d.Expected, err
+	}
+	return d.Expected, nil
+}
+
+// downloadLocked fetches pkgName as recorded in the lockfile without
+// verifying it. Entries resolved now are hashed while downloading and
+// recorded in lock.
+func downloadLocked(ctx context.Context, lock *Lock, pkgName string, destDir string) (Download, error) {
+	platform := currentPlatform()
+	entry := lock.Packages[pkgName]
+	if entry == nil {
+		entry = &LockEntry{}
+		lock.Packages[pkgName] = entry
+	}
+	filePath := filepath.Join(destDir, pkgName+archiveExt(pkgName))
+
+	locked, ok := entry.resolved(platform)
+	if !ok {
+		if len(entry.Platforms) > 0 {
+			warn(codeLockPlatform, pkgName, "%s has no entry for %s in %s, resolving it", pkgName, platform, lockFile)
+		}
+		url, perPlatform := resolvePackageURL(ctx, pkgName, platform)
+		integrity, err := fetchPackage(ctx, url, filePath)
+		if err != nil {
+			if entry.URL == "" && len(entry.Platforms) == 0 {
+				delete(lock.Packages, pkgName)
+			}
+			return Download{Name: pkgName, Expected: PlatformEntry{URL: url}}, err
+		}
+		resolved := PlatformEntry{URL: url, Integrity: integrity}
+		err = checkIndexIntegrity(pkgName, filePath, integrity)
+		if err == nil {
+			err = tofuCheck(resolvedPackage(pkgName, filePath), integrity)
+		}
+		if err != nil {
+			if entry.URL == "" && len(entry.Platforms) == 0 {
+				delete(lock.Packages, pkgName)
+			}
+			return Download{Name: pkgName, Expected: resolved}, err
+		}
+		entry.set(platform, perPlatform, resolved)
+		entry.Version = pickedVersion(pkgName)
+		return Download{Name: pkgName, Path: filePath, Expected: resolved}, nil
+	}
+
+	url := locked.URL
+	if localRegistry != "" {
+		// Bundles hold the locked archives under their install names.
+		url = registryURL() + filepath.Base(filePath)
+	}
+	_, err := fetchPackage(ctx, url, filePath)
+	return Download{Name: pkgName, Path: filePath, Expected: locked}, err
+}
+
+// ci installs every package recorded in the lockfile into the project.
+// All archives are downloaded first, then verified on up to jobs workers.
+func ci(ctx context.Context, jobs int) error {
+	lock, err := readLock(lockFile)
+	if err != nil {
+		return err
+	}
+	if noOptional {
+		// ci installs what is locked; only a lockfile resolved with
+		// --no-optional leaves optional dependencies out.
+		checkLockOptional(lock)
+	}
+	destDir := filepath.Join("build", "dependencies")
+	os.MkdirAll(destDir, 0755)
+
+	var downloads []Download
+	for _, name := range slices.Sorted(maps.Keys(lock.Packages)) {
+		d, err := downloadLocked(ctx, lock, name, destDir)
+		if err != nil {
+			recordAudit("install", name, d.Expected, err)
+			return err
+		}
+		downloads = append(downloads, d)
+	}
+	if err := verifyDownloads(downloads, jobs); err != nil {
+		for _, d := range downloads {
+			recordAudit("install", d.Name, d.Expected, err)
+		}
+		return err
+	}
+	for _, d := range downloads {
+		err := unpack(ctx, d.Name, destDir)
+		if err == nil {
+			err = linkBins(d.Name, filepath.Join(destDir, d.Name), projectBinDir())
+		}
+		recordAudit("install", d.Name, d.Expected, err)
+		if err != nil {
+			return err
+		}
+	}
+	return writeLock(lockFile, lock)
+}
+
+// listInstalled returns the names of packages installed in dir, one per
+// extracted directory or archive.
+func listInstalled(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".staging") {
+			continue
+		}
+		if i := strings.Index(name, ".tar."); i > 0 && !e.IsDir() {
+			name = name[:i]
+		} else if !e.IsDir() || strings.HasPrefix(name, ".") || filepath.Join(dir, name) == projectBinDir() {
+			// projectBinDir holds the shims of a project, not a package.
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// removeCandidates returns the installed packages pkgName may refer to:
+// the exact name and, unless exact is set or pkgName has a version, any
+// name@version of it. Other names sharing a prefix never match.
+func removeCandidates(installed []string, pkgName string, exact bool) []string {
+	var matches []string
+	for _, name := range installed {
+		if name == pkgName || (!exact && !strings.Contains(pkgName, "@") && strings.HasPrefix(name, pkgName+"@")) {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+// remove deletes one installed package and returns its full name. A name
+// matching several installed versions is an error listing them. With
+// inProject it is removed from the project and its lockfile instead.
+func remove(pkgName string, exact bool, inProject bool) (removed string, err error) {
+	defer func() { recordAudit("remove", removed, PlatformEntry{}, err) }()
+	removed = pkgName
+
+	libs := os.Getenv("HOME") + "/.vira/libs"
+	if inProject {
+		libs = filepath.Join("build", "dependencies")
+	}
+	installed, err := listInstalled(libs)
+	if err != nil {
+		return removed, err
+	}
+	candidates := removeCandidates(installed, pkgName, exact)
+	switch len(candidates) {
+	case 0:
+		return removed, fmt.Errorf("%s is not installed", pkgName)
+	case 1:
+		removed = candidates[0]
+	default:
+		return removed, fmt.Errorf("%s is ambiguous, specify one of: %s", pkgName, strings.Join(candidates, ", "))
+	}
+
+	path := filepath.Join(libs, removed)
+	if err := unlinkBins(path, binDir()); err != nil {
+		return removed, err
+	}
+	if inProject {
+		if err := unlinkBins(path, projectBinDir()); err != nil {
+			return removed, err
+		}
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return removed, err
+	}
+	archives, _ := filepath.Glob(path + ".tar.*")
+	for _, a := range archives {
+		if err := os.Remove(a); err != nil {
+			return removed, err
+		}
+	}
+	if inProject {
+		lock, err := readLock(lockFile)
+		if err != nil {
+			return removed, err
+		}
+		if _, ok := lock.Packages[removed]; ok {
+			delete(lock.Packages, removed)
+			return removed, writeLock(lockFile, lock)
+		}
+	}
+	return removed, nil
 }
 
-func search(query string) error {
-	// Stub: search
-	fmt.Printf("Search results for %s:\n- math\n- io\n", query)
+const releasesURL = "https://api.github.com/repos/Vira-Lang/vira/releases/latest"
+
+// upgrade replaces the installed binaries. With check it only compares the
+// running version against the latest release.
+func upgrade(ctx context.Context, check bool) error {
+	if check {
+		data, _, err := fetchURL(ctx, releasesURL)
+		if err != nil {
+			return err
+		}
+		var release struct {
+			TagName string `json:"tag_name"`
+		}
+		if err := json.Unmarshal(data, &release); err != nil {
+			return err
+		}
+		latest := strings.TrimPrefix(release.TagName, "v")
+		if latest == versionInfo().Version {
+			fmt.Println("vira-packages", latest, "is up to date")
+		} else {
+			fmt.Printf("Update available: %s -> %s\n", versionInfo().Version, latest)
+		}
+		return nil
+	}
+	// Stub: upgrade binaries
+	fmt.Println("Upgrading Vira...")
 	return nil
 }
 
+// refresh downloads the registry index into the cache. With checkOnly the
+// index is only validated and the cached copy is left untouched. Sharded
+// registries only have their shard list refreshed here. Unless full is
+// set, only the changes since the last refresh are fetched when the
+// registry supports it.
+func refresh(ctx context.Context, checkOnly bool, full bool) error {
+	fmt.Println("Refreshing repo...")
+	if sharded, err := refreshShards(ctx, checkOnly); sharded || err != nil {
+		if err == nil && checkOnly {
+			fmt.Println("Index is valid")
+		}
+		return err
+	}
+	var data []byte
+	var refreshed time.Time
+	ok := false
+	if !full {
+		data, refreshed, ok = refreshIncremental(ctx)
+	}
+	if !ok {
+		refreshed = time.Now()
+		var err error
+		if data, err = fetchIndex(ctx); err != nil {
+			return err
+		}
+	}
+	if checkOnly {
+		fmt.Println("Index is valid")
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(indexPath()), 0755); err != nil {
+		return err
+	}
+	os.RemoveAll(shardDir())
+	if err := writeFileAtomic(indexPath(), data, 0644); err != nil {
+		return err
+	}
+	return writeRefreshState(refreshed)
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: vira-packages <command> [args]")
-		fmt.Println("Commands: install, remove, update, upgrade, refresh, search")
-		os.Exit(1)
+		fmt.Println("Commands: install, ci, fetch, bundle, list, remove, clean, update, upgrade, refresh, search, info, deps, diff, sbom, audit, verify, recover, run, version, config, pack, migrate")
+		exit(1)
 	}
 
 	command := os.Args[1]
 	args := os.Args[2:]
+	ctx := handleSignals(context.Background())
 
 	switch command {
 	case "install":
-		inProject := flag.Bool("in-project", false, "Install in project")
+		var opts InstallOptions
+		flag.BoolVar(&opts.InProject, "in-project", false, "Install in project")
+		global := flag.Bool("global", false, "Install globally (overrides default-scope)")
+		flag.StringVar(&opts.Prefix, "prefix", "", "Install globally into this directory")
+		flag.IntVar(&opts.MaxDepth, "max-depth", configuredMaxDepth(), "Maximum dependency chain length")
+		flag.BoolVar(&opts.GlobalBin, "global-bin", false, "Link package executables into ~/.vira/bin")
+		flag.BoolVar(&opts.NoScripts, "no-scripts", false, "Do not run lifecycle scripts")
+		flag.BoolVar(&opts.AllowScripts, "allow-scripts", false, "Run lifecycle scripts even if ignore-scripts is set")
+		flag.BoolVar(&requireSandbox, "require-sandbox", false, "Fail instead of running lifecycle scripts without a sandbox tool")
+		flag.BoolVar(&opts.Events, "events", false, "Stream progress as newline-delimited JSON events")
+		flag.BoolVar(&opts.DryRun, "dry-run", false, "Show the resolved install plan without downloading")
+		flag.BoolVar(&opts.JSON, "json", false, "Print the --dry-run plan or --verify-only report as JSON")
+		flag.BoolVar(&opts.Force, "force", false, "Reinstall packages that are already installed")
+		flag.BoolVar(&noOptional, "no-optional", false, "Leave out optional dependencies and record that in "+lockFile)
+		flag.BoolVar(&opts.StrictEngines, "strict-engines", false, "Fail when a package requires another Vira version")
+		flag.BoolVar(&opts.SaveBundle, "save-bundle", false, "Vendor the project's dependencies into vendor/vira")
+		flag.BoolVar(&opts.Vendored, "vendored", false, "Install only from vendor/vira")
+		report := flag.String("report", "", "Write a CycloneDX SBOM of the project's dependencies to this file")
+		reset := flag.String("tofu-reset", "", "Forget the checksum trusted for this package (name or name@version) since its first install")
+		frozen := flag.Bool("frozen-lockfile", false, "Fail if "+lockFile+" is out of sync with "+manifestFile+", then install exactly what it locks")
+		verifyOnly := flag.Bool("verify-only", false, "With --frozen-lockfile, only check that every locked package is installed intact, offline")
+		flag.BoolVar(&opts.LockfileOnly, "lockfile-only", false, "Resolve and write "+lockFile+" without installing")
+		flag.BoolVar(&opts.ParallelExtract, "parallel-extract", false, "Unpack archives while they download and fetch several packages at once")
+		flag.IntVar(&opts.Jobs, "jobs", runtime.NumCPU(), "Number of packages to fetch at once with --parallel-extract")
+		fromDir := flag.String("from-dir", "", "Install offline from a directory of tarballs and index.json")
+		offlineBundle := flag.String("offline-bundle", "", "Install offline from a bundle file written by the bundle command")
+		env := flag.String("env", "", "Install the project's dependencies for this environment of "+manifestFile)
+		with := flag.String("with", "", "Also extract these optional asset groups (comma-separated)")
+		without := flag.String("without", "", "Skip these asset groups, such as docs,examples")
+		flag.BoolVar(&noProgress, "no-progress", false, "Do not show download progress")
+		flag.IntVar(&stripComponents, "strip-components", -1, "Drop this many leading directories from archive entries (default: a directory named after the package)")
+		flag.BoolVar(&noPreserveMtime, "no-preserve-mtime", false, "Give extracted files the current time")
+		flag.StringVar(&checksumAlgo, "checksum-algo", "sha256", "Digest to record for new downloads (sha256, sha384, sha512)")
+		flag.BoolVar(&allowWeakChecksums, "allow-weak-checksums", false, "Accept md5 and sha1 integrity strings")
+		timings := timingsOption()
 		flag.CommandLine.Parse(args)
+		warningsQuiet = opts.JSON && (opts.DryRun || *verifyOnly)
+		if *timings != "" {
+			startStopwatch()
+		}
+		if opts.Events {
+			enableEvents()
+		}
+		if _, err := newDigest(checksumAlgo); err != nil {
+			printError(err)
+			exit(1)
+		}
+		groups, err := parseGroupSelection(*with, *without)
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		if *offlineBundle != "" {
+			if *fromDir != "" {
+				printError("--offline-bundle and --from-dir cannot be combined")
+				exit(1)
+			}
+			b, err := openBundle(ctx, *offlineBundle)
+			if err != nil {
+				printError(err)
+				exit(1)
+			}
+			*fromDir = b.Dir
+		}
+		extractGroups = groups
+		if *reset != "" {
+			if err := tofuReset(*reset); err != nil {
+				printError(err)
+				exit(1)
+			}
+			notify("", "Forgot the trusted checksum of %s", *reset)
+		}
 		pkgName := flag.Arg(0)
+		if pkgName == "" && *reset != "" {
+			return
+		}
+		if *verifyOnly && !*frozen {
+			printError("--verify-only needs --frozen-lockfile")
+			exit(1)
+		}
+		if *frozen {
+			if pkgName != "" {
+				printError("--frozen-lockfile installs the lockfile, drop the package name")
+				exit(1)
+			}
+			if err := enterProjectRoot(); err != nil {
+				printError(err)
+				exit(1)
+			}
+			if err := usePinnedIntegrity(); err != nil {
+				printError(err)
+				exit(1)
+			}
+			drift, err := checkFrozen(*verifyOnly)
+			if err == nil && (*verifyOnly || len(drift) > 0) {
+				err = printDrift(drift, opts.JSON)
+			}
+			if err != nil {
+				printError(err)
+				exit(1)
+			}
+			if hasChecksumDrift(drift) {
+				exit(exitIntegrity)
+			}
+			if len(drift) > 0 {
+				exit(1)
+			}
+			if *verifyOnly {
+				return
+			}
+			offline = false
+			if *fromDir != "" {
+				err = useLocalRegistry(*fromDir)
+			} else {
+				err = useVendor(false)
+			}
+			if err == nil {
+				err = ci(ctx, opts.Jobs)
+			}
+			stopwatch.print(*timings)
+			var integrityErr *IntegrityError
+			if errors.As(err, &integrityErr) {
+				printError(err)
+				exit(exitIntegrity)
+			}
+			if err != nil {
+				printError(err)
+				exit(1)
+			}
+			notify("", "Installed dependencies from %s", lockFile)
+			return
+		}
+		if pkgName == "" && *env == "" && *offlineBundle == "" {
+			printError("Provide package name")
+			exit(1)
+		}
+		if opts.InProject, err = projectScope(opts.InProject, *global || opts.Prefix != ""); err != nil {
+			printError(err)
+			exit(1)
+		}
+		if pkgName == "" && !opts.InProject {
+			// A bundle alone installs the project's dependencies.
+			printError("Provide package name")
+			exit(1)
+		}
+		if *fromDir != "" {
+			if err := useLocalRegistry(*fromDir); err != nil {
+				printError(err)
+				exit(1)
+			}
+		}
+		if (opts.SaveBundle || opts.Vendored) && !opts.InProject {
+			printError("--save-bundle and --vendored need --in-project")
+			exit(1)
+		}
+		if opts.LockfileOnly && !opts.InProject {
+			printError("--lockfile-only needs --in-project")
+			exit(1)
+		}
+		if *report != "" && !opts.InProject {
+			printError("--report needs --in-project")
+			exit(1)
+		}
+		if *env != "" && !opts.InProject {
+			printError("--env needs --in-project")
+			exit(1)
+		}
+		if *report != "" {
+			if *report, err = filepath.Abs(*report); err != nil {
+				printError(err)
+				exit(1)
+			}
+		}
+		if opts.InProject {
+			if err := enterProjectRoot(); err != nil {
+				printError(err)
+				exit(1)
+			}
+			if err := usePinnedIntegrity(); err != nil {
+				printError(err)
+				exit(1)
+			}
+		}
+		if opts.InProject && !opts.SaveBundle && *fromDir == "" {
+			if err := useVendor(opts.Vendored); err != nil {
+				printError(err)
+				exit(1)
+			}
+		}
 		if pkgName == "" {
-			fmt.Println("Provide package name")
-			os.Exit(1)
+			warnStaleIndex("")
+			err = installEnvironment(ctx, *env, opts)
+			stopwatch.print(*timings)
+			var integrityErr *IntegrityError
+			if errors.As(err, &integrityErr) {
+				printError(err)
+				exit(exitIntegrity)
+			}
+			if err != nil {
+				printError(err)
+				exit(1)
+			}
+			if opts.LockfileOnly {
+				notify("", "Updated %s", lockFile)
+			} else if !opts.Events && !opts.DryRun {
+				fmt.Println("Installed environment", envName(*env))
+			}
+			if *report != "" && !opts.DryRun {
+				if err := writeSBOM(*report); err != nil {
+					printError(err)
+					exit(1)
+				}
+			}
+			return
+		}
+		pkgName, err = pickInstallTarget(pkgName, !opts.Events && !opts.JSON && stdinIsTerminal())
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		pkgName = replacedSpec(pkgName)
+		if *env != "" {
+			if pkgName, err = environmentSpec(pkgName, *env); err != nil {
+				printError(err)
+				exit(1)
+			}
+		}
+		if _, version := splitSpec(pkgName); version == "" {
+			warnStaleIndex(pkgName)
+		} else {
+			warnStaleIndex("")
+		}
+		err = install(ctx, pkgName, opts)
+		stopwatch.print(*timings)
+		if err != nil && opts.Events {
+			emit(Event{Type: "error", Package: pkgName, Error: err.Error()})
+			exit(1)
+		}
+		var integrityErr *IntegrityError
+		if errors.As(err, &integrityErr) {
+			printError(err)
+			exit(exitIntegrity)
+		}
+		if err != nil {
+			printError(err)
+			exit(1)
+		}
+		if opts.LockfileOnly {
+			notify("", "Updated %s", lockFile)
+		} else if !opts.Events && !opts.DryRun {
+			fmt.Println("Installed", pkgName)
+		}
+		if *report != "" && !opts.DryRun {
+			if err := writeSBOM(*report); err != nil {
+				printError(err)
+				exit(1)
+			}
+		}
+	case "ci":
+		jobs := flag.Int("jobs", runtime.NumCPU(), "Number of packages to verify in parallel")
+		flag.BoolVar(&noOptional, "no-optional", false, "Warn when "+lockFile+" was resolved with optional dependencies")
+		fromDir := flag.String("from-dir", "", "Install offline from a directory of tarballs and index.json")
+		flag.BoolVar(&noProgress, "no-progress", false, "Do not show download progress")
+		flag.IntVar(&stripComponents, "strip-components", -1, "Drop this many leading directories from archive entries (default: a directory named after the package)")
+		flag.BoolVar(&noPreserveMtime, "no-preserve-mtime", false, "Give extracted files the current time")
+		flag.StringVar(&checksumAlgo, "checksum-algo", "sha256", "Digest to record for new downloads (sha256, sha384, sha512)")
+		flag.BoolVar(&allowWeakChecksums, "allow-weak-checksums", false, "Accept md5 and sha1 integrity strings")
+		timings := timingsOption()
+		flag.CommandLine.Parse(args)
+		if *timings != "" {
+			startStopwatch()
+		}
+		if _, err := newDigest(checksumAlgo); err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+		if *fromDir != "" {
+			if err := useLocalRegistry(*fromDir); err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+		}
+		if err := enterProjectRoot(); err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+		if err := usePinnedIntegrity(); err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+		if *fromDir == "" {
+			if err := useVendor(false); err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+		}
+		err := ci(ctx, *jobs)
+		stopwatch.print(*timings)
+		var integrityErr *IntegrityError
+		if errors.As(err, &integrityErr) {
+			fmt.Println(err)
+			exit(exitIntegrity)
 		}
-		err := install(pkgName, *inProject)
 		if err != nil {
 			fmt.Println(err)
-			os.Exit(1)
+			exit(1)
 		}
-		fmt.Println("Installed", pkgName)
+		fmt.Println("Installed dependencies from", lockFile)
 	case "remove":
-		if len(args) < 1 {
+		exact := flag.Bool("exact-match", false, "Only remove a package named exactly as given, not its versioned installs")
+		inProject := flag.Bool("in-project", false, "Remove from the project")
+		global := flag.Bool("global", false, "Remove a global install (overrides default-scope)")
+		flag.CommandLine.Parse(args)
+		if flag.NArg() < 1 {
 			fmt.Println("Provide package name")
-			os.Exit(1)
+			exit(1)
+		}
+		project, err := projectScope(*inProject, *global)
+		if err == nil && project {
+			err = enterProjectRoot()
 		}
-		err := remove(args[0])
 		if err != nil {
 			fmt.Println(err)
-			os.Exit(1)
+			exit(1)
+		}
+		removed, err := remove(flag.Arg(0), *exact, project)
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+		fmt.Println("Removed", removed)
+	case "clean":
+		var opts CleanOptions
+		flag.BoolVar(&opts.InProject, "in-project", false, "Clean the project's dependencies")
+		flag.BoolVar(&opts.KeepInstalled, "keep-installed", false, "Keep the archives of installed packages")
+		flag.CommandLine.Parse(args)
+		if opts.InProject {
+			if err := enterProjectRoot(); err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+		}
+		if err := clean(opts); err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "list":
+		var opts ListOptions
+		flag.BoolVar(&opts.InProject, "in-project", false, "List the project's dependencies")
+		flag.BoolVar(&opts.Tree, "tree", false, "Show packages with their dependencies nested")
+		flag.IntVar(&opts.Depth, "depth", defaultMaxDepth, "With --tree, how many levels of dependencies to show")
+		flag.BoolVar(&opts.Outdated, "outdated", false, "List packages with newer versions published")
+		flag.BoolVar(&opts.Fix, "fix", false, "With --outdated, update packages within their constraints, asking which on a terminal")
+		flag.CommandLine.Parse(args)
+		if opts.Fix && !opts.Outdated {
+			fmt.Println("--fix needs --outdated")
+			exit(1)
+		}
+		if opts.InProject {
+			if err := enterProjectRoot(); err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+		}
+		err := listPackages(ctx, opts)
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
 		}
-		fmt.Println("Removed", args[0])
 	case "update":
-		err := update()
+		noResume := flag.Bool("no-resume", false, "Ignore progress from an interrupted update")
+		env := flag.String("env", "", "Re-resolve the project's dependencies for this environment of "+manifestFile)
+		flag.CommandLine.Parse(args)
+		if *env != "" {
+			err := enterProjectRoot()
+			if err == nil {
+				err = usePinnedIntegrity()
+			}
+			if err == nil {
+				err = updateEnvironment(ctx, *env)
+			}
+			if err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+			fmt.Println("Updated environment", *env)
+			return
+		}
+		err := update(ctx, *noResume)
 		if err != nil {
 			fmt.Println(err)
-			os.Exit(1)
+			exit(1)
 		}
 	case "upgrade":
-		err := upgrade()
+		check := flag.Bool("check", false, "Only check whether a newer version exists")
+		flag.CommandLine.Parse(args)
+		err := upgrade(ctx, *check)
 		if err != nil {
 			fmt.Println(err)
-			os.Exit(1)
+			exit(1)
 		}
 	case "refresh":
-		err := refresh()
+		checkOnly := flag.Bool("check-only", false, "Validate the index without replacing the cache")
+		fromDir := flag.String("from-dir", "", "Read index.json from a local bundle directory")
+		full := flag.Bool("full", false, "Fetch the whole index instead of the changes since the last refresh")
+		flag.CommandLine.Parse(args)
+		if *fromDir != "" {
+			if err := useLocalRegistry(*fromDir); err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+		}
+		err := refresh(ctx, *checkOnly, *full)
 		if err != nil {
 			fmt.Println(err)
-			os.Exit(1)
+			exit(1)
 		}
 	case "search":
-		if len(args) < 1 {
+		var opts SearchOptions
+		flag.StringVar(&opts.Sort, "sort", "relevance", "Order results by relevance, downloads, updated or name")
+		flag.IntVar(&opts.Limit, "limit", 0, "Show at most this many results")
+		flag.BoolVar(&opts.Exact, "exact", false, "Only match the exact package name and fail if it does not exist")
+		flag.BoolVar(&opts.JSON, "json", false, "Print results as JSON")
+		flag.CommandLine.Parse(args)
+		warningsQuiet = opts.JSON
+		if flag.NArg() < 1 {
 			fmt.Println("Provide query")
-			os.Exit(1)
+			exit(1)
+		}
+		warnStaleIndex("")
+		err := search(strings.Join(flag.Args(), " "), opts)
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "run":
+		name, extra, err := splitRunArgs(args)
+		if err != nil {
+			fmt.Println(err)
+			fmt.Println("Usage: vira-packages run [<script> [-- args...]]")
+			exit(1)
+		}
+		err = enterProjectRoot()
+		if err == nil {
+			err = runScript(name, extra)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exit(exitErr.ExitCode())
+		}
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "deps":
+		inProject := flag.Bool("in-project", false, "Look for installed copies in the project")
+		asJSON := flag.Bool("json", false, "Print the dependencies as JSON")
+		flag.CommandLine.Parse(args)
+		warningsQuiet = *asJSON
+		if flag.NArg() < 1 {
+			fmt.Println("Provide package name")
+			exit(1)
+		}
+		if *inProject {
+			if err := enterProjectRoot(); err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+		}
+		list, err := declaredDependencies(flag.Arg(0), depsDir(*inProject))
+		if err == nil {
+			err = printDependencyList(list, *asJSON)
+		}
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "sbom":
+		out := flag.String("out", "", "Write the SBOM to this file instead of stdout")
+		flag.CommandLine.Parse(args)
+		path := *out
+		if path != "" {
+			var err error
+			if path, err = filepath.Abs(path); err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+		}
+		if err := enterProjectRoot(); err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+		if err := writeSBOM(path); err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "diff":
+		asJSON := flag.Bool("json", false, "Print the changes as JSON")
+		flag.CommandLine.Parse(args)
+		warningsQuiet = *asJSON
+		against := flag.Arg(0)
+		if against != "" {
+			var err error
+			if against, err = filepath.Abs(against); err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+		}
+		if err := enterProjectRoot(); err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+		if err := lockDiff(against, *asJSON); err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "info":
+		if len(args) < 1 {
+			fmt.Println("Provide package name")
+			exit(1)
+		}
+		warnStaleIndex("")
+		err := info(args[0])
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "version", "--version":
+		asJSON := flag.Bool("json", false, "Print version information as JSON")
+		flag.CommandLine.Parse(args)
+		err := printVersion(*asJSON)
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "config":
+		if len(args) < 1 {
+			fmt.Println("Usage: vira-packages config get|set|unset|list [args]")
+			exit(1)
+		}
+		showSecrets := flag.Bool("show-secrets", false, "Show secret values such as tokens")
+		force := flag.Bool("force", false, "Allow setting unknown keys")
+		flag.CommandLine.Parse(args[1:])
+		var err error
+		switch sub := args[0]; {
+		case sub == "list":
+			err = configList(*showSecrets)
+		case sub == "get" && flag.NArg() == 1:
+			err = configGet(flag.Arg(0), *showSecrets)
+		case sub == "set" && flag.NArg() == 2:
+			err = configSet(flag.Arg(0), flag.Arg(1), *force)
+		case sub == "unset" && flag.NArg() == 1:
+			err = configUnset(flag.Arg(0))
+		default:
+			fmt.Println("Usage: vira-packages config get <key> | set <key> <value> | unset <key> | list")
+			exit(1)
+		}
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "fetch":
+		out := flag.String("out", "vira-bundle", "Directory to write the offline bundle to")
+		maxDepth := flag.Int("max-depth", configuredMaxDepth(), "Maximum dependency chain length")
+		flag.BoolVar(&noProgress, "no-progress", false, "Do not show download progress")
+		flag.CommandLine.Parse(args)
+		if flag.NArg() < 1 {
+			fmt.Println("Provide package name")
+			exit(1)
+		}
+		fetched, complete, err := fetchBundle(ctx, flag.Args(), *out, *maxDepth)
+		if err == nil {
+			fmt.Printf("Fetched %d packages into %s (%d already complete)\n", fetched, *out, complete)
+		}
+		var integrityErr *IntegrityError
+		if errors.As(err, &integrityErr) {
+			fmt.Println(err)
+			exit(exitIntegrity)
+		}
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "bundle":
+		out := flag.String("out", "vira-bundle.tar", "File to write the bundle to")
+		maxDepth := flag.Int("max-depth", configuredMaxDepth(), "Maximum dependency chain length")
+		flag.BoolVar(&noProgress, "no-progress", false, "Do not show download progress")
+		flag.CommandLine.Parse(args)
+		path, err := filepath.Abs(*out)
+		specs := flag.Args()
+		if err == nil && len(specs) == 0 {
+			specs, err = projectBundleSpecs()
+		}
+		if err == nil {
+			err = writeBundle(ctx, specs, path, *maxDepth)
+		}
+		var integrityErr *IntegrityError
+		if errors.As(err, &integrityErr) {
+			fmt.Println(err)
+			exit(exitIntegrity)
+		}
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "migrate":
+		err := migrate()
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "pack":
+		force := flag.Bool("force", false, "Pack even if the package fails publish checks")
+		flag.CommandLine.Parse(args)
+		err := pack(*force)
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "verify":
+		fromRegistry := flag.Bool("registry", false, "Compare installed packages with what the registry publishes")
+		inProject := flag.Bool("in-project", false, "Verify the project's dependencies")
+		asJSON := flag.Bool("json", false, "Print the report as JSON")
+		flag.CommandLine.Parse(args)
+		warningsQuiet = *asJSON
+		dir := os.Getenv("HOME") + "/.vira/libs"
+		if *inProject {
+			if err := enterProjectRoot(); err != nil {
+				fmt.Println(err)
+				exit(1)
+			}
+			dir = filepath.Join("build", "dependencies")
+		}
+		results, err := verifyInstalled(dir, *fromRegistry)
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+		failed, err := printVerify(results, *asJSON)
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+		if failed {
+			exit(exitIntegrity)
+		}
+	case "recover":
+		backfill := flag.Bool("backfill-manifest", false, "Add installed packages nothing in "+manifestFile+" needs to its dependencies")
+		env := flag.String("env", "", "Record the lockfile as resolved for this environment of "+manifestFile)
+		flag.CommandLine.Parse(args)
+		err := enterProjectRoot()
+		if err == nil {
+			err = recoverProject(*env, *backfill)
+		}
+		if err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+	case "audit":
+		pkgName := flag.String("package", "", "Only show entries for this package")
+		sinceArg := flag.String("since", "", "Only show entries on or after this date")
+		untilArg := flag.String("until", "", "Only show entries on or before this date")
+		flag.CommandLine.Parse(args)
+		since, err := parseAuditDate(*sinceArg, false)
+		if err != nil {
+			fmt.Println("Invalid --since:", err)
+			exit(1)
+		}
+		until, err := parseAuditDate(*untilArg, true)
+		if err != nil {
+			fmt.Println("Invalid --until:", err)
+			exit(1)
 		}
-		err := search(args[0])
+		err = audit(*pkgName, since, until)
 		if err != nil {
 			fmt.Println(err)
-			os.Exit(1)
+			exit(1)
 		}
 	default:
 		fmt.Println("Unknown command")
-		os.Exit(1)
+		exit(1)
 	}
 }
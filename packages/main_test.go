@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed []string
+		arg       string
+		exact     bool
+		want      string
+		wantErr   string
+		wantLeft  []string
+	}{
+		{"single match", []string{"math", "mathx"}, "math", false, "math", "", []string{"mathx"}},
+		{"single versioned install", []string{"math@1.2.0", "io"}, "math", false, "math@1.2.0", "", []string{"io"}},
+		{"versioned removal", []string{"math@1.2.0", "math@2.0.0"}, "math@1.2.0", false, "math@1.2.0", "", []string{"math@2.0.0"}},
+		{"ambiguous", []string{"math@1.2.0", "math@2.0.0"}, "math", false, "", "math is ambiguous, specify one of: math@1.2.0, math@2.0.0", []string{"math@1.2.0", "math@2.0.0"}},
+		{"plain and versioned are ambiguous", []string{"math", "math@2.0.0"}, "math", false, "", "ambiguous", []string{"math", "math@2.0.0"}},
+		{"exact skips versioned installs", []string{"math", "math@2.0.0"}, "math", true, "math", "", []string{"math@2.0.0"}},
+		{"exact refuses a versioned install", []string{"math@2.0.0"}, "math", true, "", "math is not installed", []string{"math@2.0.0"}},
+		{"prefix is not a match", []string{"mathx"}, "math", false, "", "math is not installed", []string{"mathx"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := testHome(t)
+			libs := filepath.Join(home, ".vira", "libs")
+			for _, name := range tt.installed {
+				os.MkdirAll(filepath.Join(libs, name), 0755)
+				os.WriteFile(filepath.Join(libs, name+".tar.gz"), []byte(name), 0644)
+			}
+			removed, err := remove(tt.arg, tt.exact, false)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("remove(%q) = %v, want an error containing %q", tt.arg, err, tt.wantErr)
+				}
+			} else if err != nil || removed != tt.want {
+				t.Fatalf("remove(%q) = %q, %v, want %q", tt.arg, removed, err, tt.want)
+			}
+			left, err := listInstalled(libs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(left)
+			if !slices.Equal(left, tt.wantLeft) {
+				t.Errorf("left installed %v, want %v", left, tt.wantLeft)
+			}
+		})
+	}
+}
+
+// chunkedTransport records how responses were framed.
+type chunkedTransport struct {
+	mu      sync.Mutex
+	base    http.RoundTripper
+	lengths []int64
+	chunked []bool
+}
+
+func (c *chunkedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := c.base.RoundTrip(req)
+	if err == nil {
+		c.mu.Lock()
+		c.lengths = append(c.lengths, resp.ContentLength)
+		c.chunked = append(c.chunked, slices.Equal(resp.TransferEncoding, []string{"chunked"}))
+		c.mu.Unlock()
+	}
+	return resp, err
+}
+
+// chunkedRegistry serves body for every path in small flushed chunks, so
+// responses go out with chunked encoding and no Content-Length, and makes
+// it the registry.
+func chunkedRegistry(t *testing.T, body []byte) *chunkedTransport {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for rest := body; len(rest) > 0; {
+			n := min(len(rest), 64)
+			w.Write(rest[:n])
+			w.(http.Flusher).Flush()
+			rest = rest[n:]
+		}
+	}))
+	t.Cleanup(server.Close)
+	transport := &chunkedTransport{base: server.Client().Transport}
+	useClient(t, &http.Client{Transport: transport})
+	registryOverride = server.URL + "/"
+	t.Cleanup(func() { registryOverride = "" })
+	return transport
+}
+
+func TestDownloadChunkedWithoutContentLength(t *testing.T) {
+	var entries []tarEntry
+	for _, name := range []string{"a", "b", "c", "d"} {
+		entries = append(entries, tarEntry{name: "math/" + name + ".vira", body: strings.Repeat(name, 300)})
+	}
+	archive := gzipBytes(t, makeTar(t, entries))
+	sum := sha256.Sum256(archive)
+	integrity := "sha256-" + hex.EncodeToString(sum[:])
+	downloads := []struct {
+		name     string
+		download func(t *testing.T, destDir string) (PlatformEntry, error)
+	}{
+		{"downloadPackage", func(t *testing.T, destDir string) (PlatformEntry, error) {
+			return downloadPackage(t.Context(), "math", destDir)
+		}},
+		{"streamPackage", func(t *testing.T, destDir string) (PlatformEntry, error) {
+			return streamPackage(t.Context(), "math", registryURL()+"math.tar.gz", destDir, "")
+		}},
+	}
+	sizes := []struct {
+		name    string
+		size    int64 // declared by the index
+		wantErr string
+	}{
+		{"no declared size", 0, ""},
+		{"declared size fits", int64(len(archive)), ""},
+		{"declared size too large", 1 << 60, "not enough disk space for math"},
+	}
+	for _, d := range downloads {
+		for _, sz := range sizes {
+			t.Run(d.name+"/"+sz.name, func(t *testing.T) {
+				home := testHome(t)
+				noProgress = true
+				defer func() { noProgress = false }()
+				writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+					"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Integrity: integrity, Size: sz.size}}},
+				}})
+				transport := chunkedRegistry(t, archive)
+				destDir := t.TempDir()
+
+				resolved, err := d.download(t, destDir)
+				if len(transport.lengths) != 1 || transport.lengths[0] != -1 || !transport.chunked[0] {
+					t.Fatalf("responses had lengths %v and chunked %v, want one chunked response of unknown length", transport.lengths, transport.chunked)
+				}
+				if sz.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), sz.wantErr) {
+						t.Fatalf("got %v, want an error containing %q", err, sz.wantErr)
+					}
+					if left, _ := filepath.Glob(filepath.Join(destDir, "*")); len(left) != 0 {
+						t.Errorf("a refused download left %v", left)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !sameIntegrity(resolved.Integrity, integrity) {
+					t.Errorf("integrity %s, want %s", resolved.Integrity, integrity)
+				}
+				if got, err := os.ReadFile(filepath.Join(destDir, "math.tar.gz")); err != nil || string(got) != string(archive) {
+					t.Errorf("archive on disk differs from the one served: %v", err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const manifestFile = "bytes.yml"
+
+// maxProjectDepth bounds how many parent directories findProjectRoot
+// searches for a manifest.
+const maxProjectDepth = 32
+
+// yamlNode is a value from bytes.yml: a scalar, a list of scalars or a
+// mapping whose key order is kept in Keys.
+type yamlNode struct {
+	Value string
+	List  []string
+	Keys  []string
+	Map   map[string]*yamlNode
+}
+
+func (n *yamlNode) set(key string, child *yamlNode) {
+	if n.Map == nil {
+		n.Map = map[string]*yamlNode{}
+	}
+	if _, ok := n.Map[key]; !ok {
+		n.Keys = append(n.Keys, key)
+	}
+	n.Map[key] = child
+}
+
+func (n *yamlNode) get(key string) *yamlNode {
+	if n == nil || n.Map == nil {
+		return nil
+	}
+	return n.Map[key]
+}
+
+// scalars returns a mapping of scalar values, e.g. a dependency table.
+func (n *yamlNode) scalars() map[string]string {
+	out := map[string]string{}
+	if n == nil {
+		return out
+	}
+	for _, k := range n.Keys {
+		out[k] = n.Map[k].Value
+	}
+	return out
+}
+
+// constraints returns a dependency table as name to version constraint.
+// An entry may be a mapping such as { version: "^1.2", integrity: ... },
+// whose version is used.
+func (n *yamlNode) constraints() map[string]string {
+	out := n.scalars()
+	for name, entry := range out {
+		if entry == "" && n.Map[name].Map != nil {
+			out[name] = n.Map[name].get("version").valueOrEmpty()
+		}
+	}
+	return out
+}
+
+// integrities returns the integrity strings pinned in a dependency table.
+func (n *yamlNode) integrities() map[string]string {
+	out := map[string]string{}
+	if n == nil {
+		return out
+	}
+	for _, name := range n.Keys {
+		if integrity := n.Map[name].get("integrity").valueOrEmpty(); integrity != "" {
+			out[name] = integrity
+		}
+	}
+	return out
+}
+
+// Manifest is the subset of bytes.yml the package manager understands.
+type Manifest struct {
+	Name            string
+	Version         string
+	Dependencies    map[string]string
+	DevDependencies map[string]string
+	Scripts         map[string]string
+	ScriptNames     []string
+	// Vendored makes installs use the copies in vendor/vira.
+	Vendored bool
+	// Environments holds the dependency overlays of each named
+	// environment, from [environments.<name>.dependencies].
+	Environments map[string]map[string]string
+	// Integrity holds the integrity strings pinned for dependencies,
+	// which downloads must match whatever the registry claims.
+	Integrity map[string]string
+
+	root *yamlNode
+}
+
+// parseYAML reads the small YAML dialect used by bytes.yml: nested
+// "key: value" mappings, "- item" lists, comments and TOML-style
+// "[section]" headers, which nest the following top-level keys.
+func parseYAML(data string) (*yamlNode, error) {
+	type frame struct {
+		indent int
+		node   *yamlNode
+	}
+	root := &yamlNode{}
+	section := root
+	stack := []frame{{-1, root}}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := stripComment(scanner.Text())
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+
+		if indent == 0 && strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = &yamlNode{}
+			root.set(strings.TrimSpace(trimmed[1:len(trimmed)-1]), section)
+			stack = []frame{{-1, section}}
+			continue
+		}
+
+		for len(stack) > 1 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1].node
+
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok {
+			parent.List = append(parent.List, unquote(item))
+			continue
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok && len(stack) > 1 && parent.Map == nil && parent.List == nil {
+			// A scalar on its own line below its key, as in "<>:\n  cmd".
+			parent.Value = unquote(trimmed)
+			continue
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key: value", manifestFile, lineNo)
+		}
+		child := &yamlNode{Value: unquote(strings.TrimSpace(value))}
+		if flow, ok := strings.CutPrefix(child.Value, "{"); ok {
+			node, err := parseFlowMapping(flow)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", manifestFile, lineNo, err)
+			}
+			child = node
+		}
+		parent.set(strings.TrimSpace(key), child)
+		if child.Value == "" {
+			stack = append(stack, frame{indent, child})
+		}
+	}
+	return root, scanner.Err()
+}
+
+// parseFlowMapping reads the rest of an inline "{ key: value, ... }"
+// mapping of scalars after its opening brace.
+func parseFlowMapping(s string) (*yamlNode, error) {
+	body, ok := strings.CutSuffix(strings.TrimSpace(s), "}")
+	if !ok {
+		return nil, fmt.Errorf("unterminated inline mapping")
+	}
+	node := &yamlNode{Map: map[string]*yamlNode{}}
+	for _, pair := range strings.Split(body, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("expected key: value in inline mapping")
+		}
+		node.set(strings.TrimSpace(key), &yamlNode{Value: unquote(strings.TrimSpace(value))})
+	}
+	return node, nil
+}
+
+func stripComment(line string) string {
+	if strings.HasPrefix(strings.TrimSpace(line), "#") {
+		return ""
+	}
+	if i := strings.Index(line, " #"); i >= 0 && !strings.ContainsAny(line[:i], `"'`) {
+		return line[:i]
+	}
+	return line
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func loadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseYAML(string(data))
+	if err != nil {
+		return nil, err
+	}
+	schema, err := manifestSchemaVersion(root)
+	if err != nil {
+		return nil, err
+	}
+	if schema > manifestSchema {
+		return nil, newerSchemaError(schema)
+	}
+	m := &Manifest{
+		Name:            root.get("name").valueOrEmpty(),
+		Version:         root.get("version").valueOrEmpty(),
+		Dependencies:    root.get("dependencies").constraints(),
+		DevDependencies: root.get("dev-dependencies").constraints(),
+		Scripts:         root.get("scripts").scalars(),
+		Vendored:        root.get("vendored").valueOrEmpty() == "true",
+		root:            root,
+	}
+	if scripts := root.get("scripts"); scripts != nil {
+		m.ScriptNames = scripts.Keys
+	}
+	m.Environments = parseEnvironments(root)
+	m.Integrity = root.get("dependencies").integrities()
+	maps.Copy(m.Integrity, root.get("dev-dependencies").integrities())
+	return m, nil
+}
+
+func (n *yamlNode) valueOrEmpty() string {
+	if n == nil {
+		return ""
+	}
+	return n.Value
+}
+
+// findProjectRoot returns the nearest directory at or above start that
+// holds a bytes.yml, the way git finds .git.
+func findProjectRoot(start string) (string, error) {
+	dir, err := filepath.Abs(start)
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i <= maxProjectDepth; i++ {
+		if _, err := os.Stat(filepath.Join(dir, manifestFile)); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return "", fmt.Errorf("no %s found in %s or its parent directories; run this inside a project", manifestFile, start)
+}
+
+// enterProjectRoot changes to the project root, so project commands work
+// from any directory inside it.
+func enterProjectRoot() error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	root, err := findProjectRoot(wd)
+	if err != nil {
+		return err
+	}
+	return os.Chdir(root)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindProjectRoot(t *testing.T) {
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	os.WriteFile(filepath.Join(root, manifestFile), []byte("name: app\n"), 0644)
+	nested := filepath.Join(root, "src", "math", "internal")
+	os.MkdirAll(nested, 0755)
+	// A nested package with its own manifest is a project of its own.
+	inner := filepath.Join(root, "examples", "demo")
+	os.MkdirAll(filepath.Join(inner, "cmd"), 0755)
+	os.WriteFile(filepath.Join(inner, manifestFile), []byte("name: demo\n"), 0644)
+	outside, _ := filepath.EvalSymlinks(t.TempDir())
+	tests := []struct {
+		start   string
+		want    string
+		wantErr bool
+	}{
+		{root, root, false},
+		{nested, root, false},
+		{filepath.Join(inner, "cmd"), inner, false},
+		{outside, "", true},
+	}
+	for _, tt := range tests {
+		got, err := findProjectRoot(tt.start)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "no "+manifestFile+" found") {
+				t.Errorf("findProjectRoot(%s) = %q, %v, want an error", tt.start, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("findProjectRoot(%s) = %q, %v, want %q", tt.start, got, err, tt.want)
+		}
+	}
+}
+
+func TestEnterProjectRootFromSubdirectory(t *testing.T) {
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	os.WriteFile(filepath.Join(root, manifestFile), []byte("name: app\n"), 0644)
+	nested := filepath.Join(root, "src", "math")
+	os.MkdirAll(nested, 0755)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(nested); err != nil {
+		t.Fatal(err)
+	}
+	if err := enterProjectRoot(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.Getwd(); got != root {
+		t.Errorf("working directory %s, want the project root %s", got, root)
+	}
+	// Relative project paths now resolve against the root.
+	if _, err := loadManifest(manifestFile); err != nil {
+		t.Errorf("manifest not found from the root: %v", err)
+	}
+}
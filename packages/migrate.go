@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// manifestSchema is the bytes.yml schema version this build writes and
+// understands. Manifests without schema-version are version 1.
+const manifestSchema = 2
+
+// manifestMigrations upgrade the lines of a manifest from schema version
+// i+1 to i+2.
+var manifestMigrations = []func(lines []string) []string{
+	migrateDevDependencies,
+}
+
+// manifestSchemaVersion reads schema-version from a parsed manifest.
+func manifestSchemaVersion(root *yamlNode) (int, error) {
+	s := root.get("schema-version").valueOrEmpty()
+	if s == "" {
+		return 1, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("%s: invalid schema-version %q", manifestFile, s)
+	}
+	return v, nil
+}
+
+// migrateDevDependencies renames the camelCase and snake_case spellings of
+// dev-dependencies accepted by early tooling.
+func migrateDevDependencies(lines []string) []string {
+	for i, line := range lines {
+		for _, old := range []string{"devDependencies", "dev_dependencies"} {
+			if strings.HasPrefix(line, old+":") {
+				lines[i] = "dev-dependencies" + strings.TrimPrefix(line, old)
+			} else if strings.TrimSpace(line) == "["+old+"]" {
+				lines[i] = "[dev-dependencies]"
+			}
+		}
+	}
+	return lines
+}
+
+// setManifestKey writes a top-level "key: value" line into manifest lines,
+// in place if the key exists and otherwise after name and version. Top-level
+// keys must come before the first [section] header.
+func setManifestKey(lines []string, key string, value string) []string {
+	line := key + ": " + value
+	at := 0
+	for i, l := range lines {
+		if strings.HasPrefix(l, key+":") {
+			lines[i] = line
+			return lines
+		}
+		if strings.HasPrefix(l, "[") {
+			break
+		}
+		if strings.HasPrefix(l, "name:") || strings.HasPrefix(l, "version:") {
+			at = i + 1
+		}
+	}
+	return append(lines[:at], append([]string{line}, lines[at:]...)...)
+}
+
+// migrate upgrades bytes.yml in the current directory to manifestSchema,
+// keeping the previous file as bytes.yml.bak.
+func migrate() error {
+	data, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return err
+	}
+	root, err := parseYAML(string(data))
+	if err != nil {
+		return err
+	}
+	from, err := manifestSchemaVersion(root)
+	if err != nil {
+		return err
+	}
+	if from > manifestSchema {
+		return newerSchemaError(from)
+	}
+	if from == manifestSchema {
+		fmt.Printf("%s is already at schema version %d\n", manifestFile, manifestSchema)
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for _, m := range manifestMigrations[from-1:] {
+		lines = m(lines)
+	}
+	lines = setManifestKey(lines, "schema-version", strconv.Itoa(manifestSchema))
+	if err := os.WriteFile(manifestFile+".bak", data, 0644); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(manifestFile, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Migrated %s from schema version %d to %d (backup in %s.bak)\n", manifestFile, from, manifestSchema, manifestFile)
+	return nil
+}
+
+func newerSchemaError(v int) error {
+	return fmt.Errorf("%s uses schema version %d, but this vira-packages only supports up to %d; run upgrade to get a newer version", manifestFile, v, manifestSchema)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestManifestMigrations(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			"camelCase key",
+			"name: app\nversion: 1.0.0\ndevDependencies:\n  test: ^1",
+			"name: app\nversion: 1.0.0\nschema-version: 2\ndev-dependencies:\n  test: ^1",
+		},
+		{
+			"snake_case section",
+			"name: app\n\n[dev_dependencies]\ntest: \"^1\"",
+			"name: app\nschema-version: 2\n\n[dev-dependencies]\ntest: \"^1\"",
+		},
+		{
+			"existing schema-version",
+			"schema-version: 1\nname: app",
+			"schema-version: 2\nname: app",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := strings.Split(tt.in, "\n")
+			for _, m := range manifestMigrations {
+				lines = m(lines)
+			}
+			lines = setManifestKey(lines, "schema-version", "2")
+			if want := strings.Split(tt.want, "\n"); !slices.Equal(lines, want) {
+				t.Errorf("migrated to\n%s\nwant\n%s", strings.Join(lines, "\n"), tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestSchemaVersion(t *testing.T) {
+	tests := []struct {
+		manifest string
+		want     int
+		wantErr  bool
+	}{
+		{"name: app", 1, false},
+		{"schema-version: 2", 2, false},
+		{"schema-version: two", 0, true},
+		{"schema-version: 0", 0, true},
+	}
+	for _, tt := range tests {
+		root, err := parseYAML(tt.manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := manifestSchemaVersion(root)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("manifestSchemaVersion(%q) = %d, %v", tt.manifest, got, err)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// OutdatedEntry is an installed package with a newer version published.
+// Wanted is the newest version an update may move to: what the manifest's
+// constraints resolve to in a project, the latest or channel version for a
+// global install. Latest may lie beyond it.
+type OutdatedEntry struct {
+	Name      string `json:"name"`
+	Installed string `json:"installed"`
+	Current   string `json:"current"`
+	Wanted    string `json:"wanted"`
+	Latest    string `json:"latest"`
+}
+
+// fixable reports whether an update within constraints changes anything.
+func (e OutdatedEntry) fixable() bool {
+	return versionOrder(e.Current, e.Wanted) < 0
+}
+
+// outdatedPackages compares what is installed in dir with the cached
+// index. Overrides, packages the index does not know and global installs
+// pinned to a version are left out.
+func outdatedPackages(dir string, inProject bool) ([]OutdatedEntry, error) {
+	index, err := loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	installed, err := listInstalled(dir)
+	if err != nil {
+		return nil, err
+	}
+	var wanted map[string]string
+	if inProject {
+		if wanted, err = projectWanted(index); err != nil {
+			return nil, err
+		}
+	}
+	var entries []OutdatedEntry
+	for _, full := range slices.Sorted(slices.Values(installed)) {
+		p := readInstalled(dir, full)
+		if _, ok := overrideFor(p.name); ok {
+			continue
+		}
+		pkg, ok := index.lookup(p.name)
+		if !ok || p.version == "" {
+			continue
+		}
+		e := OutdatedEntry{Name: p.name, Installed: full, Current: p.version, Latest: pkg.Latest}
+		switch {
+		case inProject:
+			if e.Wanted = wanted[p.name]; e.Wanted == "" {
+				e.Wanted = p.version
+			}
+		case !strings.Contains(full, "@"):
+			e.Wanted = pkg.Latest
+		case followsChannel(dir, full) != "":
+			e.Wanted = pickVersion(pkg, followsChannel(dir, full))
+		default:
+			continue
+		}
+		if versionOrder(e.Current, e.Latest) < 0 || e.fixable() {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// projectWanted resolves the manifest's dependencies, for the environment
+// bytes.lock was resolved for, the way install would pick them now.
+func projectWanted(index *Index) (map[string]string, error) {
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := readLock(lockFile)
+	if err != nil {
+		return nil, err
+	}
+	deps, err := environmentDependencies(m, lock.Environment)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(deps, m.DevDependencies)
+	wanted := map[string]string{}
+	for _, name := range slices.Sorted(maps.Keys(deps)) {
+		res, err := resolveDependencies(index, dependencySpec(index, name, deps[name]), configuredMaxDepth())
+		if err != nil {
+			continue
+		}
+		for _, dep := range res.Packages {
+			if _, ok := wanted[dep.Name]; !ok {
+				wanted[dep.Name] = dep.Version
+			}
+		}
+	}
+	return wanted, nil
+}
+
+func printOutdated(entries []OutdatedEntry) {
+	if len(entries) == 0 {
+		fmt.Println("All packages are up to date")
+		return
+	}
+	fmt.Printf("%-20s %-10s %-10s %-10s\n", "Package", "Current", "Wanted", "Latest")
+	for _, e := range entries {
+		fmt.Printf("%-20s %-10s %-10s %-10s\n", e.Name, e.Current, e.Wanted, e.Latest)
+	}
+}
+
+// selectUpdates picks which outdated packages to update: every one that
+// can move within its constraints, or on a terminal the ones the user
+// chooses among those.
+func selectUpdates(candidates []OutdatedEntry, interactive bool) ([]OutdatedEntry, error) {
+	var fixable []OutdatedEntry
+	for _, e := range candidates {
+		if e.fixable() {
+			fixable = append(fixable, e)
+		}
+	}
+	if !interactive || len(fixable) == 0 {
+		return fixable, nil
+	}
+	for i, e := range fixable {
+		fmt.Printf("  %d) %s %s → %s\n", i+1, e.Name, e.Current, e.Wanted)
+	}
+	fmt.Print("Update which? (numbers or ranges such as 1,3-4, a for all, empty for none) ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, nil
+	}
+	line = strings.TrimSpace(line)
+	if line == "a" || line == "all" {
+		return fixable, nil
+	}
+	picked := map[int]bool{}
+	for _, part := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' }) {
+		from, to, isRange := strings.Cut(part, "-")
+		lo, err := strconv.Atoi(from)
+		hi := lo
+		if err == nil && isRange {
+			hi, err = strconv.Atoi(to)
+		}
+		if err != nil || lo < 1 || hi > len(fixable) || lo > hi {
+			return nil, fmt.Errorf("invalid selection %q", part)
+		}
+		for n := lo; n <= hi; n++ {
+			picked[n-1] = true
+		}
+	}
+	var selected []OutdatedEntry
+	for i, e := range fixable {
+		if picked[i] {
+			selected = append(selected, e)
+		}
+	}
+	return selected, nil
+}
+
+// applyUpdates moves each entry to its wanted version with the update
+// machinery: updatePackage for global installs, and in a project a fresh
+// install of the wanted version whose lock entry replaces the old one.
+func applyUpdates(ctx context.Context, entries []OutdatedEntry, dir string, inProject bool) error {
+	for _, e := range entries {
+		var err error
+		if inProject {
+			err = updateProjectPackage(ctx, e)
+		} else {
+			err = updatePackage(ctx, dir, e.Installed)
+		}
+		if err != nil {
+			return fmt.Errorf("update of %s failed: %v", e.Name, err)
+		}
+		fmt.Printf("Updated %s %s → %s\n", e.Name, e.Current, e.Wanted)
+	}
+	return nil
+}
+
+func updateProjectPackage(ctx context.Context, e OutdatedEntry) error {
+	if lock, err := readLock(lockFile); err == nil {
+		noOptional = lock.NoOptional
+	}
+	spec := e.Name
+	if index, err := loadIndex(); err == nil {
+		spec = dependencySpec(index, e.Name, e.Wanted)
+	}
+	if spec != e.Installed {
+		if err := install(ctx, spec, InstallOptions{InProject: true, MaxDepth: configuredMaxDepth()}); err != nil {
+			return err
+		}
+		_, err := remove(e.Installed, true, true)
+		return err
+	}
+	// Same spec, new bytes: the locked checksum is for the old version.
+	lock, err := readLock(lockFile)
+	if err != nil {
+		return err
+	}
+	delete(lock.Packages, e.Installed)
+	if err := writeLock(lockFile, lock); err != nil {
+		return err
+	}
+	os.RemoveAll(filepath.Join("build", "dependencies", e.Installed))
+	return install(ctx, spec, InstallOptions{InProject: true, MaxDepth: configuredMaxDepth(), Force: true})
+}
+
+// listOutdated is list --outdated, applying updates with --fix.
+func listOutdated(ctx context.Context, dir string, opts ListOptions) error {
+	entries, err := outdatedPackages(dir, opts.InProject)
+	if err != nil {
+		return err
+	}
+	printOutdated(entries)
+	if !opts.Fix {
+		return nil
+	}
+	selected, err := selectUpdates(entries, stdinIsTerminal())
+	if err != nil {
+		return err
+	}
+	if len(selected) == 0 {
+		fmt.Println("Nothing to update within constraints")
+		return nil
+	}
+	return applyUpdates(ctx, selected, dir, opts.InProject)
+}
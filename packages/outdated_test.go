@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// withStdin feeds input to what f reads from stdin.
+func withStdin(t *testing.T, input string, f func()) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString(input)
+	w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+		r.Close()
+	}()
+	f()
+}
+
+// outdatedCandidates has three packages that can move within their
+// constraints and one that is only behind its latest version.
+var outdatedCandidates = []OutdatedEntry{
+	{Name: "http", Installed: "http", Current: "1.0.0", Wanted: "1.2.0", Latest: "2.0.0"},
+	{Name: "io", Installed: "io", Current: "1.0.0", Wanted: "1.0.0", Latest: "2.0.0"},
+	{Name: "json", Installed: "json", Current: "0.3.0", Wanted: "0.4.0", Latest: "0.4.0"},
+	{Name: "math", Installed: "math@1.0.0", Current: "1.0.0", Wanted: "1.0.1", Latest: "1.0.1"},
+}
+
+func entryNames(entries []OutdatedEntry) []string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestSelectUpdatesSelectsAll(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []OutdatedEntry
+		want       []string
+	}{
+		{"every fixable package", outdatedCandidates, []string{"http", "json", "math"}},
+		{"nothing fixable", outdatedCandidates[1:2], nil},
+		{"no candidates", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, _ := captureStdout(t, func() error {
+				got, err := selectUpdates(tt.candidates, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if names := entryNames(got); !slices.Equal(names, tt.want) {
+					t.Errorf("selected %v, want %v", names, tt.want)
+				}
+				return nil
+			})
+			if out != "" {
+				t.Errorf("non-interactive selection printed %q", out)
+			}
+		})
+	}
+}
+
+func TestSelectUpdatesInteractive(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr string
+	}{
+		{"a\n", []string{"http", "json", "math"}, ""},
+		{"all\n", []string{"http", "json", "math"}, ""},
+		{"1,3\n", []string{"http", "math"}, ""},
+		{"2-3\n", []string{"json", "math"}, ""},
+		{"3 1\n", []string{"http", "math"}, ""},
+		{"\n", nil, ""},
+		{"", nil, ""},
+		{"4\n", nil, `invalid selection "4"`},
+		{"3-1\n", nil, `invalid selection "3-1"`},
+		{"x\n", nil, `invalid selection "x"`},
+	}
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.input), func(t *testing.T) {
+			var got []OutdatedEntry
+			var err error
+			out, _ := captureStdout(t, func() error {
+				withStdin(t, tt.input, func() { got, err = selectUpdates(outdatedCandidates, true) })
+				return nil
+			})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := entryNames(got); !slices.Equal(names, tt.want) {
+				t.Errorf("selected %v, want %v", names, tt.want)
+			}
+			// Only fixable packages are offered, numbered in order.
+			if !strings.Contains(out, "1) http 1.0.0 → 1.2.0") || !strings.Contains(out, "3) math 1.0.0 → 1.0.1") || strings.Contains(out, "io") {
+				t.Errorf("prompt:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestListOutdatedFixUpdatesAll(t *testing.T) {
+	updateFixture(t)
+	libs := filepath.Join(os.Getenv("HOME"), ".vira", "libs")
+	out, err := captureStdout(t, func() error {
+		return listOutdated(t.Context(), libs, ListOptions{Fix: true})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"http", "json", "math"} {
+		if !strings.Contains(out, "Updated "+name+" 1.0.0 → 2.0.0") {
+			t.Errorf("output has no update of %s:\n%s", name, out)
+		}
+		if got, _ := os.ReadFile(filepath.Join(libs, name, "lib.vira")); string(got) != "2.0.0" {
+			t.Errorf("%s holds %q after --fix, want 2.0.0", name, got)
+		}
+	}
+	entries, err := outdatedPackages(libs, false)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("still outdated after --fix: %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// loadOverrides returns the package overrides for this run: a name mapped
+// to a local directory or an archive URL to use instead of the registry.
+// Entries come from the overrides table of ~/.vira/config.yml and, taking
+// precedence, from the [overrides] section of bytes.yml. Relative paths
+// are relative to the current directory. The files are read once and the
+// result shared until HOME or the working directory changes; callers must
+// not modify it.
+func loadOverrides() map[string]string {
+	from := overrideSources{config: configPath()}
+	from.manifest, _ = filepath.Abs(manifestFile)
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	if cachedOverrides == nil || overridesFrom != from {
+		cachedOverrides, overridesFrom = readOverrides(from), from
+	}
+	return cachedOverrides
+}
+
+// overrideSources names the files a set of overrides was read from.
+type overrideSources struct {
+	config   string
+	manifest string
+}
+
+var (
+	overridesMu     sync.Mutex
+	cachedOverrides map[string]string
+	overridesFrom   overrideSources
+)
+
+func readOverrides(from overrideSources) map[string]string {
+	overrides := map[string]string{}
+	for _, path := range []string{from.config, from.manifest} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		root, err := parseYAML(string(data))
+		if err != nil {
+			continue
+		}
+		for name, target := range root.get("overrides").scalars() {
+			if target != "" {
+				overrides[name] = target
+			}
+		}
+	}
+	return overrides
+}
+
+func overrideFor(name string) (string, bool) {
+	target, ok := loadOverrides()[name]
+	return target, ok
+}
+
+func isOverrideURL(target string) bool {
+	return strings.Contains(target, "://")
+}
+
+// overrideDependencies reads the dependencies a local override declares in
+// its own bytes.yml.
+func overrideDependencies(target string) map[string]string {
+	m, err := loadManifest(filepath.Join(target, manifestFile))
+	if err != nil {
+		return map[string]string{}
+	}
+	return m.Dependencies
+}
+
+// installOverride installs pkgName from its override: a local directory
+// is linked into destDir so edits show up without reinstalling, a URL is
+// downloaded and unpacked like a registry archive.
+func installOverride(ctx context.Context, pkgName string, target string, destDir string) (PlatformEntry, error) {
+	notify(pkgName, "Using override for %s: %s", pkgName, target)
+	old, _ := filepath.Glob(filepath.Join(destDir, pkgName+".tar.*"))
+	for _, path := range old {
+		os.Remove(path)
+	}
+	if isOverrideURL(target) {
+		ext := ".tar.gz"
+		if i := strings.LastIndex(target, ".tar."); i >= 0 {
+			ext = target[i:]
+		}
+		integrity, err := fetchPackage(ctx, target, filepath.Join(destDir, pkgName+ext))
+		resolved := PlatformEntry{URL: target, Integrity: integrity}
+		if err != nil {
+			return resolved, err
+		}
+		return resolved, unpack(ctx, pkgName, destDir)
+	}
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return PlatformEntry{}, err
+	}
+	resolved := PlatformEntry{URL: "file://" + filepath.ToSlash(abs)}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return resolved, fmt.Errorf("override for %s: %s is not a directory", pkgName, target)
+	}
+	link := filepath.Join(destDir, pkgName)
+	if err := os.RemoveAll(link); err != nil {
+		return resolved, err
+	}
+	return resolved, os.Symlink(abs, link)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstallUsesOverride(t *testing.T) {
+	mathArchive := gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "registry"}}))
+	devArchive := gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "dev build"}}))
+	dev := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(devArchive)
+	}))
+	defer dev.Close()
+	checkout := t.TempDir()
+	os.WriteFile(filepath.Join(checkout, "lib.vira"), []byte("checkout"), 0644)
+	os.WriteFile(filepath.Join(checkout, manifestFile), []byte("name: math\nversion: 2.0.0-dev\n"), 0644)
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"local directory", checkout, "checkout"},
+		{"archive URL", dev.URL + "/math-dev.tar.gz", "dev build"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := testHome(t)
+			noProgress = true
+			defer func() { noProgress = false }()
+			writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+				"app":  {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Dependencies: map[string]string{"math": "^1.0"}}}},
+				"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+			}})
+			reg := newTestRegistry(t, map[string][]byte{
+				"app.tar.gz":  gzipBytes(t, makeTar(t, []tarEntry{{name: "app/main.vira", body: "app"}})),
+				"math.tar.gz": mathArchive,
+			})
+			os.WriteFile(configPath(), []byte("overrides:\n  math: "+tt.target+"\n"), 0644)
+			prefix := t.TempDir()
+
+			out, err := captureStdout(t, func() error {
+				return install(t.Context(), "app", InstallOptions{Prefix: prefix, MaxDepth: 8, NoScripts: true})
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out, "Using override for math: "+tt.target) {
+				t.Errorf("install printed %q, want the override marked", out)
+			}
+			if n := reg.count("math.tar.gz"); n != 0 {
+				t.Errorf("the registry's math was requested %d times", n)
+			}
+			libs, err := globalLibsDir(prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(filepath.Join(libs, "math", "lib.vira")); string(got) != tt.want {
+				t.Errorf("installed math holds %q, want %q", got, tt.want)
+			}
+			if got, _ := os.ReadFile(filepath.Join(libs, "app", "main.vira")); string(got) != "app" {
+				t.Errorf("installed app holds %q", got)
+			}
+		})
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	home := testHome(t)
+	os.MkdirAll(filepath.Join(home, ".vira"), 0755)
+	os.WriteFile(configPath(), []byte("overrides:\n  math: ../math\n  json: https://example.com/json.tar.gz\n"), 0644)
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	os.WriteFile(manifestFile, []byte("name: app\nversion: 0.1.0\noverrides:\n  math: ./vendor/math\n"), 0644)
+
+	want := map[string]string{"math": "./vendor/math", "json": "https://example.com/json.tar.gz"}
+	for name, target := range want {
+		if got, ok := overrideFor(name); !ok || got != target {
+			t.Errorf("overrideFor(%s) = %q, %v, want %q from bytes.yml over config", name, got, ok, target)
+		}
+	}
+	if _, ok := overrideFor("http"); ok {
+		t.Error("http is overridden")
+	}
+
+	// Read once per run: later edits are not picked up.
+	os.WriteFile(manifestFile, []byte("name: app\nversion: 0.1.0\n"), 0644)
+	if got, _ := overrideFor("math"); got != "./vendor/math" {
+		t.Errorf("overrides reread within a run, math is now %q", got)
+	}
+	// Another project reads its own.
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := overrideFor("math"); got != "../math" {
+		t.Errorf("in another directory math is %q, want the config's ../math", got)
+	}
+}
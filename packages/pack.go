@@ -0,0 +1,284 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const ignoreFile = ".viraignore"
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreMatcher applies gitignore-style rules from a .viraignore file.
+// Later rules override earlier ones, so "!keep.txt" can re-include a file
+// excluded by "*.txt".
+type IgnoreMatcher struct {
+	rules []ignoreRule
+}
+
+// loadIgnore reads dir/.viraignore. A missing file gives a matcher with
+// only the built-in rules.
+func loadIgnore(dir string) (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{}
+	m.add(".git/")
+	data, err := os.ReadFile(filepath.Join(dir, ignoreFile))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m.add(line)
+	}
+	return m, nil
+}
+
+func (m *IgnoreMatcher) add(pattern string) {
+	rule := ignoreRule{}
+	if p, ok := strings.CutPrefix(pattern, "!"); ok {
+		rule.negate, pattern = true, p
+	}
+	if p, ok := strings.CutSuffix(pattern, "/"); ok {
+		rule.dirOnly, pattern = true, p
+	}
+	// Patterns without a slash match at any depth, like gitignore.
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var re strings.Builder
+	if !anchored {
+		re.WriteString("(.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	rule.re = regexp.MustCompile("^" + re.String() + "$")
+	m.rules = append(m.rules, rule)
+}
+
+// Match reports whether the slash-separated path relative to the package
+// root is ignored.
+func (m *IgnoreMatcher) Match(path string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(path) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// packDirectory writes dir as a gzipped tarball to out, skipping ignored
+// files and the output file itself. It returns how many files were
+// included and excluded.
+func packDirectory(dir string, out string, ignore *IgnoreMatcher) (int, int, error) {
+	outAbs, err := filepath.Abs(out)
+	if err != nil {
+		return 0, 0, err
+	}
+	file, err := os.Create(out)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+
+	included, excluded := 0, 0
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if abs, _ := filepath.Abs(path); abs == outAbs {
+			return nil
+		}
+		if ignore.Match(rel, d.IsDir()) {
+			if d.IsDir() {
+				excluded += countFiles(path)
+				return filepath.SkipDir
+			}
+			excluded++
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		included++
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return included, excluded, err
+	}
+	if err := tw.Close(); err != nil {
+		return included, excluded, err
+	}
+	return included, excluded, gz.Close()
+}
+
+func countFiles(dir string) int {
+	n := 0
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// validatePackageForPublish checks that the package in dir can be
+// installed once published: bytes.yml names it, its source directory
+// exists, every dependency resolves in index and the version is not
+// already published.
+func validatePackageForPublish(dir string, index *Index) []error {
+	m, err := loadManifest(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return []error{err}
+	}
+	var problems []error
+	if m.Name == "" || m.Version == "" {
+		problems = append(problems, fmt.Errorf("%s must declare name and version", manifestFile))
+	} else if _, n, err := parseVersion(m.Version); err != nil || n != 3 {
+		problems = append(problems, fmt.Errorf("version %q is not of the form major.minor.patch", m.Version))
+	}
+	source := m.root.get("<>").valueOrEmpty()
+	if source == "" {
+		source = "cmd"
+	}
+	if info, err := os.Stat(filepath.Join(dir, source)); err != nil || !info.IsDir() {
+		problems = append(problems, fmt.Errorf("source directory %s does not exist", source))
+	}
+	if index == nil {
+		return append(problems, fmt.Errorf("cannot check dependencies against the registry without an index, run refresh"))
+	}
+	for _, name := range slices.Sorted(maps.Keys(m.Dependencies)) {
+		pkg, ok := index.lookup(name)
+		if !ok {
+			problems = append(problems, fmt.Errorf("dependency %s is not in the registry", name))
+			continue
+		}
+		if !publishedMatch(pkg, m.Dependencies[name]) {
+			problems = append(problems, fmt.Errorf("no published version of %s matches %s", name, m.Dependencies[name]))
+		}
+	}
+	if pkg, ok := index.lookup(m.Name); ok && m.Version != "" {
+		if _, ok := pkg.Versions[m.Version]; ok {
+			problems = append(problems, fmt.Errorf("%s@%s is already published", m.Name, m.Version))
+		}
+	}
+	return problems
+}
+
+func publishedMatch(pkg IndexPackage, constraint string) bool {
+	if constraint == "" {
+		return true
+	}
+	for v, meta := range pkg.Versions {
+		if ok, _ := satisfies(v, constraint); ok && !meta.Yanked {
+			return true
+		}
+	}
+	return false
+}
+
+// pack builds <name>-<version>.tar.gz from the project in the current
+// directory. Problems found by validatePackageForPublish stop it unless
+// force is set.
+func pack(force bool) error {
+	index, _ := loadIndex()
+	if problems := validatePackageForPublish(".", index); len(problems) > 0 {
+		verb := "refusing to pack"
+		if force {
+			verb = "packing anyway (--force)"
+		}
+		fmt.Fprintf(os.Stderr, "%s has %d problems, %s:\n", manifestFile, len(problems), verb)
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, "  -", p)
+		}
+		if !force {
+			return fmt.Errorf("package is not ready to publish")
+		}
+	}
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	if m.Name == "" || m.Version == "" {
+		return fmt.Errorf("%s must declare name and version", manifestFile)
+	}
+	ignore, err := loadIgnore(".")
+	if err != nil {
+		return err
+	}
+	out := m.Name + "-" + m.Version + ".tar.gz"
+	included, excluded, err := packDirectory(".", out, ignore)
+	if err != nil {
+		os.Remove(out)
+		return err
+	}
+	fmt.Printf("Packed %s (%d files included, %d excluded)\n", out, included, excluded)
+	return nil
+}
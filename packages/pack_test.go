@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	m := &IgnoreMatcher{}
+	for _, p := range []string{".git/", "*.log", "!keep.log", "build/", "/root.txt", "docs/**/draft.md", "tmp?"} {
+		m.add(p)
+	}
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{".git", true, true},
+		{"sub/.git", true, true},
+		{".git", false, false},
+		{"error.log", false, true},
+		{"logs/error.log", false, true},
+		{"keep.log", false, false},
+		{"sub/keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"root.txt", false, true},
+		{"sub/root.txt", false, false},
+		{"docs/draft.md", false, true},
+		{"docs/a/b/draft.md", false, true},
+		{"other/draft.md", false, false},
+		{"tmp1", false, true},
+		{"tmp12", false, false},
+		{"src/main.vira", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePackageForPublish(t *testing.T) {
+	index := &Index{Packages: map[string]IndexPackage{
+		"math": {Latest: "1.2.0", Versions: map[string]IndexVersion{"1.0.0": {}, "1.2.0": {}}},
+		"old":  {Latest: "0.1.0", Versions: map[string]IndexVersion{"0.1.0": {Yanked: true}}},
+		"app":  {Latest: "0.1.0", Versions: map[string]IndexVersion{"0.1.0": {}}},
+	}}
+	tests := []struct {
+		name     string
+		manifest string
+		noSource bool
+		index    *Index
+		want     []string
+	}{
+		{"ready", "name: app\nversion: 0.2.0\ndependencies:\n  math: ^1.0\n", false, index, nil},
+		{"no name", "version: 0.2.0\n", false, index, []string{"must declare name and version"}},
+		{"short version", "name: app\nversion: 0.2\n", false, index, []string{`version "0.2" is not of the form major.minor.patch`}},
+		{"no source directory", "name: app\nversion: 0.2.0\n", true, index, []string{"source directory cmd does not exist"}},
+		{"unknown dependency", "name: app\nversion: 0.2.0\ndependencies:\n  plot: ^1.0\n", false, index, []string{"dependency plot is not in the registry"}},
+		{"unmatched dependency", "name: app\nversion: 0.2.0\ndependencies:\n  math: ^2.0\n", false, index, []string{"no published version of math matches ^2.0"}},
+		{"only yanked versions match", "name: app\nversion: 0.2.0\ndependencies:\n  old: 0.1.0\n", false, index, []string{"no published version of old matches 0.1.0"}},
+		{"already published", "name: app\nversion: 0.1.0\n", false, index, []string{"app@0.1.0 is already published"}},
+		{"no index", "name: app\nversion: 0.2.0\n", false, nil, []string{"without an index, run refresh"}},
+		{"several problems", "name: app\nversion: 0.1.0\ndependencies:\n  plot: ^1.0\n", true, index, []string{
+			"source directory cmd does not exist",
+			"dependency plot is not in the registry",
+			"app@0.1.0 is already published",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, manifestFile), []byte(tt.manifest), 0644)
+			if !tt.noSource {
+				os.Mkdir(filepath.Join(dir, "cmd"), 0755)
+			}
+			problems := validatePackageForPublish(dir, tt.index)
+			if len(problems) != len(tt.want) {
+				t.Fatalf("problems %v, want %d", problems, len(tt.want))
+			}
+			for i, p := range problems {
+				if !strings.Contains(p.Error(), tt.want[i]) {
+					t.Errorf("problem %d is %q, want %q", i, p, tt.want[i])
+				}
+			}
+		})
+	}
+	if problems := validatePackageForPublish(t.TempDir(), index); len(problems) != 1 {
+		t.Errorf("directory without %s: %v, want the read error", manifestFile, problems)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strconv"
+)
+
+// defaultFileMask strips group and world write from installed files.
+const defaultFileMask os.FileMode = 0022
+
+// PermPolicy limits the modes of extracted files. Mask bits are always
+// cleared; with NoExec, files that do not need to run lose their
+// executable bits too.
+type PermPolicy struct {
+	Mask   os.FileMode
+	NoExec bool
+}
+
+// loadPermPolicy reads the file-mask (octal) and no-exec-data config
+// settings.
+func loadPermPolicy() PermPolicy {
+	policy := PermPolicy{Mask: defaultFileMask}
+	values, err := readConfigValues()
+	if err != nil {
+		return policy
+	}
+	if mask, err := strconv.ParseUint(values["file-mask"], 8, 32); err == nil {
+		policy.Mask = os.FileMode(mask) & os.ModePerm
+	}
+	policy.NoExec = values["no-exec-data"] == "true"
+	return policy
+}
+
+func applyPermPolicy(mode os.FileMode, policy PermPolicy) os.FileMode {
+	mode &^= policy.Mask | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	if policy.NoExec {
+		mode &^= 0111
+	}
+	return mode
+}
+
+// needsExec reports whether an archive entry has to stay executable under
+// NoExec: anything in a bin/ directory or declared in the package's bin.
+func needsExec(name string, bins map[string]string) bool {
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if path.Base(dir) == "bin" {
+			return true
+		}
+	}
+	for _, bin := range bins {
+		if path.Clean(bin) == name {
+			return true
+		}
+	}
+	return false
+}
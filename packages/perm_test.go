@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyPermPolicy(t *testing.T) {
+	defaults := PermPolicy{Mask: defaultFileMask}
+	strict := PermPolicy{Mask: 0077}
+	noExec := PermPolicy{Mask: defaultFileMask, NoExec: true}
+	none := PermPolicy{}
+	tests := []struct {
+		name   string
+		mode   os.FileMode
+		policy PermPolicy
+		want   os.FileMode
+	}{
+		{"default keeps a plain file", 0644, defaults, 0644},
+		{"default strips group and world write", 0666, defaults, 0644},
+		{"default keeps exec bits", 0777, defaults, 0755},
+		{"default strips setuid, setgid and sticky", 0755 | os.ModeSetuid | os.ModeSetgid | os.ModeSticky, defaults, 0755},
+		{"strict mask leaves owner bits only", 0775, strict, 0700},
+		{"no-exec strips exec from data", 0755, noExec, 0644},
+		{"no-exec also applies the mask", 0777, noExec, 0644},
+		{"empty mask keeps write bits", 0666, none, 0666},
+		{"empty mask still strips setuid", 0755 | os.ModeSetuid, none, 0755},
+	}
+	for _, tt := range tests {
+		if got := applyPermPolicy(tt.mode, tt.policy); got != tt.want {
+			t.Errorf("%s: applyPermPolicy(%v, %+v) = %v, want %v", tt.name, tt.mode, tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestNeedsExec(t *testing.T) {
+	bins := map[string]string{"mtool": "./tools/mtool.sh"}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"bin/math", true},
+		{"math/bin/math", true},
+		{"math/bin/sub/helper", true},
+		{"tools/mtool.sh", true},
+		{"tools/other.sh", false},
+		{"lib/math.vira", false},
+		{"binary/data", false},
+	}
+	for _, tt := range tests {
+		if got := needsExec(tt.name, bins); got != tt.want {
+			t.Errorf("needsExec(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadPermPolicy(t *testing.T) {
+	tests := []struct {
+		config string
+		want   PermPolicy
+	}{
+		{"", PermPolicy{Mask: defaultFileMask}},
+		{"file-mask: 077\nno-exec-data: true\n", PermPolicy{Mask: 0077, NoExec: true}},
+		{"file-mask: 0\n", PermPolicy{}},
+		{"file-mask: rwx\n", PermPolicy{Mask: defaultFileMask}},
+	}
+	for _, tt := range tests {
+		home := testHome(t)
+		os.MkdirAll(filepath.Join(home, ".vira"), 0755)
+		os.WriteFile(configPath(), []byte(tt.config), 0644)
+		if got := loadPermPolicy(); got != tt.want {
+			t.Errorf("config %q: loadPermPolicy() = %+v, want %+v", tt.config, got, tt.want)
+		}
+	}
+}
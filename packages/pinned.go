@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// pinnedManifest is the manifest of the project being installed, whose
+// pinned integrity strings override the registry's checksums. It is nil
+// outside project installs.
+var pinnedManifest *Manifest
+
+// usePinnedIntegrity makes downloads in the current project check the
+// integrity strings pinned in its bytes.yml.
+func usePinnedIntegrity() error {
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(m.Integrity)) {
+		if !strings.Contains(m.Integrity[name], "-") {
+			return fmt.Errorf("%s: integrity of %s has no algorithm prefix, as in sha256-<digest>", manifestFile, name)
+		}
+		if _, _, err := parseIntegrity(m.Integrity[name]); err != nil {
+			return fmt.Errorf("%s: integrity of %s: %v", manifestFile, name, err)
+		}
+	}
+	pinnedManifest = m
+	return nil
+}
+
+// resolveExpectedIntegrity returns the integrity string m pins for pkg.
+// Pins apply to every version of a package.
+func resolveExpectedIntegrity(pkg Package, m *Manifest) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	integrity, ok := m.Integrity[pkg.Name]
+	return integrity, ok
+}
+
+// pinnedIntegrity returns the integrity string the project's bytes.yml
+// pins for pkgName, given as a name or an install spec.
+func pinnedIntegrity(pkgName string) (string, bool) {
+	name, _ := splitSpec(pkgName)
+	return resolveExpectedIntegrity(Package{Name: name}, pinnedManifest)
+}
+
+// expectedIntegrity returns the integrity a download of pkgName must
+// match: the one pinned in bytes.yml, else fallback.
+func expectedIntegrity(pkgName string, fallback string) string {
+	if pinned, ok := pinnedIntegrity(pkgName); ok {
+		return pinned
+	}
+	return fallback
+}
+
+// integrityMismatch describes a failed check of pkgName for an
+// IntegrityError, naming bytes.yml when the checksum was pinned there.
+func integrityMismatch(pkgName string, err error) string {
+	if _, ok := pinnedIntegrity(pkgName); ok {
+		return fmt.Sprintf("%s: %v (pinned in %s)", pkgName, err, manifestFile)
+	}
+	return pkgName + ": " + err.Error()
+}
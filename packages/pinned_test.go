@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstallChecksPinnedIntegrity(t *testing.T) {
+	archive := gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.0.0"}}))
+	sum := sha256.Sum256(archive)
+	integrity := "sha256-" + hex.EncodeToString(sum[:])
+	tests := []struct {
+		name    string
+		pinned  string
+		wantErr string
+	}{
+		{"pin matches", integrity, ""},
+		{"pin differs from what the registry serves", "sha256-" + strings.Repeat("0", 64), "(pinned in bytes.yml)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := testHome(t)
+			noProgress = true
+			defer func() { noProgress = false }()
+			// The index agrees with the archive; only the pin can object.
+			writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+				"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Integrity: integrity}}},
+			}})
+			newTestRegistry(t, map[string][]byte{"math.tar.gz": archive, "math@1.0.0.tar.gz": archive})
+			wd, _ := os.Getwd()
+			if err := os.Chdir(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chdir(wd)
+			manifest := "name: app\nversion: 0.1.0\ndependencies:\n  math:\n    version: 1.0.0\n    integrity: " + tt.pinned + "\n"
+			os.WriteFile(manifestFile, []byte(manifest), 0644)
+			if err := usePinnedIntegrity(); err != nil {
+				t.Fatal(err)
+			}
+			defer func() { pinnedManifest = nil }()
+
+			_, err := captureStdout(t, func() error {
+				return installEnvironment(t.Context(), "", InstallOptions{InProject: true, MaxDepth: defaultMaxDepth, NoScripts: true})
+			})
+			installed, _ := filepath.Glob(filepath.Join("build", "dependencies", "math*", "lib.vira"))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(installed) != 1 {
+					t.Errorf("installed %v, want math", installed)
+				}
+				return
+			}
+			var integrityErr *IntegrityError
+			if !errors.As(err, &integrityErr) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an integrity error containing %q", err, tt.wantErr)
+			}
+			if len(installed) != 0 {
+				t.Errorf("math was installed despite the mismatch: %v", installed)
+			}
+		})
+	}
+}
+
+func TestResolveExpectedIntegrity(t *testing.T) {
+	m := &Manifest{Integrity: map[string]string{"math": "sha256-abc"}}
+	tests := []struct {
+		pkg    Package
+		m      *Manifest
+		want   string
+		wantOK bool
+	}{
+		{Package{Name: "math"}, m, "sha256-abc", true},
+		{Package{Name: "math", Version: "1.2.0"}, m, "sha256-abc", true},
+		{Package{Name: "io"}, m, "", false},
+		{Package{Name: "math"}, nil, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := resolveExpectedIntegrity(tt.pkg, tt.m)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("resolveExpectedIntegrity(%+v) = %q, %v, want %q, %v", tt.pkg, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
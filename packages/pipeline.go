@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// staged is one package of a pipelined install: downloaded and unpacked
+// by a worker, then finished by install in dependency order.
+type staged struct {
+	name string
+	// entry is the lockfile's resolution when locked is set; otherwise
+	// the worker resolves the URL and checks the index.
+	entry       PlatformEntry
+	locked      bool
+	perPlatform bool
+
+	resolved PlatformEntry
+	err      error
+	done     chan struct{}
+}
+
+// pipeline overlaps the downloads and extractions of an install.
+type pipeline struct {
+	staged  map[string]*staged
+	stopped atomic.Bool
+	workers chan struct{}
+}
+
+// installOrder returns the packages installing pkgName fetches, itself
+// first, or just pkgName without a cached index.
+func installOrder(pkgName string, maxDepth int) []string {
+	index, err := loadIndex()
+	if err != nil {
+		return []string{pkgName}
+	}
+	res, err := resolveDependencies(index, pkgName, maxDepth)
+	if err != nil {
+		return []string{pkgName}
+	}
+	names := []string{pkgName}
+	for _, dep := range res.Packages[1:] {
+		names = append(names, dep.spec(index))
+	}
+	return names
+}
+
+// startPipeline downloads and unpacks names into destDir on up to jobs
+// workers, each archive extracted while it streams in. The lockfile is
+// only read here, so workers never touch it.
+func startPipeline(ctx context.Context, names []string, destDir string, lock *Lock, jobs int) *pipeline {
+	p := &pipeline{staged: map[string]*staged{}, workers: make(chan struct{})}
+	var queue []*staged
+	for _, name := range names {
+		s := &staged{name: name, done: make(chan struct{})}
+		if lock != nil {
+			if entry := lock.Packages[name]; entry != nil {
+				if locked, ok := entry.resolved(currentPlatform()); ok {
+					s.entry, s.locked = locked, true
+				} else if len(entry.Platforms) > 0 {
+					warn(codeLockPlatform, name, "%s has no entry for %s in %s, resolving it", name, currentPlatform(), lockFile)
+				}
+			}
+		}
+		p.staged[name] = s
+		queue = append(queue, s)
+	}
+	// A single progress line cannot follow several downloads at once.
+	if jobs > 1 {
+		noProgress = true
+	}
+	go func() {
+		runPool(len(queue), jobs, func(i int) error {
+			s := queue[i]
+			defer close(s.done)
+			if p.stopped.Load() {
+				s.err = fmt.Errorf("install of %s was cancelled", s.name)
+				return s.err
+			}
+			s.resolved, s.err = s.run(ctx, destDir, lock != nil)
+			return s.err
+		})
+		close(p.workers)
+	}()
+	return p
+}
+
+// run fetches and unpacks one package.
+func (s *staged) run(ctx context.Context, destDir string, project bool) (PlatformEntry, error) {
+	if s.locked {
+		url := s.entry.URL
+		if localRegistry != "" {
+			// Bundles hold the locked archives under their install names.
+			url = registryURL() + s.name + archiveExt(s.name)
+		}
+		_, err := streamPackage(ctx, s.name, url, destDir, s.entry.Integrity)
+		return s.entry, err
+	}
+	url := registryURL() + s.name + archiveExt(s.name)
+	if project {
+		url, s.perPlatform = resolvePackageURL(ctx, s.name, currentPlatform())
+	}
+	return streamPackage(ctx, s.name, url, destDir, "")
+}
+
+// wait returns the outcome for name once its worker is done. It reports
+// false for packages the pipeline does not handle.
+func (p *pipeline) wait(name string) (*staged, bool) {
+	if p == nil {
+		return nil, false
+	}
+	s, ok := p.staged[name]
+	if !ok {
+		return nil, false
+	}
+	<-s.done
+	return s, true
+}
+
+// stop cancels the packages not yet started and waits for the rest, so
+// no worker is left writing to a staging directory.
+func (p *pipeline) stop() {
+	if p == nil {
+		return
+	}
+	p.stopped.Store(true)
+	<-p.workers
+}
+
+// record stores a package resolved by a worker in the lockfile, as
+// downloadLocked does for sequential installs.
+func (s *staged) record(lock *Lock) {
+	if lock == nil || s.locked {
+		return
+	}
+	entry := lock.Packages[s.name]
+	if entry == nil {
+		entry = &LockEntry{}
+		lock.Packages[s.name] = entry
+	}
+	entry.set(currentPlatform(), s.perPlatform, s.resolved)
+	entry.Version = pickedVersion(s.name)
+}
+
+// streamPackage downloads url and unpacks it into destDir/pkgName while
+// it arrives, keeping the archive as a sequential install would. The
+// digest is taken from the same stream and compared with the checksum
+// pinned in bytes.yml, else expected, else the index, before the
+// extracted tree replaces the installed one.
+func streamPackage(ctx context.Context, pkgName string, url string, destDir string, expected string) (PlatformEntry, error) {
+	// Extraction overlaps the download here and is timed with it.
+	defer stopwatch.download(pkgName)()
+	resolved := PlatformEntry{URL: url}
+	expected = expectedIntegrity(pkgName, expected)
+	algo := checksumAlgo
+	if expected != "" {
+		algo, _, _ = strings.Cut(expected, "-")
+	}
+	hash, err := newDigest(algo)
+	if err != nil {
+		return resolved, err
+	}
+	req, err := newRequest(ctx, "GET", url)
+	if err != nil {
+		return resolved, err
+	}
+	req.Header.Set("Accept", acceptHeader())
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return resolved, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		drainBody(resp)
+		return resolved, fmt.Errorf("failed to download: %s", resp.Status)
+	}
+
+	if err := checkDiskSpace(pkgName, destDir, resp.ContentLength); err != nil {
+		return resolved, err
+	}
+	filePath := filepath.Join(destDir, pkgName+archiveExt(pkgName))
+	part := filePath + ".part"
+	defer track(part)()
+	file, err := os.Create(part)
+	if err != nil {
+		return resolved, err
+	}
+	defer file.Close()
+
+	body := &progressReader{r: resp.Body, pkg: pkgName, total: resp.ContentLength, interval: progressInterval()}
+	if eventsEnabled() {
+		body.interval = 200 * time.Millisecond
+	}
+	stream := io.TeeReader(body, io.MultiWriter(file, hash))
+	err = extractStream(ctx, stream, filePath, filepath.Join(destDir, pkgName), func() error {
+		// Trailing padding is part of the archive and of its digest.
+		if _, err := io.Copy(io.Discard, stream); err != nil {
+			return err
+		}
+		endProgress()
+		if err := file.Close(); err != nil {
+			return err
+		}
+		resolved.Integrity = formatIntegrity(algo, hash)
+		if expected != "" && !sameIntegrity(resolved.Integrity, expected) {
+			if err := verifyChecksum(part, expected); err != nil {
+				return &IntegrityError{Mismatches: []string{integrityMismatch(pkgName, err)}}
+			}
+		}
+		if err := os.Rename(part, filePath); err != nil {
+			return err
+		}
+		if expected != "" {
+			return nil
+		}
+		if err := checkIndexIntegrity(pkgName, filePath, resolved.Integrity); err != nil {
+			return err
+		}
+		return tofuCheck(resolvedPackage(pkgName, filePath), resolved.Integrity)
+	})
+	if err != nil {
+		os.Remove(part)
+		return resolved, err
+	}
+	emit(Event{Type: "download_done", Package: pkgName, URL: url, Bytes: body.read})
+	emit(Event{Type: "extract_done", Package: pkgName})
+	return resolved, nil
+}
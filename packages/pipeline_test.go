@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamPackageFailureLeavesNoTree(t *testing.T) {
+	var entries []tarEntry
+	for i := range 64 {
+		entries = append(entries, tarEntry{name: fmt.Sprintf("math/src/file%d.vira", i), body: strings.Repeat(strconv.Itoa(i), 4096)})
+	}
+	archive := gzipBytes(t, makeTar(t, entries))
+	sum := sha256.Sum256(archive)
+	integrity := "sha256-" + hex.EncodeToString(sum[:])
+	corrupt := append([]byte{}, archive...)
+	for i := len(corrupt) / 2; i < len(corrupt)/2+64; i++ {
+		corrupt[i] ^= 0xff
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+		serve    func(w http.ResponseWriter)
+	}{
+		{"checksum mismatch after the last entry", "sha256-" + strings.Repeat("0", 64), func(w http.ResponseWriter) {
+			w.Write(archive)
+		}},
+		{"connection lost halfway", integrity, func(w http.ResponseWriter) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+			w.Write(archive[:len(archive)/2])
+		}},
+		{"corrupt data halfway", integrity, func(w http.ResponseWriter) {
+			w.Write(corrupt)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testHome(t)
+			noProgress = true
+			defer func() { noProgress = false }()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { tt.serve(w) }))
+			defer server.Close()
+			useClient(t, server.Client())
+			destDir := t.TempDir()
+			installed := filepath.Join(destDir, "math", "lib.vira")
+			os.MkdirAll(filepath.Dir(installed), 0755)
+			os.WriteFile(installed, []byte("previous install"), 0644)
+
+			_, err := streamPackage(t.Context(), "math", server.URL+"/math.tar.gz", destDir, tt.expected)
+			if err == nil {
+				t.Fatal("streamPackage succeeded")
+			}
+			if got, _ := os.ReadFile(installed); string(got) != "previous install" {
+				t.Errorf("installed package changed to %q", got)
+			}
+			left, _ := os.ReadDir(destDir)
+			for _, e := range left {
+				if e.Name() != "math" {
+					t.Errorf("%s left behind after %v", e.Name(), err)
+				}
+			}
+			if files := listTree(t, filepath.Join(destDir, "math")); len(files) != 1 {
+				t.Errorf("installed package holds %d files, want only lib.vira", len(files))
+			}
+		})
+	}
+}
+
+// slowHandler serves archives in chunks with a pause after each, like a
+// registry on a slow link.
+func slowHandler(files map[string][]byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		for len(data) > 0 {
+			n := min(len(data), 32<<10)
+			w.Write(data[:n])
+			w.(http.Flusher).Flush()
+			data = data[n:]
+			time.Sleep(time.Millisecond)
+		}
+	})
+}
+
+// BenchmarkInstallPipeline installs a set of packages by downloading then
+// extracting each in turn, and by streaming them through the pipeline.
+func BenchmarkInstallPipeline(b *testing.B) {
+	const packages = 8
+	rng := rand.New(rand.NewSource(1))
+	files := map[string][]byte{}
+	var names []string
+	for i := range packages {
+		name := fmt.Sprintf("pkg%d", i)
+		var entries []tarEntry
+		for j := range 32 {
+			body := make([]byte, 16<<10)
+			rng.Read(body)
+			entries = append(entries, tarEntry{name: fmt.Sprintf("%s/file%d", name, j), body: string(body)})
+		}
+		files[name+".tar.gz"] = gzipBytes(b, makeTar(b, entries))
+		names = append(names, name)
+	}
+	server := httptest.NewServer(slowHandler(files))
+	defer server.Close()
+
+	for _, mode := range []string{"sequential", "pipelined"} {
+		b.Run(mode, func(b *testing.B) {
+			testHome(b)
+			noProgress = true
+			defer func() { noProgress = false }()
+			useClient(b, server.Client())
+			registryOverride = server.URL + "/"
+			defer func() { registryOverride = "" }()
+			destDir := b.TempDir()
+			b.ResetTimer()
+			for range b.N {
+				if mode == "sequential" {
+					for _, name := range names {
+						if _, err := downloadPackage(b.Context(), name, destDir); err != nil {
+							b.Fatal(err)
+						}
+						if err := unpack(b.Context(), name, destDir); err != nil {
+							b.Fatal(err)
+						}
+					}
+					continue
+				}
+				p := startPipeline(b.Context(), names, destDir, nil, 4)
+				for _, name := range names {
+					if s, _ := p.wait(name); s.err != nil {
+						b.Fatal(s.err)
+					}
+				}
+				p.stop()
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PlanEntry is one package an install would fetch.
+type PlanEntry struct {
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	URL           string `json:"url"`
+	Size          int64  `json:"size"`
+	InstalledSize int64  `json:"installedSize"`
+	Cached        bool   `json:"cached"`
+	Optional      bool   `json:"optional,omitempty"`
+	Override      bool   `json:"override,omitempty"`
+}
+
+// Plan is the resolved outcome of an install, computed without
+// downloading anything. DownloadSize only counts packages not cached.
+type Plan struct {
+	Packages     []PlanEntry `json:"packages"`
+	DownloadSize int64       `json:"downloadSize"`
+	InstallSize  int64       `json:"installSize"`
+	Warnings     []Warning   `json:"warnings"`
+}
+
+// planInstall resolves pkgName against the cached index and reports what
+// installing it into destDir would do.
+func planInstall(pkgName string, destDir string, maxDepth int) (*Plan, error) {
+	index, err := loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	name, _ := splitSpec(pkgName)
+	if _, ok := index.lookup(name); !ok {
+		if _, overridden := overrideFor(name); !overridden {
+			return nil, notFoundError(name, index)
+		}
+	}
+	res, err := resolveDependencies(index, pkgName, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{Packages: []PlanEntry{}}
+	for _, dep := range res.Packages {
+		pkg, _ := index.lookup(dep.Name)
+		meta := pkg.Versions[dep.Version]
+		warnDeprecated(dep.Name, dep.Version, meta)
+		ext := ".tar." + pickFormat(meta.Formats)
+		entry := PlanEntry{
+			Name:          dep.Name,
+			Version:       dep.Version,
+			URL:           meta.URL,
+			Size:          meta.Size,
+			InstalledSize: meta.InstalledSize,
+			Optional:      dep.Optional,
+		}
+		if entry.URL == "" {
+			entry.URL = registryURL() + dep.spec(index) + ext
+		}
+		if target, ok := overrideFor(dep.Name); ok {
+			entry.URL, entry.Override = target, true
+			plan.Packages = append(plan.Packages, entry)
+			continue
+		}
+		archive := filepath.Join(destDir, dep.spec(index)+ext)
+		if _, err := os.Stat(archive); err == nil {
+			entry.Cached = meta.Integrity == "" || verifyChecksum(archive, meta.Integrity) == nil
+		}
+		if !entry.Cached {
+			plan.DownloadSize += entry.Size
+		}
+		plan.InstallSize += entry.InstalledSize
+		plan.Packages = append(plan.Packages, entry)
+	}
+	return plan, nil
+}
+
+// lockInstall resolves pkgName against the cached index and records the
+// result in the project's lockfile without downloading anything. Every
+// resolved version must have a checksum in the index, so the lockfile can
+// be trusted by a later ci. Entries already locked to the same checksum
+// are kept as they are.
+func lockInstall(pkgName string, maxDepth int) error {
+	index, err := loadIndex()
+	if err != nil {
+		return err
+	}
+	name, _ := splitSpec(pkgName)
+	if _, ok := index.lookup(name); !ok {
+		return notFoundError(name, index)
+	}
+	res, err := resolveDependencies(index, pkgName, maxDepth)
+	if err != nil {
+		return err
+	}
+	lock, err := readLock(lockFile)
+	if err != nil {
+		return err
+	}
+	checkLockOptional(lock)
+	lock.NoOptional = noOptional
+	platform := currentPlatform()
+	for i, dep := range res.Packages {
+		if _, ok := overrideFor(dep.Name); ok {
+			continue
+		}
+		key := dep.spec(index)
+		if i == 0 {
+			key = pkgName
+		}
+		pkg, _ := index.lookup(dep.Name)
+		meta := pkg.Versions[dep.Version]
+		if meta.Integrity == "" {
+			err := fmt.Errorf("%s@%s has no checksum in the index, the lockfile cannot be written without downloading it", dep.Name, dep.Version)
+			if dep.Optional {
+				warn(codeOptionalSkipped, dep.Name, "skipping optional dependency: %v", err)
+				continue
+			}
+			return err
+		}
+		url := meta.URL
+		if url == "" {
+			url = registryURL() + key + ".tar." + pickFormat(meta.Formats)
+		}
+		entry := lock.Packages[key]
+		if entry == nil {
+			entry = &LockEntry{}
+			lock.Packages[key] = entry
+		}
+		entry.Version = dep.Version
+		if locked, ok := entry.resolved(platform); ok && sameIntegrity(locked.Integrity, meta.Integrity) {
+			continue
+		}
+		entry.set(platform, false, PlatformEntry{URL: url, Integrity: meta.Integrity})
+	}
+	return writeLock(lockFile, lock)
+}
+
+func printPlan(plan *Plan, asJSON bool) error {
+	if asJSON {
+		plan.Warnings = collectedWarnings()
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	for _, p := range plan.Packages {
+		status := "download"
+		if p.Cached {
+			status = "cached"
+		} else if p.Override {
+			status = "override"
+		}
+		fmt.Printf("%s@%s %s (%d bytes, %s)\n", p.Name, p.Version, p.URL, p.Size, status)
+	}
+	fmt.Printf("Total: %d bytes to download, %d bytes installed\n", plan.DownloadSize, plan.InstallSize)
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPlanJSON(t *testing.T) {
+	home := testHome(t)
+	quietWarnings(t)
+	mathArchive := []byte("math 1.1.0")
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"app": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {
+			Dependencies:         map[string]string{"math": "^1.0"},
+			OptionalDependencies: map[string]string{"plot": "*"},
+			Size:                 100, InstalledSize: 400,
+		}}},
+		"math": {Latest: "1.1.0", Versions: map[string]IndexVersion{"1.1.0": {Size: int64(len(mathArchive)), InstalledSize: 30}}},
+		"plot": {Latest: "0.2.0", Versions: map[string]IndexVersion{"0.2.0": {URL: "https://cdn.example/plot.tar.gz", Size: 50, InstalledSize: 200, Deprecated: "use chart"}}},
+	}})
+	destDir := t.TempDir()
+	os.WriteFile(filepath.Join(destDir, "math.tar.gz"), mathArchive, 0644)
+
+	plan, err := planInstall("app", destDir, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := captureStdout(t, func() error { return printPlan(plan, true) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(out), &raw); err != nil {
+		t.Fatalf("printed %q: %v", out, err)
+	}
+	if keys := slices.Sorted(maps.Keys(raw)); !slices.Equal(keys, []string{"downloadSize", "installSize", "packages", "warnings"}) {
+		t.Errorf("plan keys %v", keys)
+	}
+	var rawEntries []map[string]any
+	json.Unmarshal(raw["packages"], &rawEntries)
+	for _, e := range rawEntries {
+		for _, key := range []string{"name", "version", "url", "size", "installedSize", "cached"} {
+			if _, ok := e[key]; !ok {
+				t.Errorf("plan entry %v has no %s", e, key)
+			}
+		}
+	}
+
+	var got Plan
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]PlanEntry{}
+	for _, e := range got.Packages {
+		byName[e.Name] = e
+	}
+	if e := byName["app"]; e.Version != "1.0.0" || e.URL != registryURL()+"app.tar.gz" || e.Cached || e.Size != 100 {
+		t.Errorf("app entry %+v", e)
+	}
+	if e := byName["math"]; e.Version != "1.1.0" || !e.Cached {
+		t.Errorf("math entry %+v, want 1.1.0 and cached", e)
+	}
+	if e := byName["plot"]; e.URL != "https://cdn.example/plot.tar.gz" || !e.Optional || e.Cached {
+		t.Errorf("plot entry %+v, want its index URL, optional and not cached", e)
+	}
+	if len(got.Packages) != 3 {
+		t.Errorf("planned %d packages, want 3", len(got.Packages))
+	}
+	// The cached math archive is neither downloaded nor counted.
+	if got.DownloadSize != 150 || got.InstallSize != 630 {
+		t.Errorf("downloadSize %d, installSize %d, want 150 and 630", got.DownloadSize, got.InstallSize)
+	}
+	if len(got.Warnings) != 1 || got.Warnings[0].Code != codeDeprecatedVersion || got.Warnings[0].Package != "plot" {
+		t.Errorf("warnings %+v, want plot deprecated", got.Warnings)
+	}
+}
+
+// projectFiles lists every file below the current directory.
+func projectFiles(t *testing.T) []string {
+	t.Helper()
+	var files []string
+	filepath.WalkDir(".", func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+func TestInstallWritesNoPackageFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      InstallOptions
+		integrity bool
+		wantFiles []string
+		wantErr   string
+	}{
+		{"lockfile only", InstallOptions{InProject: true, LockfileOnly: true}, true, []string{lockFile}, ""},
+		{"lockfile only with a dependency lacking a checksum", InstallOptions{InProject: true, LockfileOnly: true}, false, nil, "math@1.0.0 has no checksum in the index"},
+		{"dry run in the project", InstallOptions{InProject: true, DryRun: true}, true, nil, ""},
+		{"global dry run", InstallOptions{DryRun: true}, true, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := testHome(t)
+			quietWarnings(t)
+			integrity := "sha256-" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+			mathIntegrity := integrity
+			if !tt.integrity {
+				mathIntegrity = ""
+			}
+			writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+				"app":  {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Integrity: integrity, Dependencies: map[string]string{"math": "^1.0"}}}},
+				"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Integrity: mathIntegrity}}},
+			}})
+			archive := gzipBytes(t, makeTar(t, []tarEntry{{name: "lib.vira", body: "x"}}))
+			reg := newTestRegistry(t, map[string][]byte{"app.tar.gz": archive, "math.tar.gz": archive})
+			wd, _ := os.Getwd()
+			if err := os.Chdir(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chdir(wd)
+			libs := filepath.Join(home, ".vira", "libs")
+			opts := tt.opts
+			opts.MaxDepth = 8
+
+			_, err := captureStdout(t, func() error { return install(t.Context(), "app", opts) })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("install = %v, want an error containing %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if files := projectFiles(t); !slices.Equal(files, tt.wantFiles) {
+				t.Errorf("project holds %v, want %v", files, tt.wantFiles)
+			}
+			if _, err := os.Stat(libs); !os.IsNotExist(err) {
+				t.Errorf("global libs directory was created: %v", err)
+			}
+			if n := reg.count("app.tar.gz") + reg.count("math.tar.gz"); n != 0 {
+				t.Errorf("made %d archive requests", n)
+			}
+			if tt.opts.LockfileOnly && tt.wantErr == "" {
+				lock, err := readLock(lockFile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if names := slices.Sorted(maps.Keys(lock.Packages)); !slices.Equal(names, []string{"app", "math"}) {
+					t.Errorf("locked %v, want app and math", names)
+				}
+				if e := lock.Packages["math"]; e.Version != "1.0.0" || e.Integrity != integrity {
+					t.Errorf("math locked as %+v", e)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// noProgress suppresses download progress output, set by --no-progress.
+var noProgress bool
+
+// progressInterval is how often progress is redrawn: often on a terminal,
+// rarely as plain lines so CI logs are not flooded.
+func progressInterval() time.Duration {
+	if _, ok := terminalWidth(); ok {
+		return 100 * time.Millisecond
+	}
+	return 2 * time.Second
+}
+
+// terminalWidth reports the width of stdout, honouring COLUMNS. It is
+// false when stdout is not a terminal.
+func terminalWidth() (int, bool) {
+	width, ok := ttyWidth(os.Stdout.Fd())
+	if !ok {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		width = n
+	}
+	return width, true
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// progressLine renders a progress line fitting width columns. The bar
+// shrinks first, then the package name is cut. Without a known total only
+// the bytes so far are shown.
+func progressLine(pkg string, read, total int64, width int) string {
+	if total <= 0 {
+		return truncate(fmt.Sprintf("%s %s", pkg, formatBytes(read)), width)
+	}
+	stats := fmt.Sprintf(" %3d%% %s/%s", read*100/total, formatBytes(read), formatBytes(total))
+	barWidth := width - len(pkg) - len(stats) - 3
+	if barWidth < 10 {
+		return truncate(pkg+stats, width)
+	}
+	if barWidth > 40 {
+		barWidth = 40
+	}
+	filled := int(int64(barWidth) * read / total)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled)
+	return fmt.Sprintf("%s [%s]%s", pkg, bar, stats)
+}
+
+func truncate(s string, width int) string {
+	if width > 0 && len(s) > width {
+		return s[:width]
+	}
+	return s
+}
+
+// showProgress draws one progress update: redrawing a single line on a
+// terminal, or printing a plain line otherwise.
+func showProgress(pkg string, read, total int64) {
+	if noProgress || eventsEnabled() {
+		return
+	}
+	if width, ok := terminalWidth(); ok {
+		fmt.Print("\r\033[K" + progressLine(pkg, read, total, width-1))
+		return
+	}
+	if total > 0 {
+		fmt.Printf("downloading %s: %d/%d bytes\n", pkg, read, total)
+	} else {
+		fmt.Printf("downloading %s: %d bytes\n", pkg, read)
+	}
+}
+
+// endProgress clears the terminal progress line once a download is done.
+func endProgress() {
+	if noProgress || eventsEnabled() {
+		return
+	}
+	if _, ok := terminalWidth(); ok {
+		fmt.Print("\r\033[K")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressWithoutTerminal(t *testing.T) {
+	// A width from the environment does not make a pipe a terminal.
+	t.Setenv("COLUMNS", "120")
+	out, _ := captureStdout(t, func() error {
+		if width, ok := terminalWidth(); ok {
+			t.Errorf("terminalWidth on a pipe = %d, true", width)
+		}
+		if got := progressInterval(); got != 2*time.Second {
+			t.Errorf("progressInterval on a pipe = %v, want 2s", got)
+		}
+		showProgress("math", 512, 2048)
+		showProgress("json", 300, -1)
+		endProgress()
+
+		body := &progressReader{r: strings.NewReader("abcdef"), pkg: "http", total: 6, interval: 0}
+		buf := make([]byte, 4)
+		for {
+			if _, err := body.Read(buf); err == io.EOF {
+				break
+			}
+		}
+		return nil
+	})
+	want := "downloading math: 512/2048 bytes\n" +
+		"downloading json: 300 bytes\n" +
+		"downloading http: 4/6 bytes\n" +
+		"downloading http: 6/6 bytes\n" +
+		"downloading http: 6/6 bytes\n"
+	if out != want {
+		t.Errorf("printed %q, want plain lines %q", out, want)
+	}
+	if strings.ContainsAny(out, "\r\033") {
+		t.Errorf("printed terminal control characters: %q", out)
+	}
+}
+
+func TestNoProgress(t *testing.T) {
+	noProgress = true
+	defer func() { noProgress = false }()
+	out, _ := captureStdout(t, func() error {
+		showProgress("math", 512, 2048)
+		endProgress()
+		return nil
+	})
+	if out != "" {
+		t.Errorf("--no-progress printed %q", out)
+	}
+}
+
+func TestProgressLine(t *testing.T) {
+	tests := []struct {
+		read, total int64
+		width       int
+		want        string
+	}{
+		{512, 1024, 60, "math [" + strings.Repeat("=", 18) + strings.Repeat(" ", 19) + "]  50% 512B/1.0KB"},
+		{512, 1024, 30, "math  50% 512B/1.0KB"},
+		{512, 1024, 10, "math  50% "},
+		{2048, -1, 40, "math 2.0KB"},
+	}
+	for _, tt := range tests {
+		got := progressLine("math", tt.read, tt.total, tt.width)
+		if got != tt.want {
+			t.Errorf("progressLine(%d, %d, width %d) = %q, want %q", tt.read, tt.total, tt.width, got, tt.want)
+		}
+		if len(got) > tt.width {
+			t.Errorf("progressLine at width %d is %d wide", tt.width, len(got))
+		}
+	}
+}
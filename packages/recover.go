@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// fileIntegrity hashes the file at path with checksumAlgo.
+func fileIntegrity(path string) (string, error) {
+	h, err := newDigest(checksumAlgo)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return formatIntegrity(checksumAlgo, h), nil
+}
+
+// rebuildLockFromDisk reconstructs lockfile entries for the packages
+// installed in dir. Checksums are recomputed from the archives; versions
+// and URLs come from each package's install record when it survived, and
+// from the cached index and registry layout otherwise, in which case the
+// record is rewritten. Packages whose archive is gone cannot be locked and
+// are skipped with a warning.
+func rebuildLockFromDisk(dir string) (*Lock, error) {
+	installed, err := listInstalled(dir)
+	if err != nil {
+		return nil, err
+	}
+	lock := &Lock{Packages: map[string]*LockEntry{}}
+	for _, full := range slices.Sorted(slices.Values(installed)) {
+		if _, ok := overrideFor(full); ok {
+			continue
+		}
+		archives, _ := filepath.Glob(filepath.Join(dir, full+".tar.*"))
+		if len(archives) != 1 {
+			warn(codeLockRecovery, full, "%s has no archive in %s, reinstall it to lock it", full, dir)
+			continue
+		}
+		integrity, err := fileIntegrity(archives[0])
+		if err != nil {
+			return nil, err
+		}
+		meta, err := readInstalledMeta(filepath.Join(dir, full))
+		lost := err != nil
+		if lost {
+			meta = &InstalledMeta{}
+		}
+		if meta.Integrity != "" && verifyChecksum(archives[0], meta.Integrity) != nil {
+			warn(codeLockRecovery, full, "%s changed since it was installed, locking it as it is now", full)
+		}
+		entry := &LockEntry{Version: meta.Version, URL: meta.URL, Integrity: integrity}
+		if entry.Version == "" {
+			entry.Version = pickedVersion(full)
+		}
+		if entry.URL == "" {
+			entry.URL = registryURL() + full + strings.TrimPrefix(filepath.Base(archives[0]), full)
+		}
+		lock.Packages[full] = entry
+		if info, err := os.Stat(filepath.Join(dir, full)); lost && err == nil && info.IsDir() {
+			if err := writeInstalledMeta(filepath.Join(dir, full), InstalledMeta{Version: entry.Version, URL: entry.URL, Integrity: integrity}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return lock, nil
+}
+
+// recoverProject rewrites bytes.lock from build/dependencies and reports
+// how the installed set and the manifest disagree, for env or else the
+// environment the damaged lockfile recorded. With backfill, packages on
+// disk that nothing in the manifest needs are added to its dependencies.
+func recoverProject(env string, backfill bool) error {
+	dir := filepath.Join("build", "dependencies")
+	lock, err := rebuildLockFromDisk(dir)
+	if err != nil {
+		return err
+	}
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	if old, err := readLock(lockFile); err == nil {
+		lock.Environment = old.Environment
+		lock.NoOptional = old.NoOptional
+	}
+	if env != "" {
+		lock.Environment = env
+	}
+	deps, err := environmentDependencies(m, lock.Environment)
+	if err != nil {
+		return err
+	}
+	maps.Copy(deps, m.DevDependencies)
+
+	onDisk := map[string]bool{}
+	for key := range lock.Packages {
+		name, _ := splitSpec(key)
+		onDisk[name] = true
+	}
+	for _, name := range slices.Sorted(maps.Keys(deps)) {
+		if !onDisk[name] {
+			warn(codeManifestDrift, name, "%s is in %s but not installed, run install to fetch it", name, manifestFile)
+		}
+	}
+	needed := neededPackages(deps)
+	var extra []string
+	for _, key := range slices.Sorted(maps.Keys(lock.Packages)) {
+		if name, _ := splitSpec(key); !needed[name] {
+			extra = append(extra, key)
+		}
+	}
+	if backfill && len(extra) > 0 {
+		added := map[string]string{}
+		for _, key := range extra {
+			name, _ := splitSpec(key)
+			added[name] = lockedVersion(key, lock.Packages[key])
+			if added[name] == "" {
+				added[name] = `"*"`
+			}
+		}
+		if err := backfillManifest(added); err != nil {
+			return err
+		}
+		fmt.Printf("Added %s to %s\n", strings.Join(extra, ", "), manifestFile)
+	} else {
+		for _, key := range extra {
+			warn(codeManifestDrift, key, "%s is installed but not needed by %s (use --backfill-manifest to add it)", key, manifestFile)
+		}
+	}
+	if err := writeLock(lockFile, lock); err != nil {
+		return err
+	}
+	fmt.Printf("Recovered %s with %d packages\n", lockFile, len(lock.Packages))
+	return nil
+}
+
+// neededPackages is the set of names deps pull in, through the cached
+// index when it resolves them and only deps themselves otherwise.
+func neededPackages(deps map[string]string) map[string]bool {
+	needed := map[string]bool{}
+	index, _ := loadIndex()
+	for name := range deps {
+		needed[name] = true
+		if index == nil {
+			continue
+		}
+		if res, err := resolveDependencies(index, name, configuredMaxDepth()); err == nil {
+			for _, dep := range res.Packages {
+				needed[dep.Name] = true
+			}
+		}
+	}
+	return needed
+}
+
+// backfillManifest adds deps to the dependencies of bytes.yml, written as
+// a [dependencies] section or a dependencies: mapping, creating a section
+// when there is neither.
+func backfillManifest(deps map[string]string) error {
+	data, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	var add []string
+	for _, name := range slices.Sorted(maps.Keys(deps)) {
+		add = append(add, name+": "+deps[name])
+	}
+	at := -1
+	for i, line := range lines {
+		if line == "dependencies:" {
+			at = i + 1
+			for at < len(lines) && strings.HasPrefix(lines[at], " ") {
+				at++
+			}
+			for j := range add {
+				add[j] = "  " + add[j]
+			}
+			break
+		}
+		if strings.TrimSpace(line) == "[dependencies]" {
+			at = i + 1
+			for at < len(lines) && !strings.HasPrefix(lines[at], "[") {
+				at++
+			}
+			for at > i+1 && strings.TrimSpace(lines[at-1]) == "" {
+				at--
+			}
+			break
+		}
+	}
+	if at < 0 {
+		lines = append(lines, "", "[dependencies]")
+		at = len(lines)
+	}
+	lines = append(lines[:at], append(add, lines[at:]...)...)
+	return writeFileAtomic(manifestFile, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// recoverFixture installs app's dependencies, math and io, into a fresh
+// project and returns the lockfile the install wrote.
+func recoverFixture(t *testing.T) *Lock {
+	t.Helper()
+	home := testHome(t)
+	noProgress = true
+	t.Cleanup(func() { noProgress = false })
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math":  {Latest: "1.1.0", Versions: map[string]IndexVersion{"1.0.0": {}, "1.1.0": {Dependencies: map[string]string{"io": "^1.0"}}}},
+		"io":    {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+		"zlib":  {Latest: "1.2.0", Versions: map[string]IndexVersion{"1.2.0": {}}},
+		"bench": {Latest: "0.1.0", Versions: map[string]IndexVersion{"0.1.0": {}}},
+	}})
+	newTestRegistry(t, map[string][]byte{
+		"math.tar.gz": gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.1.0"}})),
+		"io.tar.gz":   gzipBytes(t, makeTar(t, []tarEntry{{name: "io/lib.vira", body: "1.0.0"}})),
+		"zlib.tar.gz": gzipBytes(t, makeTar(t, []tarEntry{{name: "zlib/lib.vira", body: "1.2.0"}})),
+	})
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	os.WriteFile(manifestFile, []byte("name: app\nversion: 0.1.0\ndependencies:\n  math: ^1.0\n"), 0644)
+	if _, err := captureStdout(t, func() error {
+		return installEnvironment(t.Context(), "", InstallOptions{InProject: true, MaxDepth: defaultMaxDepth, NoScripts: true})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := readLock(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := slices.Sorted(maps.Keys(lock.Packages)); !slices.Equal(keys, []string{"io", "math"}) {
+		t.Fatalf("install locked %v, want io and math", keys)
+	}
+	return lock
+}
+
+// sameLockEntries reports how two lockfiles' entries differ, if at all.
+func sameLockEntries(t *testing.T, got *Lock, want *Lock) {
+	t.Helper()
+	if keys := slices.Sorted(maps.Keys(got.Packages)); !slices.Equal(keys, slices.Sorted(maps.Keys(want.Packages))) {
+		t.Fatalf("recovered %v, want %v", keys, slices.Sorted(maps.Keys(want.Packages)))
+	}
+	for key, w := range want.Packages {
+		g := got.Packages[key]
+		if g.Version != w.Version || g.URL != w.URL || !sameIntegrity(g.Integrity, w.Integrity) {
+			t.Errorf("%s recovered as %+v, want %+v", key, *g, *w)
+		}
+	}
+}
+
+func TestRecoverDeletedLockfile(t *testing.T) {
+	original := recoverFixture(t)
+	quietWarnings(t)
+	os.Remove(lockFile)
+	if _, err := captureStdout(t, func() error { return recoverProject("", false) }); err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := readLock(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameLockEntries(t, recovered, original)
+	if w := collectedWarnings(); len(w) != 0 {
+		t.Errorf("recovering an intact install warned %v", w)
+	}
+}
+
+func TestRecoverLostInstallRecord(t *testing.T) {
+	original := recoverFixture(t)
+	quietWarnings(t)
+	mathDir := filepath.Join("build", "dependencies", "math")
+	os.Remove(filepath.Join(mathDir, installedFile))
+	os.WriteFile(lockFile, []byte("{not json"), 0644)
+	if _, err := captureStdout(t, func() error { return recoverProject("", false) }); err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := readLock(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The record's version and URL come back from the index and registry.
+	sameLockEntries(t, recovered, original)
+	meta, err := readInstalledMeta(mathDir)
+	if err != nil {
+		t.Fatalf("install record was not rewritten: %v", err)
+	}
+	if meta.Version != "1.1.0" || !sameIntegrity(meta.Integrity, original.Packages["math"].Integrity) {
+		t.Errorf("rewritten install record %+v", *meta)
+	}
+}
+
+func TestRecoverReportsDrift(t *testing.T) {
+	recoverFixture(t)
+	quietWarnings(t)
+	deps := filepath.Join("build", "dependencies")
+	// zlib is on disk without the manifest needing it, bench is in the
+	// manifest but not installed, io's archive is gone and math's changed.
+	if _, err := captureStdout(t, func() error {
+		return install(t.Context(), "zlib", InstallOptions{InProject: true, MaxDepth: defaultMaxDepth, NoScripts: true})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(manifestFile, []byte("name: app\nversion: 0.1.0\ndependencies:\n  math: ^1.0\ndev-dependencies:\n  bench: \"*\"\n"), 0644)
+	archives, _ := filepath.Glob(filepath.Join(deps, "io.tar.*"))
+	for _, a := range archives {
+		os.Remove(a)
+	}
+	archives, _ = filepath.Glob(filepath.Join(deps, "math.tar.*"))
+	os.WriteFile(archives[0], []byte("tampered"), 0644)
+	os.Remove(lockFile)
+
+	if _, err := captureStdout(t, func() error { return recoverProject("", false) }); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := readLock(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := slices.Sorted(maps.Keys(lock.Packages)); !slices.Equal(keys, []string{"math", "zlib"}) {
+		t.Errorf("recovered %v, want math and zlib", keys)
+	}
+	var got []string
+	for _, w := range collectedWarnings() {
+		got = append(got, w.Code+": "+w.Message)
+	}
+	want := []string{
+		codeLockRecovery + ": io has no archive in " + deps + ", reinstall it to lock it",
+		codeLockRecovery + ": math changed since it was installed, locking it as it is now",
+		codeManifestDrift + ": bench is in bytes.yml but not installed, run install to fetch it",
+		codeManifestDrift + ": zlib is installed but not needed by bytes.yml (use --backfill-manifest to add it)",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("warnings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRecoverBackfillsManifest(t *testing.T) {
+	recoverFixture(t)
+	quietWarnings(t)
+	if _, err := captureStdout(t, func() error {
+		return install(t.Context(), "zlib", InstallOptions{InProject: true, MaxDepth: defaultMaxDepth, NoScripts: true})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(lockFile)
+	out, err := captureStdout(t, func() error { return recoverProject("", true) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Added zlib to bytes.yml") {
+		t.Errorf("recover printed %q", out)
+	}
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"math": "^1.0", "zlib": "1.2.0"}; !maps.Equal(m.Dependencies, want) {
+		t.Errorf("manifest dependencies %v, want %v", m.Dependencies, want)
+	}
+	if w := collectedWarnings(); len(w) != 0 {
+		t.Errorf("backfilled recovery warned %v", w)
+	}
+}
+
+func TestBackfillManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     string
+	}{
+		{"mapping", "name: app\ndependencies:\n  math: ^1.0\nversion: 0.1.0\n", "name: app\ndependencies:\n  math: ^1.0\n  zlib: 1.2.0\nversion: 0.1.0\n"},
+		{"section", "name: app\n\n[dependencies]\nmath: ^1.0\n\n[scripts]\n", "name: app\n\n[dependencies]\nmath: ^1.0\nzlib: 1.2.0\n\n[scripts]\n"},
+		{"none", "name: app\n", "name: app\n\n[dependencies]\nzlib: 1.2.0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wd, _ := os.Getwd()
+			if err := os.Chdir(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chdir(wd)
+			os.WriteFile(manifestFile, []byte(tt.manifest), 0644)
+			if err := backfillManifest(map[string]string{"zlib": "1.2.0"}); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(manifestFile); string(got) != tt.want {
+				t.Errorf("manifest:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
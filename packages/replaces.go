@@ -0,0 +1,83 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"sync"
+)
+
+var (
+	replacedMu      sync.Mutex
+	replacedNoticed = map[string]bool{}
+)
+
+// replacementFor returns the package that lists name in its replaces.
+// Only loaded shards of a sharded index are searched.
+func (idx *Index) replacementFor(name string) (string, bool) {
+	if idx == nil {
+		return "", false
+	}
+	for _, candidate := range slices.Sorted(maps.Keys(idx.Packages)) {
+		if candidate != name && slices.Contains(idx.Packages[candidate].Replaces, name) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// replacedName returns the package to install for name, noting once per
+// run when a renamed package is swapped for its replacement.
+func replacedName(name string, index *Index) (string, bool) {
+	if _, ok := overrideFor(name); ok {
+		return name, false
+	}
+	repl, ok := index.replacementFor(name)
+	if !ok {
+		return name, false
+	}
+	replacedMu.Lock()
+	defer replacedMu.Unlock()
+	if !replacedNoticed[name] {
+		replacedNoticed[name] = true
+		warn(codeDeprecatedPackage, name, "%s is deprecated and replaced by %s, installing %s instead", name, repl, repl)
+	}
+	return repl, true
+}
+
+// applyReplacements swaps renamed packages in pkgs for the packages that
+// replace them. A constraint on the old name says nothing about the new
+// one, so replacements take their latest version; a package listed under
+// both names is kept once.
+func applyReplacements(pkgs []Dependency, index *Index) []Dependency {
+	var out []Dependency
+	seen := map[string]int{}
+	for _, p := range pkgs {
+		if repl, ok := replacedName(p.Name, index); ok {
+			p = Dependency{Name: repl, Optional: p.Optional}
+		}
+		if i, ok := seen[p.Name]; ok {
+			if p.Version != "" && out[i].Version == "" {
+				out[i].Version = p.Version
+			}
+			out[i].Optional = out[i].Optional && p.Optional
+			continue
+		}
+		seen[p.Name] = len(out)
+		out = append(out, p)
+	}
+	return out
+}
+
+// replacedSpec applies replacements to an install spec, dropping any
+// version meant for the old name.
+func replacedSpec(spec string) string {
+	index, err := loadIndex()
+	if err != nil {
+		return spec
+	}
+	name, _ := splitSpec(spec)
+	if repl, ok := replacedName(name, index); ok {
+		return repl
+	}
+	return spec
+}
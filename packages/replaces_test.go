@@ -0,0 +1,177 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// forgetReplacements clears the once-per-run replacement notices until
+// the test ends.
+func forgetReplacements(t *testing.T) {
+	replacedMu.Lock()
+	saved := replacedNoticed
+	replacedNoticed = map[string]bool{}
+	replacedMu.Unlock()
+	t.Cleanup(func() {
+		replacedMu.Lock()
+		replacedNoticed = saved
+		replacedMu.Unlock()
+	})
+}
+
+// replacesIndex has math replacing oldmath, which is still published.
+func replacesIndex() Index {
+	return Index{Packages: map[string]IndexPackage{
+		"math":    {Latest: "2.0.0", Replaces: []string{"oldmath"}, Versions: map[string]IndexVersion{"2.0.0": {}}},
+		"oldmath": {Latest: "0.9.0", Versions: map[string]IndexVersion{"0.9.0": {}}},
+		"io":      {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+	}}
+}
+
+func TestApplyReplacements(t *testing.T) {
+	index := replacesIndex()
+	tests := []struct {
+		name string
+		in   []Dependency
+		want []Dependency
+	}{
+		{"old name takes the latest replacement",
+			[]Dependency{{Name: "oldmath", Version: "^0.9"}},
+			[]Dependency{{Name: "math"}}},
+		{"other packages are kept",
+			[]Dependency{{Name: "io", Version: "1.0.0"}, {Name: "oldmath"}},
+			[]Dependency{{Name: "io", Version: "1.0.0"}, {Name: "math"}}},
+		{"both names are kept once with the new name's version",
+			[]Dependency{{Name: "oldmath", Version: "^0.9"}, {Name: "math", Version: "2.0.0"}},
+			[]Dependency{{Name: "math", Version: "2.0.0"}}},
+		{"required under either name stays required",
+			[]Dependency{{Name: "math", Optional: true}, {Name: "oldmath"}},
+			[]Dependency{{Name: "math"}}},
+		{"optional under both names stays optional",
+			[]Dependency{{Name: "oldmath", Optional: true}, {Name: "math", Optional: true}},
+			[]Dependency{{Name: "math", Optional: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testHome(t)
+			quietWarnings(t)
+			forgetReplacements(t)
+			if got := applyReplacements(tt.in, &index); !slices.Equal(got, tt.want) {
+				t.Errorf("applyReplacements(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("without an index", func(t *testing.T) {
+		testHome(t)
+		in := []Dependency{{Name: "oldmath", Version: "^0.9"}}
+		if got := applyReplacements(in, nil); !slices.Equal(got, in) {
+			t.Errorf("applyReplacements without an index = %v", got)
+		}
+	})
+
+	t.Run("overridden old name", func(t *testing.T) {
+		home := testHome(t)
+		os.MkdirAll(filepath.Join(home, ".vira"), 0755)
+		os.WriteFile(configPath(), []byte("overrides:\n  oldmath: "+t.TempDir()+"\n"), 0644)
+		in := []Dependency{{Name: "oldmath"}}
+		if got := applyReplacements(in, &index); !slices.Equal(got, in) {
+			t.Errorf("an overridden package was replaced: %v", got)
+		}
+	})
+
+	t.Run("notice once", func(t *testing.T) {
+		testHome(t)
+		quietWarnings(t)
+		forgetReplacements(t)
+		for range 2 {
+			applyReplacements([]Dependency{{Name: "oldmath"}}, &index)
+		}
+		var notices int
+		for _, w := range collectedWarnings() {
+			if w.Code == codeDeprecatedPackage && w.Package == "oldmath" {
+				notices++
+			}
+		}
+		if notices != 1 {
+			t.Errorf("%d replacement notices, want 1", notices)
+		}
+	})
+}
+
+func TestResolveReplacedDependency(t *testing.T) {
+	testHome(t)
+	quietWarnings(t)
+	forgetReplacements(t)
+	index := replacesIndex()
+	index.Packages["app"] = IndexPackage{Latest: "1.0.0", Versions: map[string]IndexVersion{
+		"1.0.0": {Dependencies: map[string]string{"oldmath": "^0.9", "io": "*"}},
+	}}
+	index.Packages["io"] = IndexPackage{Latest: "1.0.0", Versions: map[string]IndexVersion{
+		"1.0.0": {Dependencies: map[string]string{"math": "*"}},
+	}}
+	res, err := resolveDependencies(&index, "app", defaultMaxDepth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range res.Packages {
+		names = append(names, p.Name)
+	}
+	slices.Sort(names)
+	if want := []string{"app", "io", "math"}; !slices.Equal(names, want) {
+		t.Errorf("resolved %v, want %v", names, want)
+	}
+}
+
+func TestInstallReplacedName(t *testing.T) {
+	home := testHome(t)
+	noProgress = true
+	defer func() { noProgress = false }()
+	quietWarnings(t)
+	forgetReplacements(t)
+	index := replacesIndex()
+	index.Packages["app"] = IndexPackage{Latest: "1.0.0", Versions: map[string]IndexVersion{
+		"1.0.0": {Dependencies: map[string]string{"oldmath": "^0.9"}},
+	}}
+	writeCachedIndex(t, home, index)
+	reg := newTestRegistry(t, map[string][]byte{
+		"app.tar.gz":     gzipBytes(t, makeTar(t, []tarEntry{{name: "app/main.vira", body: "app"}})),
+		"math.tar.gz":    gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "2.0.0"}})),
+		"oldmath.tar.gz": gzipBytes(t, makeTar(t, []tarEntry{{name: "oldmath/lib.vira", body: "0.9.0"}})),
+	})
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, spec := range []string{"app", "oldmath@0.9.0"} {
+		if _, err := captureStdout(t, func() error {
+			return install(t.Context(), spec, InstallOptions{InProject: true, MaxDepth: defaultMaxDepth, NoScripts: true})
+		}); err != nil {
+			t.Fatalf("install %s: %v", spec, err)
+		}
+	}
+	if n := reg.count("oldmath.tar.gz"); n != 0 {
+		t.Errorf("oldmath was downloaded %d times", n)
+	}
+	installed, err := listInstalled(filepath.Join("build", "dependencies"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(installed)
+	if want := []string{"app", "math"}; !slices.Equal(installed, want) {
+		t.Errorf("installed %v, want %v", installed, want)
+	}
+	lock, err := readLock(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := slices.Sorted(maps.Keys(lock.Packages)); !slices.Equal(keys, []string{"app", "math"}) {
+		t.Errorf("lockfile holds %v, want app and math", keys)
+	}
+}
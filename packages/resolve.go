@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// defaultMaxDepth bounds how long a dependency chain may get before
+// resolution gives up, so pathological trees cannot run away. The
+// max-depth config setting and --max-depth override it.
+const defaultMaxDepth = 64
+
+// Dependency is one package in a resolved install set.
+type Dependency struct {
+	Name     string
+	Version  string
+	Optional bool
+}
+
+// Resolution is the outcome of resolveDependencies: the packages to
+// install and the peer dependencies the installed set expects to find.
+type Resolution struct {
+	Packages []Dependency
+	Peers    map[string]string
+}
+
+func splitSpec(spec string) (string, string) {
+	name, version, _ := strings.Cut(spec, "@")
+	return name, version
+}
+
+// pickVersion returns the version of pkg resolveConstraint picks for
+// constraint, or the package's latest version when none matches.
+func pickVersion(pkg IndexPackage, constraint string) string {
+	if v, err := resolveConstraint(pkg, constraint); err == nil {
+		return v
+	}
+	return pkg.Latest
+}
+
+// resolveConstraint returns constraint if the index has that exact
+// version, the version it points at if it names a channel, the latest
+// version for "" and "*", and otherwise the newest published version
+// that satisfies it as a range.
+func resolveConstraint(pkg IndexPackage, constraint string) (string, error) {
+	if constraint == "" || constraint == "*" {
+		return pkg.Latest, nil
+	}
+	if _, ok := pkg.Versions[constraint]; ok {
+		return constraint, nil
+	}
+	if _, ok := pkg.Channels[constraint]; ok || constraint == "latest" {
+		return resolveChannel(pkg, constraint)
+	}
+	if v, ok := newestSatisfying(pkg, constraint); ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("no published version satisfies %s", constraint)
+}
+
+// newestSatisfying returns the newest version of pkg that is not yanked
+// and satisfies constraint.
+func newestSatisfying(pkg IndexPackage, constraint string) (string, bool) {
+	var best string
+	var bestVersion [3]int
+	for v, meta := range pkg.Versions {
+		parsed, _, err := parseVersion(v)
+		if ok, _ := satisfies(v, constraint); !ok || err != nil || meta.Yanked {
+			continue
+		}
+		if best == "" || compareVersions(parsed, bestVersion) > 0 {
+			best, bestVersion = v, parsed
+		}
+	}
+	return best, best != ""
+}
+
+// resolveChannel returns the version a channel of pkg currently points
+// at; "latest" is always a channel for the latest version.
+func resolveChannel(pkg IndexPackage, channel string) (string, error) {
+	v, ok := pkg.Channels[channel]
+	if !ok && channel == "latest" && pkg.Latest != "" {
+		v, ok = pkg.Latest, true
+	}
+	if !ok {
+		return "", fmt.Errorf("no channel %s", channel)
+	}
+	if _, ok := pkg.Versions[v]; !ok {
+		return "", fmt.Errorf("channel %s points at unknown version %s", channel, v)
+	}
+	return v, nil
+}
+
+// channelSpec turns name@channel into name@version for the version the
+// channel points at now, so installs and the lockfile record a concrete
+// version. It also returns the channel, or "" when spec names none.
+func channelSpec(spec string) (string, string, error) {
+	name, channel := splitSpec(spec)
+	if channel == "" {
+		return spec, "", nil
+	}
+	index, err := loadIndex()
+	if err != nil {
+		return spec, "", nil
+	}
+	pkg, ok := index.lookup(name)
+	if !ok {
+		return spec, "", nil
+	}
+	if _, isChannel := pkg.Channels[channel]; !isChannel {
+		return spec, "", nil
+	}
+	v, err := resolveChannel(pkg, channel)
+	if err != nil {
+		return spec, "", fmt.Errorf("%s: %v", name, err)
+	}
+	return name + "@" + v, channel, nil
+}
+
+// resolveDependencies walks the dependencies of spec in the index.
+// Renamed packages resolve to the package that replaces them.
+// Overridden packages are resolved from their override first: a local
+// directory contributes the dependencies of its own bytes.yml.
+// Optional dependencies are left out with --no-optional and skipped with a
+// warning when missing from the index; peer dependencies are collected
+// for a presence check but not installed.
+// Chains longer than maxDepth are an error.
+func resolveDependencies(index *Index, spec string, maxDepth int) (*Resolution, error) {
+	defer stopwatch.phase("resolve")()
+	res := &Resolution{Peers: map[string]string{}}
+	seen := map[string]bool{}
+	var chain []string
+
+	var walk func(name, constraint string, optional bool) error
+	// walkAll walks a dependency table, with renamed packages replaced.
+	walkAll := func(deps map[string]string, optional bool) error {
+		var list []Dependency
+		for _, dep := range slices.Sorted(maps.Keys(deps)) {
+			list = append(list, Dependency{Name: dep, Version: deps[dep], Optional: optional})
+		}
+		for _, dep := range applyReplacements(list, index) {
+			if err := walk(dep.Name, dep.Version, dep.Optional); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	walk = func(name, constraint string, optional bool) error {
+		if seen[name] {
+			return nil
+		}
+		chain = append(chain, name)
+		defer func() { chain = chain[:len(chain)-1] }()
+		if len(chain) > maxDepth {
+			return fmt.Errorf("dependency chain exceeds max depth %d: %s", maxDepth, strings.Join(chain, " -> "))
+		}
+		target, overridden := overrideFor(name)
+		if overridden && !isOverrideURL(target) {
+			seen[name] = true
+			res.Packages = append(res.Packages, Dependency{Name: name, Version: "override", Optional: optional})
+			return walkAll(overrideDependencies(target), optional)
+		}
+		pkg, ok := index.lookup(name)
+		if !ok && overridden {
+			seen[name] = true
+			res.Packages = append(res.Packages, Dependency{Name: name, Version: "override", Optional: optional})
+			return nil
+		}
+		if !ok {
+			if optional {
+				warn(codeOptionalSkipped, name, "optional dependency %s is not available, skipping", name)
+				return nil
+			}
+			return fmt.Errorf("package %s not found in index", name)
+		}
+		seen[name] = true
+		version, err := resolveConstraint(pkg, constraint)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		res.Packages = append(res.Packages, Dependency{Name: name, Version: version, Optional: optional})
+
+		meta := pkg.Versions[version]
+		if err := walkAll(meta.Dependencies, optional); err != nil {
+			return err
+		}
+		if !noOptional {
+			if err := walkAll(meta.OptionalDependencies, true); err != nil {
+				return err
+			}
+		}
+		for dep, c := range meta.PeerDependencies {
+			res.Peers[dep] = c
+		}
+		return nil
+	}
+
+	name, version := splitSpec(spec)
+	if err := walkAll(map[string]string{name: version}, false); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// spec is what an install of d asks for: the bare name for the latest
+// version and overrides, name@version otherwise.
+func (d Dependency) spec(index *Index) string {
+	pkg, ok := index.lookup(d.Name)
+	if !ok || d.Version == "override" {
+		return d.Name
+	}
+	return bundleSpec(d.Name, d.Version, pkg)
+}
+
+// checkPeers warns about peer dependencies that are neither being installed
+// nor already installed in destDir, and about those whose version does not
+// match the range asked for.
+func checkPeers(res *Resolution, destDir string) {
+	installing := map[string]string{}
+	for _, dep := range res.Packages {
+		installing[dep.Name] = dep.Version
+	}
+	for _, peer := range slices.Sorted(maps.Keys(res.Peers)) {
+		constraint := res.Peers[peer]
+		versions := installedVersions(destDir, peer)
+		if v, ok := installing[peer]; ok {
+			versions = []string{v}
+		}
+		if len(versions) == 0 {
+			warn(codeMissingPeer, peer, "missing peer dependency %s %s, install it yourself", peer, constraint)
+			continue
+		}
+		if !slices.ContainsFunc(versions, func(v string) bool { return peerSatisfied(v, constraint) }) {
+			warn(codePeerMismatch, peer, "peer dependency %s %s is installed at %s", peer, constraint, strings.Join(versions, ", "))
+		}
+	}
+}
+
+// installedVersions returns the versions of name installed in destDir,
+// under its name or as name@version; "" stands for an unknown version.
+func installedVersions(destDir string, name string) []string {
+	installed, _ := listInstalled(destDir)
+	var versions []string
+	for _, full := range installed {
+		if n, _ := splitSpec(full); n != name {
+			continue
+		}
+		if meta, err := readInstalledMeta(filepath.Join(destDir, full)); err == nil {
+			versions = append(versions, meta.Version)
+		}
+	}
+	return versions
+}
+
+// peerSatisfied reports whether version meets a peer range. Unknown
+// versions, overrides and unreadable ranges get the benefit of the doubt.
+func peerSatisfied(version string, constraint string) bool {
+	if version == "" || version == "override" {
+		return true
+	}
+	ok, err := satisfies(version, constraint)
+	return ok || err != nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testIndex() *Index {
+	v := func(deps, optional map[string]string) IndexVersion {
+		return IndexVersion{Dependencies: deps, OptionalDependencies: optional}
+	}
+	return &Index{Packages: map[string]IndexPackage{
+		"app": {Latest: "2.0.0", Versions: map[string]IndexVersion{
+			"1.0.0": v(map[string]string{"legacy": "*"}, nil),
+			"2.0.0": v(map[string]string{"math": "*", "io": "*"}, map[string]string{"color": "*", "gone": "*"}),
+		}},
+		"math":   {Latest: "1.3.0", Versions: map[string]IndexVersion{"1.2.0": v(nil, nil), "1.3.0": v(map[string]string{"core": "*"}, nil)}},
+		"io":     {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": v(map[string]string{"core": "*"}, nil)}},
+		"core":   {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {PeerDependencies: map[string]string{"runtime": "^1"}}}},
+		"color":  {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": v(nil, nil)}},
+		"legacy": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": v(nil, nil)}},
+		"text":   {Latest: "3.0.0", Versions: map[string]IndexVersion{"3.0.0": v(nil, nil)}, Replaces: []string{"strings"}},
+		"loopa":  {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": v(map[string]string{"loopb": "*"}, nil)}},
+		"loopb":  {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": v(map[string]string{"loopa": "*"}, nil)}},
+		"deep1":  {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": v(map[string]string{"deep2": "*"}, nil)}},
+		"deep2":  {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": v(map[string]string{"deep3": "*"}, nil)}},
+		"deep3":  {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": v(nil, nil)}},
+		"geo":    {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": v(map[string]string{"math": ">=1.0 <1.3"}, nil)}},
+		"future": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": v(map[string]string{"math": "^2"}, nil)}},
+		"broken": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": v(map[string]string{"nowhere": "*"}, nil)}},
+	}}
+}
+
+func TestResolveDependencies(t *testing.T) {
+	tests := []struct {
+		name       string
+		spec       string
+		maxDepth   int
+		noOptional bool
+		want       []string
+		wantPeers  []string
+		wantErr    string
+	}{
+		{name: "latest", spec: "app", maxDepth: 8,
+			want:      []string{"app@2.0.0", "io@1.0.0", "core@1.0.0", "math@1.3.0", "color@1.0.0?"},
+			wantPeers: []string{"runtime"}},
+		{name: "pinned older version", spec: "app@1.0.0", maxDepth: 8,
+			want: []string{"app@1.0.0", "legacy@1.0.0"}},
+		{name: "no optional", spec: "app", maxDepth: 8, noOptional: true,
+			want:      []string{"app@2.0.0", "io@1.0.0", "core@1.0.0", "math@1.3.0"},
+			wantPeers: []string{"runtime"}},
+		{name: "exact dependency version", spec: "math@1.2.0", maxDepth: 8,
+			want: []string{"math@1.2.0"}},
+		{name: "replaced name", spec: "strings", maxDepth: 8,
+			want: []string{"text@3.0.0"}},
+		{name: "cycle", spec: "loopa", maxDepth: 8,
+			want: []string{"loopa@1.0.0", "loopb@1.0.0"}},
+		{name: "depth limit", spec: "deep1", maxDepth: 2,
+			wantErr: "exceeds max depth 2: deep1 -> deep2 -> deep3"},
+		{name: "range below latest", spec: "geo", maxDepth: 8,
+			want: []string{"geo@1.0.0", "math@1.2.0"}},
+		{name: "range below latest at the top", spec: "math@~1.2", maxDepth: 8,
+			want: []string{"math@1.2.0"}},
+		{name: "range nothing satisfies", spec: "future", maxDepth: 8,
+			wantErr: "math: no published version satisfies ^2"},
+		{name: "missing dependency", spec: "broken", maxDepth: 8,
+			wantErr: "package nowhere not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testHome(t)
+			warningsQuiet = true
+			noOptional = tt.noOptional
+			defer func() { noOptional, warningsQuiet = false, false }()
+
+			res, err := resolveDependencies(testIndex(), tt.spec, tt.maxDepth)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, dep := range res.Packages {
+				s := dep.Name + "@" + dep.Version
+				if dep.Optional {
+					s += "?"
+				}
+				got = append(got, s)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("resolved %v, want %v", got, tt.want)
+			}
+			if peers := slices.Sorted(maps.Keys(res.Peers)); !slices.Equal(peers, tt.wantPeers) {
+				t.Errorf("peers %v, want %v", peers, tt.wantPeers)
+			}
+		})
+	}
+}
+
+func TestResolveSkipsUnavailableOptional(t *testing.T) {
+	testHome(t)
+	warningsQuiet = true
+	defer func() { warningsQuiet = false }()
+	if _, err := resolveDependencies(testIndex(), "app", 8); err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, w := range collectedWarnings() {
+		if w.Package == "gone" {
+			codes = append(codes, w.Code)
+		}
+	}
+	if !slices.Contains(codes, codeOptionalSkipped) {
+		t.Errorf("warnings for gone: %v, want %s", codes, codeOptionalSkipped)
+	}
+}
+
+func TestCheckPeers(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed map[string]string // directory -> recorded version
+		resolved  []Dependency
+		want      string
+	}{
+		{"absent", nil, nil, codeMissingPeer},
+		{"archive only", nil, nil, codeMissingPeer},
+		{"installed by name", map[string]string{"core": "1.4.0"}, nil, ""},
+		{"installed as name@version", map[string]string{"core@1.2.0": "1.2.0"}, nil, ""},
+		{"installed outside the range", map[string]string{"core": "2.0.0"}, nil, codePeerMismatch},
+		{"one of several versions matches", map[string]string{"core@2.0.0": "2.0.0", "core@1.0.0": "1.0.0"}, nil, ""},
+		{"unknown installed version", map[string]string{"core": ""}, nil, ""},
+		{"being installed", nil, []Dependency{{Name: "core", Version: "1.1.0"}}, ""},
+		{"being installed outside the range", map[string]string{"core": "1.0.0"}, []Dependency{{Name: "core", Version: "3.0.0"}}, codePeerMismatch},
+		{"other package installed", map[string]string{"corex": "1.0.0"}, nil, codeMissingPeer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testHome(t)
+			warningsQuiet = true
+			defer func() { warningsQuiet = false }()
+			dest := t.TempDir()
+			if tt.name == "archive only" {
+				os.WriteFile(filepath.Join(dest, "core.tar.gz"), []byte("x"), 0644)
+			}
+			for dir, version := range tt.installed {
+				os.MkdirAll(filepath.Join(dest, dir), 0755)
+				if err := writeInstalledMeta(filepath.Join(dest, dir), InstalledMeta{Version: version}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before := len(collectedWarnings())
+			checkPeers(&Resolution{Packages: tt.resolved, Peers: map[string]string{"core": "^1"}}, dest)
+			var got string
+			if ws := collectedWarnings()[before:]; len(ws) > 0 {
+				got = ws[0].Code
+			}
+			if got != tt.want {
+				t.Errorf("warning %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstallFetchesResolvedVersion(t *testing.T) {
+	home := testHome(t)
+	noProgress = true
+	defer func() { noProgress = false }()
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"app": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Dependencies: map[string]string{"math": "^1.2 <1.3"}}}},
+		"math": {Latest: "1.3.0", Versions: map[string]IndexVersion{
+			"1.2.0": {}, "1.2.5": {}, "1.3.0": {},
+		}},
+	}})
+	reg := newTestRegistry(t, map[string][]byte{
+		"app.tar.gz":        gzipBytes(t, makeTar(t, []tarEntry{{name: "app/main.vira", body: "app"}})),
+		"math.tar.gz":       gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.3.0"}})),
+		"math@1.2.5.tar.gz": gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.2.5"}})),
+	})
+	prefix := t.TempDir()
+	if _, err := captureStdout(t, func() error {
+		return install(t.Context(), "app", InstallOptions{Prefix: prefix, MaxDepth: 8, NoScripts: true})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := reg.count("math.tar.gz"); n != 0 {
+		t.Errorf("latest math fetched %d times, want never", n)
+	}
+	if n := reg.count("math@1.2.5.tar.gz"); n != 1 {
+		t.Errorf("math@1.2.5 fetched %d times, want once", n)
+	}
+	dir, err := globalLibsDir(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "math@1.2.5", "lib.vira")); string(got) != "1.2.5" {
+		t.Errorf("installed math holds %q, want 1.2.5", got)
+	}
+}
+
+func TestResolveChannel(t *testing.T) {
+	pkg := IndexPackage{
+		Latest:   "1.2.0",
+		Channels: map[string]string{"stable": "1.2.0", "beta": "2.0.0-beta.1", "nightly": "3.0.0-dev"},
+		Versions: map[string]IndexVersion{"1.2.0": {}, "2.0.0-beta.1": {}},
+	}
+	tests := []struct {
+		pkg     IndexPackage
+		channel string
+		want    string
+		wantErr string
+	}{
+		{pkg, "stable", "1.2.0", ""},
+		{pkg, "beta", "2.0.0-beta.1", ""},
+		{pkg, "latest", "1.2.0", ""},
+		{IndexPackage{Latest: "1.2.0", Channels: map[string]string{"latest": "2.0.0-beta.1"}, Versions: pkg.Versions}, "latest", "2.0.0-beta.1", ""},
+		{pkg, "canary", "", "no channel canary"},
+		{IndexPackage{Versions: pkg.Versions}, "latest", "", "no channel latest"},
+		{pkg, "nightly", "", "channel nightly points at unknown version 3.0.0-dev"},
+	}
+	for _, tt := range tests {
+		got, err := resolveChannel(tt.pkg, tt.channel)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("resolveChannel(%s) = %q, %v, want %q", tt.channel, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("resolveChannel(%s) = %q, %v, want %q", tt.channel, got, err, tt.want)
+		}
+	}
+}
+
+func TestChannelSpec(t *testing.T) {
+	home := testHome(t)
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math": {
+			Latest:   "1.2.0",
+			Channels: map[string]string{"beta": "2.0.0-beta.1"},
+			Versions: map[string]IndexVersion{"1.2.0": {}, "2.0.0-beta.1": {}},
+		},
+	}})
+	tests := []struct {
+		spec        string
+		want        string
+		wantChannel string
+	}{
+		{"math@beta", "math@2.0.0-beta.1", "beta"},
+		{"math@1.2.0", "math@1.2.0", ""},
+		{"math", "math", ""},
+		// Unknown packages are left for install to report.
+		{"plot@beta", "plot@beta", ""},
+	}
+	for _, tt := range tests {
+		got, channel, err := channelSpec(tt.spec)
+		if err != nil || got != tt.want || channel != tt.wantChannel {
+			t.Errorf("channelSpec(%s) = %q, %q, %v, want %q, %q", tt.spec, got, channel, err, tt.want, tt.wantChannel)
+		}
+	}
+}
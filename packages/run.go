@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// runScript executes a script from the manifest's scripts table through the
+// shell in the current directory, the project root, with the shims
+// install links into projectBinDir on PATH. Without a name it lists the
+// available scripts.
+func runScript(name string, extra []string) error {
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		if len(m.ScriptNames) == 0 {
+			fmt.Println("No scripts defined in", manifestFile)
+			return nil
+		}
+		fmt.Println("Available scripts:")
+		for _, n := range m.ScriptNames {
+			fmt.Printf("  %s: %s\n", n, m.Scripts[n])
+		}
+		return nil
+	}
+	script, ok := m.Scripts[name]
+	if !ok {
+		return fmt.Errorf("no script named %s in %s", name, manifestFile)
+	}
+
+	cmd := shellCommand(script, extra)
+	binDir, err := filepath.Abs(projectBinDir())
+	if err != nil {
+		return err
+	}
+	cmd.Env = append(os.Environ(), "PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// splitRunArgs splits run's arguments into the script name and the
+// arguments after "--" that are forwarded to it. Anything else before
+// "--" is an error rather than being dropped.
+func splitRunArgs(args []string) (string, []string, error) {
+	var name string
+	for i, arg := range args {
+		if arg == "--" {
+			return name, args[i+1:], nil
+		}
+		if name != "" {
+			return "", nil, fmt.Errorf("unexpected argument %s, pass arguments for the script after --", arg)
+		}
+		name = arg
+	}
+	return name, nil, nil
+}
+
+// shellCommand runs script through the platform shell with extra arguments.
+func shellCommand(script string, extra []string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", append([]string{"/C", script}, extra...)...)
+	}
+	// "$@" forwards the extra arguments to the script unchanged.
+	return exec.Command("sh", append([]string{"-c", script + ` "$@"`, "sh"}, extra...)...)
+}
+
+// runLifecycleScript runs the named lifecycle script (e.g. "postinstall")
+// that pkgName declares in the index, inside the extracted package and
+// sandboxed when the config asks for it.
+func runLifecycleScript(pkgName string, stage string, pkgDir string) error {
+	script := packageScripts(pkgName)[stage]
+	if script == "" {
+		return nil
+	}
+	var err error
+	if policy := loadScriptPolicy(); policy.Sandbox {
+		err = runScriptSandboxed(script, pkgDir, policy)
+	} else {
+		cmd := shellCommand(script, nil)
+		cmd.Dir = pkgDir
+		cmd.Stdout, cmd.Stderr = scriptOutput(), os.Stderr
+		err = cmd.Run()
+	}
+	if err != nil {
+		return fmt.Errorf("%s script for %s failed: %v", stage, pkgName, err)
+	}
+	return nil
+}
+
+func packageScripts(pkgName string) map[string]string {
+	meta, _ := indexVersion(pkgName)
+	return meta.Scripts
+}
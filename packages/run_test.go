@@ -0,0 +1,35 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitRunArgs(t *testing.T) {
+	tests := []struct {
+		args      []string
+		wantName  string
+		wantExtra []string
+		wantErr   string
+	}{
+		{nil, "", nil, ""},
+		{[]string{"test"}, "test", nil, ""},
+		{[]string{"test", "--"}, "test", []string{}, ""},
+		{[]string{"test", "--", "-v", "--", "x"}, "test", []string{"-v", "--", "x"}, ""},
+		{[]string{"--", "-v"}, "", []string{"-v"}, ""},
+		{[]string{"test", "-v"}, "", nil, "unexpected argument -v, pass arguments for the script after --"},
+		{[]string{"test", "unit", "--", "-v"}, "", nil, "unexpected argument unit, pass arguments for the script after --"},
+	}
+	for _, tt := range tests {
+		name, extra, err := splitRunArgs(tt.args)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("splitRunArgs(%q) gave %v, want %q", tt.args, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || name != tt.wantName || !slices.Equal(extra, tt.wantExtra) {
+			t.Errorf("splitRunArgs(%q) = %q, %q, %v, want %q, %q", tt.args, name, extra, err, tt.wantName, tt.wantExtra)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// defaultScriptEnv is what a sandboxed script sees of the environment
+// unless script-env lists other variables.
+var defaultScriptEnv = []string{"PATH", "HOME", "TMPDIR", "LANG", "LC_ALL", "TERM"}
+
+// sandboxTools are tried in order when sandboxing is on and no
+// script-wrapper is configured.
+var sandboxTools = [][]string{
+	{"firejail", "--quiet", "--noprofile"},
+}
+
+// requireSandbox, set by --require-sandbox, fails scripts that cannot be
+// wrapped instead of running them with only a scrubbed environment.
+var requireSandbox bool
+
+// ScriptPolicy restricts lifecycle scripts, from the script-sandbox,
+// script-env and script-wrapper config settings.
+type ScriptPolicy struct {
+	Sandbox bool
+	// Env lists the variables passed through to the script.
+	Env []string
+	// Wrapper is the command scripts run under, such as firejail or
+	// nsjail with its arguments; empty picks one of sandboxTools.
+	Wrapper []string
+	Require bool
+}
+
+func loadScriptPolicy() ScriptPolicy {
+	policy := ScriptPolicy{Env: defaultScriptEnv, Require: requireSandbox}
+	values, err := readConfigValues()
+	if err != nil {
+		return policy
+	}
+	policy.Sandbox = values["script-sandbox"] == "true" || requireSandbox
+	if env := values["script-env"]; env != "" {
+		policy.Env = nil
+		for _, name := range strings.Split(env, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				policy.Env = append(policy.Env, name)
+			}
+		}
+	}
+	policy.Wrapper = strings.Fields(values["script-wrapper"])
+	return policy
+}
+
+// scrubbedEnv keeps only the allowed variables of the current environment.
+func scrubbedEnv(allowed []string) []string {
+	var env []string
+	for _, name := range allowed {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// sandboxWrapper returns the wrapper command to use, or nil when neither
+// the configured one nor any known tool is available.
+func sandboxWrapper(policy ScriptPolicy) []string {
+	candidates := sandboxTools
+	if len(policy.Wrapper) > 0 {
+		candidates = [][]string{policy.Wrapper}
+	}
+	for _, wrapper := range candidates {
+		if _, err := exec.LookPath(wrapper[0]); err == nil {
+			return wrapper
+		}
+	}
+	return nil
+}
+
+// runScriptSandboxed runs script in dir with a scrubbed environment and,
+// when one is available, under the policy's wrapper command. Without one
+// the script still runs, with a warning, unless the policy requires it.
+func runScriptSandboxed(script string, dir string, policy ScriptPolicy) error {
+	cmd := shellCommand(script, nil)
+	if wrapper := sandboxWrapper(policy); wrapper != nil {
+		args := append(append([]string{}, wrapper[1:]...), cmd.Args...)
+		cmd = exec.Command(wrapper[0], args...)
+	} else if policy.Require {
+		return fmt.Errorf("no sandbox tool available, set script-wrapper or drop --require-sandbox")
+	} else {
+		warn(codeNoSandbox, "", "no sandbox tool available, running script with a scrubbed environment only")
+	}
+	cmd.Dir = dir
+	cmd.Env = scrubbedEnv(policy.Env)
+	cmd.Stdout, cmd.Stderr = scriptOutput(), os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// scriptEnv reads back the environment a script dumped with env.
+func scriptEnv(t *testing.T, path string) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if name, value, ok := strings.Cut(line, "="); ok {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+func TestRunScriptSandboxed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("scripts run under sh")
+	}
+	t.Setenv("VIRA_TEST_SECRET", "hunter2")
+	t.Setenv("LANG", "C.UTF-8")
+	bin := t.TempDir()
+	// The wrapper notes it was used and runs the command it is given.
+	wrapper := filepath.Join(bin, "fakejail")
+	os.WriteFile(wrapper, []byte("#!/bin/sh\necho \"$1\" > \"$PWD/wrapped\"\nshift\nexec \"$@\"\n"), 0755)
+	tests := []struct {
+		name        string
+		policy      ScriptPolicy
+		wantEnv     []string
+		wantWrapped string
+		wantWarning bool
+		wantErr     string
+	}{
+		{"default allowlist", ScriptPolicy{Env: defaultScriptEnv, Wrapper: []string{"vira-no-such-sandbox"}}, []string{"PATH", "HOME", "LANG"}, "", true, ""},
+		{"configured allowlist", ScriptPolicy{Env: []string{"PATH", "VIRA_TEST_SECRET"}, Wrapper: []string{"vira-no-such-sandbox"}}, []string{"PATH", "VIRA_TEST_SECRET"}, "", true, ""},
+		{"under a wrapper", ScriptPolicy{Env: []string{"PATH"}, Wrapper: []string{wrapper, "--private"}}, []string{"PATH"}, "--private", false, ""},
+		{"sandbox required but missing", ScriptPolicy{Env: defaultScriptEnv, Wrapper: []string{"vira-no-such-sandbox"}, Require: true}, nil, "", false, "no sandbox tool available"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testHome(t)
+			quietWarnings(t)
+			pkgDir := t.TempDir()
+			_, err := captureStdout(t, func() error {
+				return runScriptSandboxed("env > env.txt; pwd > pwd.txt", pkgDir, tt.policy)
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				if _, err := os.Stat(filepath.Join(pkgDir, "env.txt")); !os.IsNotExist(err) {
+					t.Error("the script ran without the required sandbox")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			env := scriptEnv(t, filepath.Join(pkgDir, "env.txt"))
+			if _, ok := env["VIRA_TEST_SECRET"]; ok != slices.Contains(tt.wantEnv, "VIRA_TEST_SECRET") {
+				t.Errorf("VIRA_TEST_SECRET passed through: %v, want %v", ok, !ok)
+			}
+			for _, name := range tt.wantEnv {
+				if env[name] != os.Getenv(name) {
+					t.Errorf("script saw %s=%q, want %q", name, env[name], os.Getenv(name))
+				}
+			}
+			for name := range env {
+				// sh sets a few variables of its own.
+				if !slices.Contains(tt.policy.Env, name) && !slices.Contains([]string{"PWD", "SHLVL", "_", "OLDPWD"}, name) {
+					t.Errorf("script saw %s, which is not allowed", name)
+				}
+			}
+			pwd, _ := os.ReadFile(filepath.Join(pkgDir, "pwd.txt"))
+			if want, _ := filepath.EvalSymlinks(pkgDir); strings.TrimSpace(string(pwd)) != want && strings.TrimSpace(string(pwd)) != pkgDir {
+				t.Errorf("script ran in %s, want %s", pwd, pkgDir)
+			}
+			wrapped, _ := os.ReadFile(filepath.Join(pkgDir, "wrapped"))
+			if strings.TrimSpace(string(wrapped)) != tt.wantWrapped {
+				t.Errorf("wrapper saw %q, want %q", wrapped, tt.wantWrapped)
+			}
+			var warned bool
+			for _, w := range collectedWarnings() {
+				warned = warned || w.Code == codeNoSandbox
+			}
+			if warned != tt.wantWarning {
+				t.Errorf("no_sandbox warning: %v, want %v", warned, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestLoadScriptPolicy(t *testing.T) {
+	tests := []struct {
+		config      string
+		require     bool
+		wantSandbox bool
+		wantEnv     []string
+		wantWrapper []string
+	}{
+		{"", false, false, defaultScriptEnv, nil},
+		{"script-sandbox: true\n", false, true, defaultScriptEnv, nil},
+		{"", true, true, defaultScriptEnv, nil},
+		{"script-sandbox: true\nscript-env: PATH, CI,\nscript-wrapper: nsjail --quiet --\n", false, true, []string{"PATH", "CI"}, []string{"nsjail", "--quiet", "--"}},
+	}
+	for _, tt := range tests {
+		testHome(t)
+		os.MkdirAll(filepath.Dir(configPath()), 0755)
+		os.WriteFile(configPath(), []byte(tt.config), 0644)
+		requireSandbox = tt.require
+		policy := loadScriptPolicy()
+		requireSandbox = false
+		if policy.Sandbox != tt.wantSandbox || policy.Require != tt.require || !slices.Equal(policy.Env, tt.wantEnv) || !slices.Equal(policy.Wrapper, tt.wantWrapper) {
+			t.Errorf("config %q, require %v: got %+v", tt.config, tt.require, policy)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SBOMPackage is one resolved dependency as it goes into a bill of
+// materials.
+type SBOMPackage struct {
+	Name         string
+	Version      string
+	URL          string
+	Integrity    string
+	Dependencies []string
+}
+
+// CycloneDX 1.5 JSON, limited to the fields generateSBOM fills in.
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cdxComponent `json:"components"`
+	} `json:"tools"`
+	Component *cdxComponent `json:"component,omitempty"`
+}
+
+type cdxComponent struct {
+	Type               string           `json:"type"`
+	BOMRef             string           `json:"bom-ref,omitempty"`
+	Name               string           `json:"name"`
+	Version            string           `json:"version,omitempty"`
+	PURL               string           `json:"purl,omitempty"`
+	Hashes             []cdxHash        `json:"hashes,omitempty"`
+	ExternalReferences []cdxExternalRef `json:"externalReferences,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxExternalRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+var cdxHashAlgs = map[string]string{"md5": "MD5", "sha1": "SHA-1", "sha256": "SHA-256", "sha384": "SHA-384", "sha512": "SHA-512"}
+
+// cdxHashOf converts an integrity string to a CycloneDX hash, whose
+// content is always hex.
+func cdxHashOf(integrity string) (cdxHash, bool) {
+	algo, digest, ok := strings.Cut(integrity, "-")
+	alg, known := cdxHashAlgs[algo]
+	if !ok || !known {
+		return cdxHash{}, false
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		raw, err := base64.StdEncoding.DecodeString(digest)
+		if err != nil {
+			return cdxHash{}, false
+		}
+		digest = hex.EncodeToString(raw)
+	}
+	return cdxHash{Alg: alg, Content: strings.ToLower(digest)}, true
+}
+
+func sbomRef(name string, version string) string {
+	if version == "" {
+		return name
+	}
+	return name + "@" + version
+}
+
+// generateSBOM renders pkgs as a CycloneDX JSON document, with the
+// project described by m as the main component.
+func generateSBOM(pkgs []SBOMPackage, m *Manifest) ([]byte, error) {
+	serial := make([]byte, 16)
+	if _, err := rand.Read(serial); err != nil {
+		return nil, err
+	}
+	serial[6] = serial[6]&0x0f | 0x40
+	serial[8] = serial[8]&0x3f | 0x80
+	h := hex.EncodeToString(serial)
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: fmt.Sprintf("urn:uuid:%s-%s-%s-%s-%s", h[:8], h[8:12], h[12:16], h[16:20], h[20:]),
+		Version:      1,
+		Components:   []cdxComponent{},
+		Dependencies: []cdxDependency{},
+	}
+	bom.Metadata.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	bom.Metadata.Tools.Components = []cdxComponent{{Type: "application", Name: "vira-packages", Version: versionInfo().Version}}
+
+	refs := map[string]string{}
+	for _, p := range pkgs {
+		refs[p.Name] = sbomRef(p.Name, p.Version)
+	}
+	for _, p := range pkgs {
+		c := cdxComponent{Type: "library", BOMRef: refs[p.Name], Name: p.Name, Version: p.Version}
+		if p.Version != "" {
+			c.PURL = "pkg:generic/" + p.Name + "@" + p.Version
+		}
+		if hash, ok := cdxHashOf(p.Integrity); ok {
+			c.Hashes = []cdxHash{hash}
+		}
+		if p.URL != "" {
+			c.ExternalReferences = []cdxExternalRef{{Type: "distribution", URL: p.URL}}
+		}
+		bom.Components = append(bom.Components, c)
+		dep := cdxDependency{Ref: c.BOMRef, DependsOn: []string{}}
+		for _, d := range p.Dependencies {
+			if ref, ok := refs[d]; ok {
+				dep.DependsOn = append(dep.DependsOn, ref)
+			}
+		}
+		bom.Dependencies = append(bom.Dependencies, dep)
+	}
+	if m != nil && m.Name != "" {
+		root := cdxComponent{Type: "application", BOMRef: sbomRef(m.Name, m.Version), Name: m.Name, Version: m.Version}
+		bom.Metadata.Component = &root
+		dep := cdxDependency{Ref: root.BOMRef, DependsOn: []string{}}
+		direct := map[string]string{}
+		maps.Copy(direct, m.Dependencies)
+		maps.Copy(direct, m.DevDependencies)
+		for _, name := range slices.Sorted(maps.Keys(direct)) {
+			if ref, ok := refs[name]; ok {
+				dep.DependsOn = append(dep.DependsOn, ref)
+			}
+		}
+		bom.Dependencies = append(bom.Dependencies, dep)
+	}
+	data, err := json.MarshalIndent(bom, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// sbomPackages lists the packages of a lockfile for the current platform,
+// taking versions and dependency edges from the cached index when the
+// lockfile does not record them.
+func sbomPackages(lock *Lock) []SBOMPackage {
+	index, _ := loadIndex()
+	var pkgs []SBOMPackage
+	for _, key := range slices.Sorted(maps.Keys(lock.Packages)) {
+		entry := lock.Packages[key]
+		name, _ := splitSpec(key)
+		p := SBOMPackage{Name: name, Version: lockedVersion(key, entry)}
+		if resolved, ok := entry.resolved(currentPlatform()); ok {
+			p.URL, p.Integrity = resolved.URL, resolved.Integrity
+		}
+		if index != nil {
+			if pkg, ok := index.lookup(name); ok {
+				if p.Version == "" {
+					p.Version = pickVersion(pkg, "")
+				}
+				meta := pkg.Versions[p.Version]
+				deps := map[string]string{}
+				maps.Copy(deps, meta.Dependencies)
+				maps.Copy(deps, meta.OptionalDependencies)
+				p.Dependencies = slices.Sorted(maps.Keys(deps))
+			}
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs
+}
+
+// writeSBOM writes the SBOM of the project's lockfile to path, or to
+// stdout when path is empty.
+func writeSBOM(path string) error {
+	lock, err := readLock(lockFile)
+	if err != nil {
+		return err
+	}
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	data, err := generateSBOM(sbomPackages(lock), m)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
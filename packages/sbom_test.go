@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+)
+
+// checkCycloneDX checks the parts of the CycloneDX 1.5 schema that
+// generateSBOM fills in and returns the document.
+func checkCycloneDX(t *testing.T, data []byte) map[string]any {
+	t.Helper()
+	var bom map[string]any
+	if err := json.Unmarshal(data, &bom); err != nil {
+		t.Fatalf("SBOM is not JSON: %v", err)
+	}
+	if bom["bomFormat"] != "CycloneDX" || bom["specVersion"] != "1.5" || bom["version"] != 1.0 {
+		t.Errorf("bomFormat %v, specVersion %v, version %v", bom["bomFormat"], bom["specVersion"], bom["version"])
+	}
+	uuid := regexp.MustCompile(`^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if serial, _ := bom["serialNumber"].(string); !uuid.MatchString(serial) {
+		t.Errorf("serialNumber %q is not a version 4 UUID URN", serial)
+	}
+	metadata, _ := bom["metadata"].(map[string]any)
+	if ts, _ := metadata["timestamp"].(string); ts == "" {
+		t.Error("metadata has no timestamp")
+	} else if _, err := time.Parse(time.RFC3339, ts); err != nil {
+		t.Errorf("timestamp %q: %v", ts, err)
+	}
+	tools, _ := metadata["tools"].(map[string]any)
+	if components, _ := tools["components"].([]any); len(components) != 1 {
+		t.Errorf("metadata.tools.components = %v, want this tool", tools["components"])
+	}
+
+	refs := map[string]bool{}
+	components, ok := bom["components"].([]any)
+	if !ok {
+		t.Fatal("components is not an array")
+	}
+	if root, ok := metadata["component"].(map[string]any); ok {
+		components = append(components, root)
+	}
+	hexDigest := regexp.MustCompile(`^[0-9a-f]+$`)
+	for _, c := range components {
+		c := c.(map[string]any)
+		if c["type"] != "library" && c["type"] != "application" {
+			t.Errorf("component %v has type %v", c["name"], c["type"])
+		}
+		if c["name"] == "" || c["name"] == nil {
+			t.Errorf("component without a name: %v", c)
+		}
+		ref, _ := c["bom-ref"].(string)
+		if ref == "" || refs[ref] {
+			t.Errorf("bom-ref %q is missing or not unique", ref)
+		}
+		refs[ref] = true
+		hashes, _ := c["hashes"].([]any)
+		for _, h := range hashes {
+			h := h.(map[string]any)
+			content, _ := h["content"].(string)
+			if !slices.Contains([]string{"MD5", "SHA-1", "SHA-256", "SHA-384", "SHA-512"}, h["alg"].(string)) || !hexDigest.MatchString(content) {
+				t.Errorf("hash %v of %v is not a CycloneDX hash", h, c["name"])
+			}
+		}
+		externalRefs, _ := c["externalReferences"].([]any)
+		for _, r := range externalRefs {
+			if r := r.(map[string]any); r["type"] == "" || r["url"] == "" {
+				t.Errorf("external reference %v of %v lacks a type or URL", r, c["name"])
+			}
+		}
+	}
+	deps, ok := bom["dependencies"].([]any)
+	if !ok {
+		t.Fatal("dependencies is not an array")
+	}
+	for _, d := range deps {
+		d := d.(map[string]any)
+		if !refs[d["ref"].(string)] {
+			t.Errorf("dependency entry for unknown ref %v", d["ref"])
+		}
+		for _, on := range d["dependsOn"].([]any) {
+			if !refs[on.(string)] {
+				t.Errorf("%v depends on unknown ref %v", d["ref"], on)
+			}
+		}
+	}
+	return bom
+}
+
+// sbomComponent returns the component of bom with the given bom-ref.
+func sbomComponent(bom map[string]any, ref string) map[string]any {
+	for _, c := range bom["components"].([]any) {
+		if c := c.(map[string]any); c["bom-ref"] == ref {
+			return c
+		}
+	}
+	return nil
+}
+
+// sbomDependsOn returns what bom records ref depending on.
+func sbomDependsOn(bom map[string]any, ref string) []string {
+	for _, d := range bom["dependencies"].([]any) {
+		d := d.(map[string]any)
+		if d["ref"] != ref {
+			continue
+		}
+		var on []string
+		for _, r := range d["dependsOn"].([]any) {
+			on = append(on, r.(string))
+		}
+		return on
+	}
+	return nil
+}
+
+func TestGenerateSBOM(t *testing.T) {
+	mathSum := sha256.Sum256([]byte("math"))
+	ioSum := sha512.Sum512([]byte("io"))
+	pkgs := []SBOMPackage{
+		{Name: "math", Version: "1.1.0", URL: "https://registry.example/math@1.1.0.tar.gz", Integrity: "sha256-" + hex.EncodeToString(mathSum[:]), Dependencies: []string{"io", "unlisted"}},
+		{Name: "io", Version: "1.0.0", Integrity: "sha512-" + base64.StdEncoding.EncodeToString(ioSum[:])},
+		{Name: "local"},
+	}
+	m := &Manifest{Name: "app", Version: "0.1.0", Dependencies: map[string]string{"math": "^1.0"}, DevDependencies: map[string]string{"local": "*"}}
+	data, err := generateSBOM(pkgs, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bom := checkCycloneDX(t, data)
+
+	root, _ := bom["metadata"].(map[string]any)["component"].(map[string]any)
+	if root["bom-ref"] != "app@0.1.0" || root["type"] != "application" {
+		t.Errorf("main component %v, want the application app@0.1.0", root)
+	}
+	if got := sbomDependsOn(bom, "app@0.1.0"); !slices.Equal(got, []string{"local", "math@1.1.0"}) {
+		t.Errorf("app depends on %v, want local and math@1.1.0", got)
+	}
+	if got := sbomDependsOn(bom, "math@1.1.0"); !slices.Equal(got, []string{"io@1.0.0"}) {
+		t.Errorf("math depends on %v, want io@1.0.0 only", got)
+	}
+
+	math := sbomComponent(bom, "math@1.1.0")
+	if math["purl"] != "pkg:generic/math@1.1.0" {
+		t.Errorf("math purl %v", math["purl"])
+	}
+	if h := math["hashes"].([]any)[0].(map[string]any); h["alg"] != "SHA-256" || h["content"] != hex.EncodeToString(mathSum[:]) {
+		t.Errorf("math hash %v", h)
+	}
+	if r := math["externalReferences"].([]any)[0].(map[string]any); r["type"] != "distribution" || r["url"] != pkgs[0].URL {
+		t.Errorf("math external reference %v", r)
+	}
+	// Base64 digests are converted to the hex CycloneDX expects.
+	if h := sbomComponent(bom, "io@1.0.0")["hashes"].([]any)[0].(map[string]any); h["alg"] != "SHA-512" || h["content"] != hex.EncodeToString(ioSum[:]) {
+		t.Errorf("io hash %v", h)
+	}
+	local := sbomComponent(bom, "local")
+	for _, key := range []string{"version", "purl", "hashes", "externalReferences"} {
+		if _, ok := local[key]; ok {
+			t.Errorf("component without a version or checksum has %s", key)
+		}
+	}
+
+	// Without a project the components stand alone.
+	data, err = generateSBOM(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bom = checkCycloneDX(t, data)
+	if _, ok := bom["metadata"].(map[string]any)["component"]; ok {
+		t.Error("SBOM without a manifest has a main component")
+	}
+	if len(bom["components"].([]any)) != 0 || len(bom["dependencies"].([]any)) != 0 {
+		t.Errorf("empty SBOM has components %v and dependencies %v", bom["components"], bom["dependencies"])
+	}
+}
+
+func TestWriteSBOM(t *testing.T) {
+	home := testHome(t)
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math": {Latest: "1.1.0", Versions: map[string]IndexVersion{
+			"1.1.0": {Dependencies: map[string]string{"io": "^1.0"}, OptionalDependencies: map[string]string{"zlib": "*"}},
+		}},
+		"io":   {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+		"zlib": {Latest: "1.2.0", Versions: map[string]IndexVersion{"1.2.0": {}}},
+	}})
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	os.WriteFile(manifestFile, []byte("name: app\nversion: 0.1.0\ndependencies:\n  math: ^1.0\n"), 0644)
+	sum := sha256.Sum256([]byte("io"))
+	writeLock(lockFile, &Lock{Packages: map[string]*LockEntry{
+		// An older entry without a version takes the index's latest.
+		"math":       {URL: "https://registry.example/math.tar.gz"},
+		"io@1.0.0":   {Integrity: "sha256-" + hex.EncodeToString(sum[:])},
+		"zlib@1.2.0": {},
+	}})
+
+	out := filepath.Join("build", "sbom.json")
+	if err := writeSBOM(out); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bom := checkCycloneDX(t, data)
+	if got := len(bom["components"].([]any)); got != 3 {
+		t.Errorf("%d components, want math, io and zlib", got)
+	}
+	if got := sbomDependsOn(bom, "math@1.1.0"); !slices.Equal(got, []string{"io@1.0.0", "zlib@1.2.0"}) {
+		t.Errorf("math depends on %v, want io@1.0.0 and zlib@1.2.0", got)
+	}
+	if got := sbomDependsOn(bom, "app@0.1.0"); !slices.Equal(got, []string{"math@1.1.0"}) {
+		t.Errorf("app depends on %v, want math@1.1.0", got)
+	}
+}
+
+func TestCdxHashOf(t *testing.T) {
+	sum := sha256.Sum256([]byte("x"))
+	want := hex.EncodeToString(sum[:])
+	tests := []struct {
+		integrity string
+		wantOK    bool
+	}{
+		{"sha256-" + want, true},
+		{"sha256-" + base64.StdEncoding.EncodeToString(sum[:]), true},
+		{"blake3-" + want, false},
+		{"sha256", false},
+		{"sha256-not*base64", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		h, ok := cdxHashOf(tt.integrity)
+		if ok != tt.wantOK || (ok && (h.Alg != "SHA-256" || h.Content != want)) {
+			t.Errorf("cdxHashOf(%q) = %+v, %v", tt.integrity, h, ok)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// suggestNames returns up to max candidates within a small edit distance of
+// query, closest first. The threshold grows with the query length so short
+// names only match near-identical candidates.
+func suggestNames(query string, candidates []string, max int) []string {
+	threshold := 1 + len(query)/4
+	type scored struct {
+		name string
+		dist int
+	}
+	var matches []scored
+	for _, c := range candidates {
+		if d := levenshtein(query, c); d > 0 && d <= threshold {
+			matches = append(matches, scored{c, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].dist != matches[j].dist {
+			return matches[i].dist < matches[j].dist
+		}
+		return matches[i].name < matches[j].name
+	})
+	var out []string
+	for i := 0; i < len(matches) && i < max; i++ {
+		out = append(out, matches[i].name)
+	}
+	return out
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// notFoundError reports that name is not in the index, suggesting close
+// matches when there are any.
+func notFoundError(name string, index *Index) error {
+	suggestions := suggestNames(name, slices.Collect(maps.Keys(index.Packages)), 3)
+	if len(suggestions) == 0 {
+		return fmt.Errorf("package %s not found", name)
+	}
+	return fmt.Errorf("package %s not found, did you mean %s?", name, strings.Join(suggestions, " or "))
+}
+
+// SearchOptions control result ordering and count. Exact looks up one
+// package by its full name instead of searching; JSON prints the results
+// as JSON.
+type SearchOptions struct {
+	Sort  string // relevance, downloads, updated or name
+	Limit int    // 0 means no limit
+	Exact bool
+	JSON  bool
+}
+
+// SearchResult is one package in search --json output.
+type SearchResult struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Latest      string    `json:"latest,omitempty"`
+	Downloads   int64     `json:"downloads,omitempty"`
+	Updated     time.Time `json:"updated,omitzero"`
+}
+
+// SearchResults is the --json output of search.
+type SearchResults struct {
+	Results  []SearchResult `json:"results"`
+	Warnings []Warning      `json:"warnings"`
+}
+
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// searchExact prints the package named exactly query, scope included, and
+// fails when there is none, so scripts can use it as an existence check.
+// With JSON the full index entry is printed.
+func searchExact(index *Index, query string, asJSON bool) error {
+	pkg, ok := index.lookup(query)
+	if !ok {
+		return fmt.Errorf("no package named %s", query)
+	}
+	if asJSON {
+		return printJSON(struct {
+			Name string `json:"name"`
+			IndexPackage
+			Warnings []Warning `json:"warnings"`
+		}{query, pkg, collectedWarnings()})
+	}
+	fmt.Println(strings.TrimSpace(query + " " + pkg.Latest))
+	return nil
+}
+
+// relevance ranks how well name and description match q: exact name,
+// name prefix, name substring, then description only.
+func relevance(name string, q string) int {
+	name = strings.ToLower(name)
+	switch {
+	case name == q:
+		return 3
+	case strings.HasPrefix(name, q):
+		return 2
+	case strings.Contains(name, q):
+		return 1
+	}
+	return 0
+}
+
+// sortResults orders names in place. Ties fall back to name order, which
+// is the order results arrive in, so the output is deterministic.
+func sortResults(names []string, index *Index, q string, by string) error {
+	var less func(a, b string) bool
+	switch by {
+	case "", "relevance":
+		less = func(a, b string) bool {
+			return relevance(a, q) > relevance(b, q)
+		}
+	case "downloads":
+		less = func(a, b string) bool { return index.Packages[a].Downloads > index.Packages[b].Downloads }
+	case "updated":
+		less = func(a, b string) bool { return index.Packages[a].Updated.After(index.Packages[b].Updated) }
+	case "name":
+		return nil
+	default:
+		return fmt.Errorf("unknown sort order %q (use relevance, downloads, updated or name)", by)
+	}
+	sort.SliceStable(names, func(i, j int) bool { return less(names[i], names[j]) })
+	return nil
+}
+
+func search(query string, opts SearchOptions) error {
+	index, err := loadIndex()
+	if err != nil {
+		return err
+	}
+	if opts.Exact {
+		return searchExact(index, query, opts.JSON)
+	}
+	q := strings.ToLower(query)
+	index.loadAllShards()
+	var results []string
+	for _, name := range slices.Sorted(maps.Keys(index.Packages)) {
+		if strings.Contains(strings.ToLower(name), q) || strings.Contains(strings.ToLower(index.Packages[name].Description), q) {
+			results = append(results, name)
+		}
+	}
+	if len(results) == 0 && opts.JSON {
+		return printJSON(SearchResults{[]SearchResult{}, collectedWarnings()})
+	}
+	if len(results) == 0 {
+		fmt.Printf("No results for %s\n", query)
+		if suggestions := suggestNames(query, slices.Collect(maps.Keys(index.Packages)), 3); len(suggestions) > 0 {
+			fmt.Println("Did you mean", strings.Join(suggestions, " or ")+"?")
+		}
+		return nil
+	}
+	if err := sortResults(results, index, q, opts.Sort); err != nil {
+		return err
+	}
+	if opts.Limit > 0 && len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	if opts.JSON {
+		out := []SearchResult{}
+		for _, name := range results {
+			pkg := index.Packages[name]
+			out = append(out, SearchResult{name, pkg.Description, pkg.Latest, pkg.Downloads, pkg.Updated})
+		}
+		return printJSON(SearchResults{out, collectedWarnings()})
+	}
+	fmt.Printf("Search results for %s:\n", query)
+	for _, name := range results {
+		fmt.Println(strings.TrimSpace("- " + name + " " + index.Packages[name].Description))
+	}
+	return nil
+}
+
+func info(name string) error {
+	index, err := loadIndex()
+	if err != nil {
+		return err
+	}
+	pkg, ok := index.lookup(name)
+	if !ok {
+		return notFoundError(name, index)
+	}
+	fmt.Println(name)
+	if pkg.Description != "" {
+		fmt.Println(pkg.Description)
+	}
+	fmt.Println("latest:", pkg.Latest)
+	fmt.Println("versions:", strings.Join(slices.Sorted(maps.Keys(pkg.Versions)), ", "))
+	if deps := pkg.Versions[pkg.Latest].Dependencies; len(deps) > 0 {
+		fmt.Println("dependencies:")
+		for _, dep := range slices.Sorted(maps.Keys(deps)) {
+			fmt.Printf("  %s %s\n", dep, deps[dep])
+		}
+	}
+	return nil
+}
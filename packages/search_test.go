@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSuggestNames(t *testing.T) {
+	candidates := []string{"math", "matrix", "http", "json", "yaml"}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"mth", []string{"math"}},
+		{"jsno", []string{"json"}},
+		{"htp", []string{"http"}},
+		{"math", nil},
+		{"crypto", nil},
+		{"x", nil},
+	}
+	for _, tt := range tests {
+		if got := suggestNames(tt.query, candidates, 3); !slices.Equal(got, tt.want) {
+			t.Errorf("suggestNames(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+	if got := suggestNames("matx", candidates, 1); !slices.Equal(got, []string{"math"}) {
+		t.Errorf("suggestNames with max 1 = %v, want the closest match only", got)
+	}
+}
+
+func TestNotFoundError(t *testing.T) {
+	index := &Index{Packages: map[string]IndexPackage{"math": {}, "http": {}}}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"mth", "package mth not found, did you mean math?"},
+		{"crypto", "package crypto not found"},
+	}
+	for _, tt := range tests {
+		if err := notFoundError(tt.name, index); err.Error() != tt.want {
+			t.Errorf("notFoundError(%q) = %q, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	day := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	index := &Index{Packages: map[string]IndexPackage{
+		"bigmath":  {Description: "arbitrary precision", Downloads: 50, Updated: day.AddDate(0, 0, 2)},
+		"math":     {Description: "numerics", Downloads: 10, Updated: day},
+		"mathplot": {Description: "plots for math", Downloads: 50, Updated: day.AddDate(0, 0, 1)},
+		"stats":    {Description: "math statistics", Downloads: 90},
+	}}
+	// Name order, as search collects results.
+	names := []string{"bigmath", "math", "mathplot", "stats"}
+	tests := []struct {
+		by   string
+		want []string
+	}{
+		{"", []string{"math", "mathplot", "bigmath", "stats"}},
+		{"relevance", []string{"math", "mathplot", "bigmath", "stats"}},
+		{"downloads", []string{"stats", "bigmath", "mathplot", "math"}},
+		{"updated", []string{"bigmath", "mathplot", "math", "stats"}},
+		{"name", []string{"bigmath", "math", "mathplot", "stats"}},
+	}
+	for _, tt := range tests {
+		got := slices.Clone(names)
+		if err := sortResults(got, index, "math", tt.by); err != nil {
+			t.Fatalf("sortResults(%q): %v", tt.by, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("sortResults(%q) = %v, want %v", tt.by, got, tt.want)
+		}
+	}
+	if err := sortResults(slices.Clone(names), index, "math", "stars"); err == nil {
+		t.Error("unknown sort order was accepted")
+	}
+}
+
+func TestSearchLimit(t *testing.T) {
+	home := testHome(t)
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math":     {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}, Downloads: 10},
+		"mathplot": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}, Downloads: 30},
+		"bigmath":  {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}, Downloads: 20},
+	}})
+	out, err := captureStdout(t, func() error { return search("math", SearchOptions{Sort: "downloads", Limit: 2}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Search results for math:\n- mathplot\n- bigmath\n"
+	if out != want {
+		t.Errorf("search printed %q, want %q", out, want)
+	}
+}
+
+func TestSearchExact(t *testing.T) {
+	index := &Index{Packages: map[string]IndexPackage{
+		"math":        {Latest: "1.2.0"},
+		"matrix":      {Latest: "0.3.0"},
+		"@acme/math":  {Latest: "2.0.0"},
+		"@acme/stats": {Latest: "1.0.0"},
+	}}
+	tests := []struct {
+		query   string
+		want    string
+		wantErr string
+	}{
+		{"math", "math 1.2.0\n", ""},
+		{"@acme/math", "@acme/math 2.0.0\n", ""},
+		// A prefix of several packages is not guessed at.
+		{"mat", "", "no package named mat"},
+		{"stats", "", "no package named stats"},
+		{"crypto", "", "no package named crypto"},
+	}
+	for _, tt := range tests {
+		out, err := captureStdout(t, func() error { return searchExact(index, tt.query, false) })
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("searchExact(%q) = %v, want %q", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || out != tt.want {
+			t.Errorf("searchExact(%q) printed %q, %v, want %q", tt.query, out, err, tt.want)
+		}
+	}
+}
+
+func TestSearchExactHitAndMiss(t *testing.T) {
+	packages := map[string]IndexPackage{
+		"math":       {Latest: "1.2.0", Description: "Numbers", Versions: map[string]IndexVersion{"1.2.0": {}}},
+		"@acme/math": {Latest: "2.0.0", Description: "Acme numbers", Versions: map[string]IndexVersion{"2.0.0": {}}},
+	}
+	caches := []struct {
+		name  string
+		write func(t *testing.T, home string)
+	}{
+		{"cached index", func(t *testing.T, home string) { writeCachedIndex(t, home, Index{Packages: packages}) }},
+		{"sharded cache", func(t *testing.T, home string) { writeShardedCache(t, home, packages, 1) }},
+	}
+	for _, c := range caches {
+		t.Run(c.name, func(t *testing.T) {
+			c.write(t, testHome(t))
+			out, err := captureStdout(t, func() error { return search("@acme/math", SearchOptions{Exact: true}) })
+			if err != nil || out != "@acme/math 2.0.0\n" {
+				t.Errorf("hit printed %q, %v", out, err)
+			}
+			out, err = captureStdout(t, func() error { return search("@acme/math", SearchOptions{Exact: true, JSON: true}) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result struct {
+				Name        string                  `json:"name"`
+				Latest      string                  `json:"latest"`
+				Description string                  `json:"description"`
+				Versions    map[string]IndexVersion `json:"versions"`
+				Warnings    []Warning               `json:"warnings"`
+			}
+			if err := json.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("printed %q: %v", out, err)
+			}
+			if result.Name != "@acme/math" || result.Latest != "2.0.0" || result.Description != "Acme numbers" || len(result.Versions) != 1 || result.Warnings == nil {
+				t.Errorf("JSON hit %+v", result)
+			}
+			for _, miss := range []string{"mat", "acme/math", "@acme/mat"} {
+				out, err := captureStdout(t, func() error { return search(miss, SearchOptions{Exact: true, JSON: true}) })
+				if err == nil || out != "" {
+					t.Errorf("miss %q printed %q, %v, want only an error", miss, out, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ShardMeta describes a sharded index: registries too large for a single
+// index.json publish index/shards.json and one index/<prefix>.json per
+// name prefix, fetched only when a package in it is looked up or a search
+// needs it.
+type ShardMeta struct {
+	PrefixLength int               `json:"prefixLength"`
+	Shards       map[string]string `json:"shards"` // prefix -> integrity
+}
+
+// IndexShard holds the packages whose names start with one prefix.
+type IndexShard struct {
+	Packages map[string]IndexPackage `json:"packages"`
+}
+
+func shardDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".vira", "cache", "index")
+}
+
+func shardPrefix(name string, length int) string {
+	if len(name) < length {
+		return name
+	}
+	return name[:length]
+}
+
+func loadShardMeta() (*ShardMeta, error) {
+	data, err := os.ReadFile(filepath.Join(shardDir(), "shards.json"))
+	if err != nil {
+		return nil, err
+	}
+	var meta ShardMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("cached shard list is corrupt, run refresh: %v", err)
+	}
+	return &meta, nil
+}
+
+// fetchIndexShard returns the shard for prefix, from the cache when its
+// checksum still matches the shard list and from the registry otherwise.
+func fetchIndexShard(ctx context.Context, prefix string) (*IndexShard, error) {
+	meta, err := loadShardMeta()
+	if err != nil {
+		return nil, err
+	}
+	integrity, ok := meta.Shards[prefix]
+	if !ok {
+		return &IndexShard{Packages: map[string]IndexPackage{}}, nil
+	}
+	path := filepath.Join(shardDir(), prefix+".json")
+	if integrity == "" || verifyChecksum(path, integrity) != nil {
+		defer stopwatch.phase("refresh")()
+		data, _, err := fetchURL(ctx, registryURL()+"index/"+prefix+".json")
+		if err != nil {
+			return nil, err
+		}
+		if err := validateIndex(data); err != nil {
+			return nil, fmt.Errorf("shard %s: %v", prefix, err)
+		}
+		if err := writeFileAtomic(path, data, 0644); err != nil {
+			return nil, err
+		}
+		if integrity != "" {
+			if err := verifyChecksum(path, integrity); err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("shard %s: %v", prefix, err)
+			}
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var shard IndexShard
+	if err := json.Unmarshal(data, &shard); err != nil {
+		return nil, err
+	}
+	return &shard, nil
+}
+
+// refreshShards updates the cached shard list, dropping cached shards whose
+// checksum changed so they are refetched on next use. It reports false when
+// the registry only publishes a monolithic index.json.
+func refreshShards(ctx context.Context, checkOnly bool) (bool, error) {
+	data, status, err := fetchURL(ctx, registryURL()+"index/shards.json")
+	if status == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var meta ShardMeta
+	if err := json.Unmarshal(data, &meta); err != nil || meta.PrefixLength < 1 {
+		return true, fmt.Errorf("invalid shard list from registry")
+	}
+	if checkOnly {
+		return true, nil
+	}
+	if err := os.MkdirAll(shardDir(), 0755); err != nil {
+		return true, err
+	}
+	if old, err := loadShardMeta(); err == nil {
+		for prefix, integrity := range old.Shards {
+			if meta.Shards[prefix] != integrity || integrity == "" {
+				os.Remove(filepath.Join(shardDir(), prefix+".json"))
+			}
+		}
+	}
+	os.Remove(indexPath())
+	return true, writeFileAtomic(filepath.Join(shardDir(), "shards.json"), data, 0644)
+}
+
+// lookup finds a package, loading its shard on demand for sharded indexes.
+func (idx *Index) lookup(name string) (IndexPackage, bool) {
+	if idx.shards == nil {
+		pkg, ok := idx.Packages[name]
+		return pkg, ok
+	}
+	shardMu.Lock()
+	defer shardMu.Unlock()
+	if pkg, ok := idx.Packages[name]; ok {
+		return pkg, ok
+	}
+	idx.loadShard(shardPrefix(name, idx.shards.PrefixLength))
+	pkg, ok := idx.Packages[name]
+	return pkg, ok
+}
+
+// shardMu guards loading shards into the shared index; loadShard is only
+// called with it held.
+var shardMu sync.Mutex
+
+func (idx *Index) loadShard(prefix string) {
+	if idx.loaded[prefix] {
+		return
+	}
+	idx.loaded[prefix] = true
+	// Shards load on demand from index lookups, which run outside any
+	// command's context; an interrupt still ends the process.
+	shard, err := fetchIndexShard(context.Background(), prefix)
+	if err != nil {
+		warn(codeShardUnavailable, "", "%v", err)
+		return
+	}
+	for n, p := range shard.Packages {
+		idx.Packages[n] = p
+	}
+}
+
+// loadShardsMatching loads every shard that could hold a name starting
+// with query, so prefix lookups of a sharded index stay bounded.
+func (idx *Index) loadShardsMatching(query string) {
+	if idx.shards == nil {
+		return
+	}
+	shardMu.Lock()
+	defer shardMu.Unlock()
+	want := shardPrefix(query, idx.shards.PrefixLength)
+	for prefix := range idx.shards.Shards {
+		if strings.HasPrefix(prefix, want) {
+			idx.loadShard(prefix)
+		}
+	}
+}
+
+// loadAllShards loads every shard of a sharded index, for searches that
+// match anywhere in names and descriptions and so cannot be narrowed to a
+// prefix.
+func (idx *Index) loadAllShards() {
+	if idx.shards == nil {
+		return
+	}
+	shardMu.Lock()
+	defer shardMu.Unlock()
+	for prefix := range idx.shards.Shards {
+		idx.loadShard(prefix)
+	}
+}
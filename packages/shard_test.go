@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeShardedCache caches packages as a sharded index split by name
+// prefixes of length, with checksums so no shard is refetched.
+func writeShardedCache(t testing.TB, home string, packages map[string]IndexPackage, length int) {
+	t.Helper()
+	shards := map[string]map[string]IndexPackage{}
+	for name, pkg := range packages {
+		prefix := shardPrefix(name, length)
+		if shards[prefix] == nil {
+			shards[prefix] = map[string]IndexPackage{}
+		}
+		shards[prefix][name] = pkg
+	}
+	dir := filepath.Join(home, ".vira", "cache", "index")
+	os.MkdirAll(dir, 0755)
+	meta := ShardMeta{PrefixLength: length, Shards: map[string]string{}}
+	for prefix, pkgs := range shards {
+		data, _ := json.Marshal(IndexShard{Packages: pkgs})
+		if err := os.WriteFile(filepath.Join(dir, prefix+".json"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(data)
+		meta.Shards[prefix] = "sha256-" + hex.EncodeToString(sum[:])
+	}
+	data, _ := json.Marshal(meta)
+	if err := os.WriteFile(filepath.Join(dir, "shards.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchShardedIndex(t *testing.T) {
+	home := testHome(t)
+	writeShardedCache(t, home, map[string]IndexPackage{
+		"math":   {Latest: "1.0.0", Description: "Numbers"},
+		"matrix": {Latest: "1.0.0", Description: "Linear algebra"},
+		"io":     {Latest: "1.0.0", Description: "Streams and files"},
+		"big":    {Latest: "1.0.0", Description: "Arbitrary precision math"},
+	}, 2)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"ma", []string{"big", "math", "matrix"}},
+		{"ath", []string{"big", "math"}},
+		{"algebra", []string{"matrix"}},
+		{"files", []string{"io"}},
+	}
+	for _, tt := range tests {
+		out, err := captureStdout(t, func() error { return search(tt.query, SearchOptions{Sort: "name", JSON: true}) })
+		if err != nil {
+			t.Fatalf("search %s: %v", tt.query, err)
+		}
+		var results SearchResults
+		if err := json.Unmarshal([]byte(out), &results); err != nil {
+			t.Fatalf("search %s printed %q: %v", tt.query, out, err)
+		}
+		var got []string
+		for _, r := range results.Results {
+			got = append(got, r.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("search %s found %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// benchmarkPackages is a registry of n packages with two versions each.
+func benchmarkPackages(n int) map[string]IndexPackage {
+	packages := map[string]IndexPackage{}
+	for i := range n {
+		name := fmt.Sprintf("%c%c-pkg-%d", 'a'+i%26, 'a'+i/26%26, i)
+		versions := map[string]IndexVersion{}
+		for _, v := range []string{"1.0.0", "1.1.0"} {
+			versions[v] = IndexVersion{
+				URL:          "https://registry.example.com/" + name + "-" + v + ".tar.gz",
+				Integrity:    "sha256-" + strings.Repeat("0", 64),
+				Dependencies: map[string]string{"io": "^1"},
+			}
+		}
+		packages[name] = IndexPackage{Description: "Package number " + name, Latest: "1.1.0", Versions: versions}
+	}
+	return packages
+}
+
+// BenchmarkIndexLookup compares looking up one package with a fresh
+// index, as each command does, in a monolithic and a sharded cache.
+func BenchmarkIndexLookup(b *testing.B) {
+	packages := benchmarkPackages(20000)
+	target := "mw-pkg-1260" // in shard mw
+	for _, sharded := range []bool{false, true} {
+		name := "monolithic"
+		if sharded {
+			name = "sharded"
+		}
+		b.Run(name, func(b *testing.B) {
+			home := testHome(b)
+			if sharded {
+				writeShardedCache(b, home, packages, 2)
+			} else {
+				data, _ := json.Marshal(Index{Packages: packages})
+				os.MkdirAll(filepath.Dir(indexPath()), 0755)
+				os.WriteFile(indexPath(), data, 0644)
+			}
+			b.ResetTimer()
+			for range b.N {
+				indexMu.Lock()
+				cachedIndex = nil
+				indexMu.Unlock()
+				index, err := loadIndex()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, ok := index.lookup(target); !ok {
+					b.Fatal("package not found")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// exitInterrupted is the exit code after SIGINT or SIGTERM, as shells
+// report for Ctrl-C.
+const exitInterrupted = 130
+
+var (
+	cleanupMu sync.Mutex
+	cleanups  = map[string]int{}
+	inflight  sync.WaitGroup
+	// aborting is set once an interrupt is being handled; cleanedUp is
+	// closed when its cleanup is done.
+	aborting  atomic.Bool
+	cleanedUp = make(chan struct{})
+)
+
+// track registers a partial file or staging directory to be removed if
+// the process is interrupted. The returned func unregisters it once the
+// work is finished (or has removed it itself). Work cut short by an
+// interrupt returns the context's error as usual, and exit hands the
+// exit over to the signal handler.
+func track(path string) func() {
+	cleanupMu.Lock()
+	cleanups[path]++
+	cleanupMu.Unlock()
+	inflight.Add(1)
+	return func() {
+		cleanupMu.Lock()
+		if cleanups[path]--; cleanups[path] == 0 {
+			delete(cleanups, path)
+		}
+		cleanupMu.Unlock()
+		inflight.Done()
+	}
+}
+
+// handleSignals returns a context derived from parent that SIGINT and
+// SIGTERM cancel. The handler then gives in-flight work a moment to
+// unwind, removes what it left behind and exits with exitInterrupted. A
+// second signal exits immediately.
+func handleSignals(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancel(parent)
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		fmt.Fprintln(os.Stderr, "aborting, cleaning up...")
+		aborting.Store(true)
+		cancel()
+		go func() {
+			<-sigs
+			os.Exit(exitInterrupted)
+		}()
+		abortCleanup(2 * time.Second)
+		close(cleanedUp)
+		os.Exit(exitInterrupted)
+	}()
+	return ctx
+}
+
+// abortCleanup waits up to grace for tracked work to unwind, then removes
+// whatever is still tracked.
+func abortCleanup(grace time.Duration) {
+	unwound := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(unwound)
+	}()
+	select {
+	case <-unwound:
+	case <-time.After(grace):
+	}
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	for path := range cleanups {
+		os.RemoveAll(path)
+	}
+}
+
+// exit ends the process with code. While an interrupt is being handled it
+// waits for the handler's cleanup instead, and exits with exitInterrupted.
+func exit(code int) {
+	if aborting.Load() {
+		<-cleanedUp
+		code = exitInterrupted
+	}
+	os.Exit(code)
+}
+
+// ctxReader fails reads once ctx is cancelled, so copying a local stream
+// stops at an interrupt like a download does.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
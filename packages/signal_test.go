@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// leftovers lists the partial downloads, staging directories and package
+// directories below dir.
+func leftovers(t *testing.T, dir string) []string {
+	t.Helper()
+	var found []string
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := d.Name()
+		if strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".staging") || name == "math" || name == "lib.vira" {
+			found = append(found, path)
+		}
+		return nil
+	})
+	return found
+}
+
+func TestInstallCancelledMidDownload(t *testing.T) {
+	home := testHome(t)
+	noProgress = true
+	defer func() { noProgress = false }()
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+	}})
+	archive := gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: strings.Repeat("x", 64<<10)}}))
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+		w.Write(archive[:len(archive)/2])
+		w.(http.Flusher).Flush()
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	useClient(t, server.Client())
+	registryOverride = server.URL + "/"
+	defer func() { registryOverride = "" }()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	prefix := t.TempDir()
+	done := make(chan error, 1)
+	go func() {
+		done <- install(ctx, "math", InstallOptions{Prefix: prefix, MaxDepth: 8, NoScripts: true})
+	}()
+	<-started
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("install returned %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("install did not return after cancellation")
+	}
+	if found := leftovers(t, prefix); len(found) > 0 {
+		t.Errorf("cancelled install left %v", found)
+	}
+	if len(cleanups) != 0 {
+		t.Errorf("still tracking %v", cleanups)
+	}
+}
+
+// cancelAfter cancels once the first read of r has been served.
+type cancelAfter struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (c *cancelAfter) Read(p []byte) (int, error) {
+	defer c.cancel()
+	return c.r.Read(p[:min(len(p), 512)])
+}
+
+func TestExtractCancelledMidArchive(t *testing.T) {
+	testHome(t)
+	noise := make([]byte, 64<<10)
+	rand.Read(noise)
+	archive := makeTar(t, []tarEntry{{name: "math/a.vira", body: "a"}, {name: "math/lib.vira", body: string(noise)}})
+	ctx, cancel := context.WithCancel(t.Context())
+	dest := filepath.Join(t.TempDir(), "math")
+	err := extractStream(ctx, &cancelAfter{r: strings.NewReader(string(gzipBytes(t, archive))), cancel: cancel}, "math.tar.gz", dest, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("extract returned %v, want context.Canceled", err)
+	}
+	if found := leftovers(t, filepath.Dir(dest)); len(found) > 0 {
+		t.Errorf("cancelled extraction left %v", found)
+	}
+}
+
+func TestAbortCleanupRemovesTracked(t *testing.T) {
+	dir := t.TempDir()
+	part := filepath.Join(dir, "math.tar.gz.part")
+	staging := filepath.Join(dir, "math.staging")
+	os.WriteFile(part, []byte("partial"), 0644)
+	os.MkdirAll(filepath.Join(staging, "math"), 0755)
+	untrackPart, untrackStaging := track(part), track(staging)
+
+	// Work that does not unwind within the grace period is cleaned up
+	// after it.
+	abortCleanup(10 * time.Millisecond)
+	untrackPart()
+	untrackStaging()
+	for _, path := range []string{part, staging} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s survived the cleanup: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// resolveInstallTarget maps what the user typed to a package name. An
+// exact name always wins; otherwise a prefix of exactly one package picks
+// it, and a prefix of several returns them as candidates with no match.
+func resolveInstallTarget(query string, index *Index) (string, []string, error) {
+	if _, ok := index.lookup(query); ok {
+		return query, nil, nil
+	}
+	index.loadShardsMatching(query)
+	var candidates []string
+	for _, name := range slices.Sorted(maps.Keys(index.Packages)) {
+		if strings.HasPrefix(name, query) {
+			candidates = append(candidates, name)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return "", nil, notFoundError(query, index)
+	case 1:
+		return candidates[0], nil, nil
+	}
+	return "", candidates, nil
+}
+
+// pickInstallTarget expands a partial package name in spec, keeping any
+// @version. Ambiguous names are asked about on a terminal and are an
+// error listing the candidates otherwise. Overrides, names matching
+// nothing and installs without a cached index are left to install.
+func pickInstallTarget(spec string, interactive bool) (string, error) {
+	name, version := splitSpec(spec)
+	if _, ok := overrideFor(name); ok {
+		return spec, nil
+	}
+	index, err := loadIndex()
+	if err != nil {
+		return spec, nil
+	}
+	match, candidates, err := resolveInstallTarget(name, index)
+	if err != nil {
+		// The registry may still serve packages the index does not list.
+		return spec, nil
+	}
+	if match == "" {
+		if !interactive {
+			return "", fmt.Errorf("%s is ambiguous, specify one of: %s", name, strings.Join(candidates, ", "))
+		}
+		if match, err = promptChoice(name, candidates); err != nil {
+			return "", err
+		}
+	} else if match != name {
+		notify(match, "Using %s for %s", match, name)
+	}
+	if version != "" {
+		return match + "@" + version, nil
+	}
+	return match, nil
+}
+
+// promptChoice asks on stdin which of candidates was meant.
+func promptChoice(name string, candidates []string) (string, error) {
+	fmt.Printf("%s matches several packages:\n", name)
+	for i, c := range candidates {
+		fmt.Printf("  %d) %s\n", i+1, c)
+	}
+	fmt.Print("Install which? ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("no package chosen")
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || n < 1 || n > len(candidates) {
+		return "", fmt.Errorf("no package chosen")
+	}
+	return candidates[n-1], nil
+}
+
+// stdinIsTerminal reports whether a user can answer prompts.
+func stdinIsTerminal() bool {
+	return isTerminal(os.Stdin.Fd())
+}
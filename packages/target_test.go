@@ -0,0 +1,78 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolveInstallTarget(t *testing.T) {
+	index := &Index{Packages: map[string]IndexPackage{
+		"mat":    {},
+		"math":   {},
+		"matrix": {},
+		"json":   {},
+	}}
+	tests := []struct {
+		query          string
+		want           string
+		wantCandidates []string
+		wantErr        string
+	}{
+		{"json", "json", nil, ""},
+		{"js", "json", nil, ""},
+		// An exact name wins over the packages it is a prefix of.
+		{"mat", "mat", nil, ""},
+		{"ma", "", []string{"mat", "math", "matrix"}, ""},
+		{"mth", "", nil, "did you mean math?"},
+		{"crypto", "", nil, "package crypto not found"},
+	}
+	for _, tt := range tests {
+		got, candidates, err := resolveInstallTarget(tt.query, index)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("resolveInstallTarget(%q) = %v, want an error containing %q", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want || !slices.Equal(candidates, tt.wantCandidates) {
+			t.Errorf("resolveInstallTarget(%q) = %q, %v, %v, want %q, %v", tt.query, got, candidates, err, tt.want, tt.wantCandidates)
+		}
+	}
+}
+
+func TestPickInstallTarget(t *testing.T) {
+	home := testHome(t)
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math":   {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+		"matrix": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+	}})
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr string
+	}{
+		{"math", "math", ""},
+		{"matr@1.0.0", "matrix@1.0.0", ""},
+		{"mat", "", "mat is ambiguous, specify one of: math, matrix"},
+		// Unknown names are left for install to report.
+		{"crypto", "crypto", ""},
+	}
+	for _, tt := range tests {
+		var got string
+		_, err := captureStdout(t, func() error {
+			var err error
+			got, err = pickInstallTarget(tt.spec, false)
+			return err
+		})
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("pickInstallTarget(%q) = %v, want %q", tt.spec, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("pickInstallTarget(%q) = %q, %v, want %q", tt.spec, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+// ttyWidth is unknown on platforms without TIOCGWINSZ, which get plain
+// progress lines.
+func ttyWidth(fd uintptr) (int, bool) {
+	return 0, false
+}
+
+// isTerminal is false where terminals cannot be detected, so prompts are
+// replaced by errors.
+func isTerminal(fd uintptr) bool {
+	return false
+}
@@ -0,0 +1,33 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+type winsize struct {
+	Row, Col, Xpixel, Ypixel uint16
+}
+
+func getWinsize(fd uintptr) (winsize, bool) {
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	return ws, errno == 0
+}
+
+// ttyWidth asks the terminal behind fd for its size.
+func ttyWidth(fd uintptr) (int, bool) {
+	ws, ok := getWinsize(fd)
+	if !ok || ws.Col == 0 {
+		return 0, false
+	}
+	return int(ws.Col), true
+}
+
+// isTerminal reports whether fd is a terminal, even one without a size.
+func isTerminal(fd uintptr) bool {
+	_, ok := getWinsize(fd)
+	return ok
+}
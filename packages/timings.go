@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// timingPhases are the install phases --timings reports, in order.
+var timingPhases = []string{"refresh", "resolve", "download", "verify", "extract"}
+
+// timingsFlag is the value of --timings: "table", "json" or off. A bare
+// --timings means table.
+type timingsFlag string
+
+func (f *timingsFlag) String() string { return string(*f) }
+
+func (f *timingsFlag) IsBoolFlag() bool { return true }
+
+func (f *timingsFlag) Set(value string) error {
+	switch value {
+	case "true", "table":
+		*f = "table"
+	case "json":
+		*f = "json"
+	case "false":
+		*f = ""
+	default:
+		return fmt.Errorf("want table or json")
+	}
+	return nil
+}
+
+// timingsOption registers --timings for a command.
+func timingsOption() *timingsFlag {
+	f := new(timingsFlag)
+	flag.Var(f, "timings", "Print how long each phase and download took (--timings=json for JSON)")
+	return f
+}
+
+// Stopwatch accumulates time spent per phase and per package download.
+// Phases running concurrently, as with --parallel-extract, add up, so
+// they can exceed the wall-clock total.
+type Stopwatch struct {
+	mu        sync.Mutex
+	start     time.Time
+	phases    map[string]time.Duration
+	downloads map[string]time.Duration
+}
+
+// stopwatch is nil unless --timings is set; its methods do nothing then.
+var stopwatch *Stopwatch
+
+func startStopwatch() {
+	stopwatch = &Stopwatch{start: time.Now(), phases: map[string]time.Duration{}, downloads: map[string]time.Duration{}}
+}
+
+// phase starts timing name and returns the function that stops it, for
+// use as defer stopwatch.phase("resolve")().
+func (s *Stopwatch) phase(name string) func() {
+	if s == nil {
+		return func() {}
+	}
+	began := time.Now()
+	return func() {
+		s.mu.Lock()
+		s.phases[name] += time.Since(began)
+		s.mu.Unlock()
+	}
+}
+
+// download times the download of one package, which also counts towards
+// the download phase.
+func (s *Stopwatch) download(pkgName string) func() {
+	if s == nil {
+		return func() {}
+	}
+	began := time.Now()
+	return func() {
+		d := time.Since(began)
+		s.mu.Lock()
+		s.phases["download"] += d
+		s.downloads[pkgName] += d
+		s.mu.Unlock()
+	}
+}
+
+type timingReport struct {
+	TotalMS   int64            `json:"totalMs"`
+	Phases    map[string]int64 `json:"phases"`
+	Downloads map[string]int64 `json:"downloads"`
+}
+
+// print writes the summary: a table, or JSON with milliseconds. It goes to
+// stderr with --events, whose stream owns stdout.
+func (s *Stopwatch) print(format timingsFlag) error {
+	if s == nil || format == "" {
+		return nil
+	}
+	var out io.Writer = os.Stdout
+	if eventsEnabled() {
+		out = os.Stderr
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := time.Since(s.start)
+	if format == "json" {
+		report := timingReport{TotalMS: total.Milliseconds(), Phases: map[string]int64{}, Downloads: map[string]int64{}}
+		for _, phase := range timingPhases {
+			report.Phases[phase] = s.phases[phase].Milliseconds()
+		}
+		for pkg, d := range s.downloads {
+			report.Downloads[pkg] = d.Milliseconds()
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+	fmt.Fprintln(out, "Timings:")
+	for _, phase := range timingPhases {
+		fmt.Fprintf(out, "  %-10s %10s\n", phase, formatDuration(s.phases[phase]))
+	}
+	fmt.Fprintf(out, "  %-10s %10s\n", "total", formatDuration(total))
+	if len(s.downloads) > 0 {
+		fmt.Fprintln(out, "Downloads:")
+		for _, pkg := range slices.Sorted(maps.Keys(s.downloads)) {
+			fmt.Fprintf(out, "  %-20s %10s\n", pkg, formatDuration(s.downloads[pkg]))
+		}
+	}
+	return nil
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
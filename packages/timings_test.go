@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestInstallTimings(t *testing.T) {
+	home := testHome(t)
+	noProgress = true
+	defer func() { noProgress = false }()
+	appArchive := gzipBytes(t, makeTar(t, []tarEntry{{name: "app/main.vira", body: "app"}}))
+	mathArchive := gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.0.0"}}))
+	// A sha512 checksum is not the algorithm downloads are hashed with,
+	// so math's archive is read back to verify it.
+	sum := sha512.Sum512(mathArchive)
+	index, _ := json.Marshal(Index{Packages: map[string]IndexPackage{
+		"app":  {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Dependencies: map[string]string{"math": "^1.0"}}}},
+		"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Integrity: "sha512-" + base64.StdEncoding.EncodeToString(sum[:])}}},
+	}})
+	newTestRegistry(t, map[string][]byte{"index.json": index, "app.tar.gz": appArchive, "math.tar.gz": mathArchive})
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{}})
+
+	startStopwatch()
+	defer func() { stopwatch = nil }()
+	if _, err := captureStdout(t, func() error {
+		if err := refresh(t.Context(), false, true); err != nil {
+			return err
+		}
+		return install(t.Context(), "app", InstallOptions{Prefix: t.TempDir(), MaxDepth: defaultMaxDepth, NoScripts: true})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, phase := range timingPhases {
+		if _, ok := stopwatch.phases[phase]; !ok {
+			t.Errorf("phase %s was not timed", phase)
+		}
+	}
+	if got := slices.Sorted(maps.Keys(stopwatch.downloads)); !slices.Equal(got, []string{"app", "math"}) {
+		t.Errorf("timed downloads %v, want app and math", got)
+	}
+
+	out, err := captureStdout(t, func() error { return stopwatch.print("table") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range append(slices.Clone(timingPhases), "total", "Downloads:", "app", "math") {
+		if !strings.Contains(out, "\n  "+row+" ") && !strings.Contains(out, "\n"+row) {
+			t.Errorf("table has no %s row:\n%s", row, out)
+		}
+	}
+
+	out, err = captureStdout(t, func() error { return stopwatch.print("json") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report timingReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("--timings=json output is not JSON: %v\n%s", err, out)
+	}
+	if got := slices.Sorted(maps.Keys(report.Phases)); !slices.Equal(got, slices.Sorted(slices.Values(timingPhases))) {
+		t.Errorf("JSON phases %v, want %v", got, timingPhases)
+	}
+	if got := slices.Sorted(maps.Keys(report.Downloads)); !slices.Equal(got, []string{"app", "math"}) {
+		t.Errorf("JSON downloads %v, want app and math", got)
+	}
+}
+
+func TestTimingsOff(t *testing.T) {
+	stopwatch = nil
+	stopwatch.phase("resolve")()
+	stopwatch.download("math")()
+	out, err := captureStdout(t, func() error { return stopwatch.print("table") })
+	if err != nil || out != "" {
+		t.Errorf("print without --timings = %q, %v", out, err)
+	}
+
+	startStopwatch()
+	defer func() { stopwatch = nil }()
+	out, err = captureStdout(t, func() error { return stopwatch.print("") })
+	if err != nil || out != "" {
+		t.Errorf("print with timings off = %q, %v", out, err)
+	}
+}
+
+func TestTimingsFlag(t *testing.T) {
+	for value, want := range map[string]timingsFlag{"true": "table", "table": "table", "json": "json", "false": ""} {
+		var f timingsFlag
+		if err := f.Set(value); err != nil || f != want {
+			t.Errorf("--timings=%s gave %q, %v, want %q", value, f, err, want)
+		}
+	}
+	var f timingsFlag
+	if err := f.Set("csv"); err == nil {
+		t.Error("--timings=csv was accepted")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The trust store remembers the checksum each name@version had when it
+// was first installed, so a registry that later serves different bytes for
+// the same version is caught even when it publishes no signatures.
+var tofuMu sync.Mutex
+
+func tofuPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".vira", "tofu.json")
+}
+
+func readTrustStore() (map[string]string, error) {
+	store := map[string]string{}
+	data, err := os.ReadFile(tofuPath())
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return nil, fmt.Errorf("%s is corrupt (%v), delete it to trust packages afresh", tofuPath(), err)
+	}
+	return store, nil
+}
+
+func writeTrustStore(store map[string]string) error {
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(tofuPath()), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(tofuPath(), append(data, '\n'), 0644)
+}
+
+// tofuCheck compares the digest of the archive downloaded for pkg with
+// the one recorded the first time its version was installed, recording it
+// if there is none. The archive lets a digest recorded with another
+// algorithm be checked. Packages without a known version are not tracked.
+func tofuCheck(pkg Package, digest string) error {
+	if pkg.Version == "" || digest == "" {
+		return nil
+	}
+	key := pkg.Name + "@" + pkg.Version
+
+	tofuMu.Lock()
+	defer tofuMu.Unlock()
+	store, err := readTrustStore()
+	if err != nil {
+		return err
+	}
+	trusted, ok := store[key]
+	if !ok {
+		store[key] = digest
+		return writeTrustStore(store)
+	}
+	if sameIntegrity(trusted, digest) {
+		return nil
+	}
+	if algo, _, _ := strings.Cut(trusted, "-"); !strings.HasPrefix(digest, algo+"-") && verifyChecksum(pkg.Archive, trusted) == nil {
+		return nil
+	}
+	os.Remove(pkg.Archive)
+	fmt.Fprintf(os.Stderr, "WARNING: %s changed since it was first installed. The registry may have been tampered with.\n", key)
+	fmt.Fprintf(os.Stderr, "WARNING: if the change is expected, run install --tofu-reset %s\n", pkg.Name)
+	return &IntegrityError{Mismatches: []string{fmt.Sprintf("%s: first installed as %s, now %s", key, trusted, digest)}}
+}
+
+// tofuReset forgets the recorded checksums of pkgName: every version, or
+// only the one given as name@version.
+func tofuReset(pkgName string) error {
+	tofuMu.Lock()
+	defer tofuMu.Unlock()
+	store, err := readTrustStore()
+	if err != nil {
+		return err
+	}
+	name, version := splitSpec(pkgName)
+	removed := 0
+	for key := range store {
+		n, v := splitSpec(key)
+		if n == name && (version == "" || v == version) {
+			delete(store, key)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return fmt.Errorf("no trusted checksum recorded for %s", pkgName)
+	}
+	return writeTrustStore(store)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTofuCheck(t *testing.T) {
+	testHome(t)
+	archive := []byte("math 1.0.0")
+	path := filepath.Join(t.TempDir(), "math.tar.gz")
+	os.WriteFile(path, archive, 0644)
+	sum := sha256.Sum256(archive)
+	digest := "sha256-" + hex.EncodeToString(sum[:])
+	pkg := Package{Name: "math", Version: "1.0.0", Archive: path}
+
+	// First install: the digest is recorded.
+	if err := tofuCheck(pkg, digest); err != nil {
+		t.Fatal(err)
+	}
+	store, err := readTrustStore()
+	if err != nil || store["math@1.0.0"] != digest {
+		t.Fatalf("trust store %v, %v, want math@1.0.0 recorded as %s", store, err, digest)
+	}
+
+	// Reinstall: the same bytes match, whatever algorithm they are hashed with.
+	sum512 := sha512.Sum512(archive)
+	for _, d := range []string{digest, "sha512-" + base64.StdEncoding.EncodeToString(sum512[:])} {
+		if err := tofuCheck(pkg, d); err != nil {
+			t.Errorf("reinstall with %s: %v", d, err)
+		}
+	}
+
+	// Other versions, and packages without one, are tracked apart.
+	if err := tofuCheck(Package{Name: "math", Version: "1.1.0", Archive: path}, "sha256-"+strings.Repeat("1", 64)); err != nil {
+		t.Errorf("first install of another version: %v", err)
+	}
+	if err := tofuCheck(Package{Name: "math", Archive: path}, "sha256-"+strings.Repeat("2", 64)); err != nil {
+		t.Errorf("package without a version: %v", err)
+	}
+
+	// Changed checksum: refused, and the archive is removed.
+	var integrityErr *IntegrityError
+	if err := tofuCheck(pkg, "sha256-"+strings.Repeat("0", 64)); !errors.As(err, &integrityErr) {
+		t.Fatalf("changed checksum gave %v, want an integrity error", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("archive with a changed checksum was kept: %v", err)
+	}
+}
+
+func TestInstallRefusesChangedArchive(t *testing.T) {
+	home := testHome(t)
+	noProgress = true
+	defer func() { noProgress = false }()
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+	}})
+	original := gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.0.0"}}))
+	reg := newTestRegistry(t, map[string][]byte{"math.tar.gz": original})
+	opts := InstallOptions{Prefix: t.TempDir(), MaxDepth: 8, NoScripts: true, Force: true}
+	reinstall := func() error {
+		_, err := captureStdout(t, func() error { return install(t.Context(), "math", opts) })
+		return err
+	}
+
+	if err := reinstall(); err != nil {
+		t.Fatalf("first install: %v", err)
+	}
+	if err := reinstall(); err != nil {
+		t.Fatalf("reinstall of the same archive: %v", err)
+	}
+	reg.mu.Lock()
+	reg.files["math.tar.gz"] = gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "tampered"}}))
+	reg.mu.Unlock()
+	var integrityErr *IntegrityError
+	if err := reinstall(); !errors.As(err, &integrityErr) || !strings.Contains(err.Error(), "math@1.0.0: first installed as") {
+		t.Fatalf("reinstall of a changed archive gave %v, want a trust error", err)
+	}
+	dir, err := globalLibsDir(opts.Prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "math", "lib.vira")); string(got) != "1.0.0" {
+		t.Errorf("installed math holds %q, want the original 1.0.0", got)
+	}
+}
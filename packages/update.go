@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// updateJournal records which packages a running update has finished, so
+// a rerun after a failure can skip them.
+type updateJournal struct {
+	Done []string `json:"done"`
+}
+
+func journalPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".vira", "cache", "update.journal")
+}
+
+func readJournal() (*updateJournal, error) {
+	var j updateJournal
+	data, err := os.ReadFile(journalPath())
+	if os.IsNotExist(err) {
+		return &j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &j); err != nil {
+		// A damaged journal only costs redoing work.
+		return &updateJournal{}, nil
+	}
+	return &j, nil
+}
+
+func (j *updateJournal) save() error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(journalPath()), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(journalPath(), data, 0644)
+}
+
+// update reinstalls every globally installed package at its latest
+// version, or the version its channel points at now for packages installed
+// as name@channel. Packages pinned as name@version or overridden are left
+// alone.
+// Unless noResume is set, packages finished by an interrupted earlier run
+// are skipped; the journal is removed once everything has been updated.
+func update(ctx context.Context, noResume bool) (err error) {
+	defer func() { recordAudit("update", "", PlatformEntry{}, err) }()
+
+	libs := os.Getenv("HOME") + "/.vira/libs"
+	installed, err := listInstalled(libs)
+	if err != nil {
+		return err
+	}
+	journal := &updateJournal{}
+	if noResume {
+		os.Remove(journalPath())
+	} else if journal, err = readJournal(); err != nil {
+		return err
+	}
+	if len(journal.Done) > 0 {
+		fmt.Printf("Resuming previous update, %d packages already done (use --no-resume to start over)\n", len(journal.Done))
+	}
+
+	fmt.Println("Updating all packages...")
+	var todo []string
+	for _, name := range installed {
+		if target, ok := overrideFor(name); ok {
+			fmt.Printf("Skipped %s (overridden by %s)\n", name, target)
+			continue
+		}
+		if (!strings.Contains(name, "@") || followsChannel(libs, name) != "") && !slices.Contains(journal.Done, name) {
+			todo = append(todo, name)
+		}
+	}
+	for i, name := range todo {
+		if err := updatePackage(ctx, libs, name); err != nil {
+			return fmt.Errorf("update of %s failed after %d of %d packages, rerun update to resume: %v", name, i, len(todo), err)
+		}
+		journal.Done = append(journal.Done, name)
+		if err := journal.save(); err != nil {
+			return err
+		}
+		fmt.Println("Updated", name)
+	}
+	os.Remove(journalPath())
+	return nil
+}
+
+// followsChannel returns the channel the installed package full was
+// installed from, or "".
+func followsChannel(libs string, full string) string {
+	meta, err := readInstalledMeta(filepath.Join(libs, full))
+	if err != nil {
+		return ""
+	}
+	return meta.Channel
+}
+
+// updatePackage reinstalls one package. A channel-tracked name@version is
+// re-resolved and replaced when its channel moved on.
+func updatePackage(ctx context.Context, libs string, full string) error {
+	channel := followsChannel(libs, full)
+	if channel == "" {
+		return install(ctx, full, InstallOptions{MaxDepth: configuredMaxDepth()})
+	}
+	name, _ := splitSpec(full)
+	next, _, err := channelSpec(name + "@" + channel)
+	if err != nil {
+		return err
+	}
+	if next == full {
+		return nil
+	}
+	if err := install(ctx, name+"@"+channel, InstallOptions{MaxDepth: configuredMaxDepth()}); err != nil {
+		return err
+	}
+	_, err = remove(full, true, false)
+	return err
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// updateFixture installs http, json and math at 1.0.0 globally, then
+// publishes 2.0.0 of each, so an update has three packages to do.
+func updateFixture(t *testing.T) *testRegistry {
+	t.Helper()
+	home := testHome(t)
+	noProgress = true
+	t.Cleanup(func() { noProgress = false })
+	names := []string{"http", "json", "math"}
+	publish := func(version string) map[string][]byte {
+		index := Index{Packages: map[string]IndexPackage{}}
+		files := map[string][]byte{}
+		for _, name := range names {
+			index.Packages[name] = IndexPackage{Latest: version, Versions: map[string]IndexVersion{version: {}}}
+			files[name+".tar.gz"] = gzipBytes(t, makeTar(t, []tarEntry{{name: name + "/lib.vira", body: version}}))
+		}
+		writeCachedIndex(t, home, index)
+		return files
+	}
+	reg := newTestRegistry(t, publish("1.0.0"))
+	for _, name := range names {
+		if _, err := captureStdout(t, func() error { return install(t.Context(), name, InstallOptions{MaxDepth: 8}) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := publish("2.0.0")
+	reg.mu.Lock()
+	reg.files = files
+	reg.requests = map[string]int{}
+	reg.mu.Unlock()
+	return reg
+}
+
+func TestUpdateResumesAfterFailure(t *testing.T) {
+	reg := updateFixture(t)
+	reg.mu.Lock()
+	reg.fail["json.tar.gz"] = true
+	reg.mu.Unlock()
+	_, err := captureStdout(t, func() error { return update(t.Context(), false) })
+	if err == nil || !strings.Contains(err.Error(), "update of json failed after 1 of 3 packages, rerun update to resume") {
+		t.Fatalf("first run: %v, want json to fail after http", err)
+	}
+	if journal, err := readJournal(); err != nil || !slices.Equal(journal.Done, []string{"http"}) {
+		t.Fatalf("journal %v, %v, want http done", journal, err)
+	}
+
+	reg.mu.Lock()
+	reg.fail = map[string]bool{}
+	reg.mu.Unlock()
+	out, err := captureStdout(t, func() error { return update(t.Context(), false) })
+	if err != nil {
+		t.Fatalf("resumed run: %v", err)
+	}
+	if !strings.Contains(out, "Resuming previous update, 1 packages already done") {
+		t.Errorf("resumed run printed %q, want the resume notice", out)
+	}
+	for name, want := range map[string]int{"http.tar.gz": 1, "json.tar.gz": 2, "math.tar.gz": 1} {
+		if got := reg.count(name); got != want {
+			t.Errorf("%s requested %d times, want %d", name, got, want)
+		}
+	}
+	for _, name := range []string{"http", "json", "math"} {
+		if got, _ := os.ReadFile(filepath.Join(os.Getenv("HOME"), ".vira", "libs", name, "lib.vira")); string(got) != "2.0.0" {
+			t.Errorf("%s holds %q after the update, want 2.0.0", name, got)
+		}
+	}
+	if _, err := os.Stat(journalPath()); !os.IsNotExist(err) {
+		t.Errorf("journal kept after a full update: %v", err)
+	}
+}
+
+func TestUpdateNoResumeStartsOver(t *testing.T) {
+	reg := updateFixture(t)
+	// A journal left by an earlier run that never finished.
+	if err := (&updateJournal{Done: []string{"http", "math"}}).save(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := captureStdout(t, func() error { return update(t.Context(), true) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "Resuming") {
+		t.Errorf("--no-resume run printed %q", out)
+	}
+	for _, name := range []string{"http.tar.gz", "json.tar.gz", "math.tar.gz"} {
+		if got := reg.count(name); got != 1 {
+			t.Errorf("%s requested %d times, want 1", name, got)
+		}
+	}
+	if _, err := os.Stat(journalPath()); !os.IsNotExist(err) {
+		t.Errorf("journal kept after a full update: %v", err)
+	}
+}
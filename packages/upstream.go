@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Statuses reported by verify. Yanked and divergent packages make verify
+// fail; the others are informational.
+const (
+	statusOK        = "ok"
+	statusDivergent = "divergent"  // checksum differs from the registry or install record
+	statusYanked    = "yanked"     // the installed version was withdrawn
+	statusGone      = "missing"    // the package or version is no longer published
+	statusLocal     = "local"      // installed from an override or another source
+	statusUnknown   = "unverified" // nothing to compare against
+)
+
+var statusOrder = []string{statusDivergent, statusYanked, statusGone, statusLocal, statusUnknown, statusOK}
+
+// VerifyResult is the verify outcome for one installed package.
+type VerifyResult struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Status  string `json:"status"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// verifyInstalled checks every package installed in dir. Locally each
+// archive is compared with the checksum recorded at install time; with
+// registry set, the installed version is compared with what the registry
+// currently publishes for it.
+func verifyInstalled(dir string, registry bool) ([]VerifyResult, error) {
+	installed, err := listInstalled(dir)
+	if err != nil {
+		return nil, err
+	}
+	var index *Index
+	if registry {
+		if index, err = loadIndex(); err != nil {
+			return nil, err
+		}
+	}
+	var results []VerifyResult
+	for _, full := range slices.Sorted(slices.Values(installed)) {
+		results = append(results, verifyPackage(dir, full, index))
+	}
+	return results, nil
+}
+
+func verifyPackage(dir string, full string, index *Index) VerifyResult {
+	name, pinned := splitSpec(full)
+	r := VerifyResult{Name: name, Version: pinned}
+	meta, err := readInstalledMeta(filepath.Join(dir, full))
+	if err != nil {
+		meta = &InstalledMeta{}
+	}
+	if r.Version == "" {
+		r.Version = meta.Version
+	}
+	archives, _ := filepath.Glob(filepath.Join(dir, full+".tar.*"))
+
+	if target, ok := overrideFor(name); ok {
+		r.Status, r.Detail = statusLocal, "override "+target
+		return r
+	}
+	if index == nil {
+		switch {
+		case meta.Integrity == "" || len(archives) != 1:
+			r.Status, r.Detail = statusUnknown, "no install record"
+		case verifyChecksum(archives[0], meta.Integrity) != nil:
+			r.Status, r.Detail = statusDivergent, "archive changed since install"
+		default:
+			r.Status = statusOK
+		}
+		return r
+	}
+
+	if meta.URL != "" && !strings.HasPrefix(meta.URL, registryURL()) {
+		if v, ok := indexVersion(full); !ok || v.URL != meta.URL {
+			r.Status, r.Detail = statusLocal, "installed from "+meta.URL
+			return r
+		}
+	}
+	pkg, ok := index.lookup(name)
+	if !ok {
+		r.Status, r.Detail = statusGone, "not in the registry"
+		return r
+	}
+	if r.Version == "" {
+		r.Status, r.Detail = statusUnknown, "installed version unknown"
+		return r
+	}
+	published, ok := pkg.Versions[r.Version]
+	switch {
+	case !ok:
+		r.Status, r.Detail = statusGone, "version no longer published"
+	case published.Yanked:
+		r.Status = statusYanked
+	case published.Integrity == "":
+		r.Status, r.Detail = statusUnknown, "registry publishes no checksum"
+	case sameIntegrity(meta.Integrity, published.Integrity):
+		r.Status = statusOK
+	case len(archives) == 1 && verifyChecksum(archives[0], published.Integrity) == nil:
+		r.Status = statusOK
+	default:
+		r.Status, r.Detail = statusDivergent, "registry publishes "+published.Integrity
+	}
+	return r
+}
+
+// printVerify writes the results grouped by status and reports whether
+// anything was yanked or divergent.
+func printVerify(results []VerifyResult, asJSON bool) (bool, error) {
+	failed := false
+	for _, r := range results {
+		failed = failed || r.Status == statusDivergent || r.Status == statusYanked
+	}
+	if asJSON {
+		data, err := json.MarshalIndent(map[string]any{"packages": results, "ok": !failed, "warnings": collectedWarnings()}, "", "  ")
+		if err != nil {
+			return failed, err
+		}
+		fmt.Println(string(data))
+		return failed, nil
+	}
+	if len(results) == 0 {
+		fmt.Println("No packages installed")
+	}
+	for _, status := range statusOrder {
+		var group []VerifyResult
+		for _, r := range results {
+			if r.Status == status {
+				group = append(group, r)
+			}
+		}
+		if len(group) == 0 {
+			continue
+		}
+		fmt.Printf("%s (%d):\n", status, len(group))
+		for _, r := range group {
+			line := "  " + r.Name
+			if r.Version != "" {
+				line += "@" + r.Version
+			}
+			if r.Detail != "" {
+				line += ": " + r.Detail
+			}
+			fmt.Println(line)
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// vendorDir holds vendored dependencies inside the project: the verified
+// archives and an index.json for them, laid out like a --from-dir bundle.
+var vendorDir = filepath.Join("vendor", "vira")
+
+// useVendor points this run at the vendored dependencies when bytes.yml
+// has "vendored: true" or force is set.
+func useVendor(force bool) error {
+	if !force {
+		m, err := loadManifest(manifestFile)
+		if err != nil || !m.Vendored {
+			return nil
+		}
+	}
+	if err := useLocalRegistry(vendorDir); err != nil {
+		return fmt.Errorf("cannot install from vendored dependencies: %v (run install --save-bundle)", err)
+	}
+	return nil
+}
+
+// saveBundle copies the archives of every locked package from destDir
+// into vendorDir after checking them against the lockfile, writes an index
+// for them and marks the manifest as vendored.
+func saveBundle(destDir string, lock *Lock) error {
+	if err := os.MkdirAll(vendorDir, 0755); err != nil {
+		return err
+	}
+	index, err := loadIndex()
+	if err != nil {
+		index = &Index{Packages: map[string]IndexPackage{}}
+	}
+	bundle := Index{Packages: map[string]IndexPackage{}}
+	keep := map[string]bool{}
+	for name, entry := range lock.Packages {
+		locked, ok := entry.resolved(currentPlatform())
+		if !ok {
+			return fmt.Errorf("%s has no %s entry for %s", name, lockFile, currentPlatform())
+		}
+		archives, _ := filepath.Glob(filepath.Join(destDir, name+".tar.*"))
+		if len(archives) != 1 {
+			return fmt.Errorf("no archive for %s in %s", name, destDir)
+		}
+		if locked.Integrity != "" {
+			if err := verifyChecksum(archives[0], locked.Integrity); err != nil {
+				return &IntegrityError{Mismatches: []string{name + ": " + err.Error()}}
+			}
+		}
+		base := filepath.Base(archives[0])
+		if err := copyFile(archives[0], filepath.Join(vendorDir, base)); err != nil {
+			return err
+		}
+		keep[base] = true
+		// Pinned packages are locked as name@version.
+		n, _ := splitSpec(name)
+		if pkg, ok := index.lookup(n); ok {
+			bundle.Packages[n] = bundleEntry(pkg)
+		}
+	}
+	stale, _ := filepath.Glob(filepath.Join(vendorDir, "*.tar.*"))
+	for _, path := range stale {
+		if !keep[filepath.Base(path)] {
+			os.Remove(path)
+		}
+	}
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(vendorDir, "index.json"), data, 0644); err != nil {
+		return err
+	}
+	manifest, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return err
+	}
+	lines := setManifestKey(strings.Split(strings.TrimSuffix(string(manifest), "\n"), "\n"), "vendored", "true")
+	if err := writeFileAtomic(manifestFile, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	notify("", "Vendored %d packages into %s", len(keep), vendorDir)
+	return nil
+}
+
+// bundleEntry is an index entry for a bundle, whose archives are served
+// from the bundle directory rather than the recorded URLs.
+func bundleEntry(pkg IndexPackage) IndexPackage {
+	versions := map[string]IndexVersion{}
+	for v, meta := range pkg.Versions {
+		meta.URL = ""
+		versions[v] = meta
+	}
+	pkg.Versions = versions
+	return pkg
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
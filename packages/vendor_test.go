@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestVendorThenOfflineInstall(t *testing.T) {
+	reg, _ := fetchFixture(t)
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	quietWarnings(t)
+	manifest := "name: app\nversion: 0.1.0\ndependencies:\n  math: 1.0.0\n"
+	if err := os.WriteFile(manifestFile, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := captureStdout(t, func() error {
+		return installEnvironment(t.Context(), "", InstallOptions{InProject: true, MaxDepth: defaultMaxDepth, SaveBundle: true})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	vendored, _ := filepath.Glob(filepath.Join(vendorDir, "*.tar.*"))
+	for i, path := range vendored {
+		vendored[i] = filepath.Base(path)
+	}
+	if want := []string{"io.tar.gz", "math@1.0.0.tar.gz"}; !slices.Equal(vendored, want) {
+		t.Errorf("vendored %v, want %v", vendored, want)
+	}
+	if names := slices.Sorted(maps.Keys(readBundleIndex(t, vendorDir).Packages)); !slices.Equal(names, []string{"io", "math"}) {
+		t.Errorf("vendored index lists %v, want io and math", names)
+	}
+	if m, err := loadManifest(manifestFile); err != nil || !m.Vendored {
+		t.Fatalf("manifest not marked vendored: %v", err)
+	}
+
+	// A fresh checkout on a machine without a cached index installs from
+	// vendor/vira alone.
+	os.RemoveAll("build")
+	testHome(t)
+	c, err := newHTTPClient(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	useClient(t, c)
+	registryOverride = ""
+	before := reg.count("math@1.0.0.tar.gz") + reg.count("io.tar.gz")
+	offlineInstall := func() error {
+		if err := useVendor(false); err != nil {
+			return err
+		}
+		defer func() { localRegistry, registryOverride = "", "" }()
+		_, err := captureStdout(t, func() error {
+			return installEnvironment(t.Context(), "", InstallOptions{InProject: true, MaxDepth: defaultMaxDepth})
+		})
+		return err
+	}
+	if err := offlineInstall(); err != nil {
+		t.Fatal(err)
+	}
+	if after := reg.count("math@1.0.0.tar.gz") + reg.count("io.tar.gz"); after != before {
+		t.Errorf("offline install made %d registry requests", after-before)
+	}
+	for path, want := range map[string]string{"math@1.0.0/lib.vira": "1.0.0", "io/io.vira": "io"} {
+		if got, _ := os.ReadFile(filepath.Join("build", "dependencies", path)); string(got) != want {
+			t.Errorf("%s holds %q, want %q", path, got, want)
+		}
+	}
+
+	// Vendored archives are checked against the lockfile.
+	os.RemoveAll("build")
+	tampered := gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "tampered"}}))
+	os.WriteFile(filepath.Join(vendorDir, "math@1.0.0.tar.gz"), tampered, 0644)
+	var integrityErr *IntegrityError
+	if err := offlineInstall(); !errors.As(err, &integrityErr) || !strings.Contains(err.Error(), "math") {
+		t.Fatalf("install from a tampered vendor dir gave %v, want an integrity error for math", err)
+	}
+}
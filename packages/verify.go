@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// exitIntegrity is the exit code for checksum failures, so scripts can
+// tell tampered or corrupt downloads apart from other errors.
+const exitIntegrity = 3
+
+// IntegrityError lists every package whose download failed verification.
+type IntegrityError struct {
+	Mismatches []string
+}
+
+func (e *IntegrityError) Error() string {
+	return "integrity check failed:\n  " + strings.Join(e.Mismatches, "\n  ")
+}
+
+// checksumAlgo is the digest recorded for new downloads, set by
+// --checksum-algo. allowWeakChecksums, set by --allow-weak-checksums,
+// accepts md5 and sha1 integrity strings, which are refused by default.
+var (
+	checksumAlgo       = "sha256"
+	allowWeakChecksums bool
+)
+
+var weakChecksums = map[string]bool{"md5": true, "sha1": true}
+
+// newDigest returns a hash for an integrity algorithm name as used in the
+// "<algo>-<digest>" prefix.
+func newDigest(algo string) (hash.Hash, error) {
+	if weakChecksums[algo] && !allowWeakChecksums {
+		return nil, fmt.Errorf("%s checksums are too weak (use --allow-weak-checksums to accept them)", algo)
+	}
+	switch algo {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha384":
+		return sha512.New384(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "md5":
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unknown checksum algorithm %q", algo)
+}
+
+// formatIntegrity renders the digest of h as an SRI integrity string,
+// base64 after the algorithm.
+func formatIntegrity(algo string, h hash.Hash) string {
+	return algo + "-" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// parseIntegrity splits an "<algo>-<digest>" integrity string into its
+// algorithm and raw digest. The digest may be base64, as in SRI, or hex,
+// as older lockfiles and registries write it. blake3 is refused here, as
+// there is no implementation of it to check against.
+func parseIntegrity(integrity string) (string, []byte, error) {
+	algo, digest, ok := strings.Cut(integrity, "-")
+	if !ok {
+		return "", nil, fmt.Errorf("malformed integrity %q", integrity)
+	}
+	if algo == "blake3" {
+		return "", nil, fmt.Errorf("blake3 integrity is not supported, use sha256, sha384 or sha512")
+	}
+	h, err := newDigest(algo)
+	if err != nil {
+		return "", nil, err
+	}
+	if raw, err := hex.DecodeString(digest); err == nil && len(raw) == h.Size() {
+		return algo, raw, nil
+	}
+	if raw, err := base64.StdEncoding.DecodeString(digest); err == nil && len(raw) == h.Size() {
+		return algo, raw, nil
+	}
+	return "", nil, fmt.Errorf("malformed integrity %q: not a %s digest", integrity, algo)
+}
+
+// sameIntegrity reports whether a and b name the same digest, however
+// each encodes it.
+func sameIntegrity(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	algoA, rawA, errA := parseIntegrity(a)
+	algoB, rawB, errB := parseIntegrity(b)
+	return errA == nil && errB == nil && algoA == algoB && bytes.Equal(rawA, rawB)
+}
+
+// verifyChecksum hashes the file at path with the algorithm named in
+// integrity and compares the digest.
+func verifyChecksum(path string, integrity string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return verifyReader(file, integrity)
+}
+
+// verifyReader checks what r yields against integrity, whose digest is
+// given in hex or, as in SRI, base64.
+func verifyReader(r io.Reader, integrity string) error {
+	algo, want, err := parseIntegrity(integrity)
+	if err != nil {
+		return err
+	}
+	h, err := newDigest(algo)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if !bytes.Equal(h.Sum(nil), want) {
+		return fmt.Errorf("expected %s, got %s", integrity, formatIntegrity(algo, h))
+	}
+	return nil
+}
+
+// runPool calls fn for 0..n-1 on at most jobs goroutines and returns the
+// errors by index.
+func runPool(n int, jobs int, fn func(i int) error) []error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	errs := make([]error, n)
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return errs
+}
+
+// Download is a fetched archive awaiting verification.
+type Download struct {
+	Name     string
+	Path     string
+	Expected PlatformEntry
+}
+
+// verifyDownloads checks all downloads concurrently. Files that fail are
+// deleted and reported together in an *IntegrityError; one bad package
+// does not stop the rest from being checked.
+func verifyDownloads(downloads []Download, jobs int) error {
+	defer stopwatch.phase("verify")()
+	errs := runPool(len(downloads), jobs, func(i int) error {
+		d := downloads[i]
+		expected := expectedIntegrity(d.Name, d.Expected.Integrity)
+		if expected == "" {
+			return nil
+		}
+		return verifyChecksum(d.Path, expected)
+	})
+	var mismatches []string
+	for i, err := range errs {
+		if err != nil {
+			os.Remove(downloads[i].Path)
+			mismatches = append(mismatches, integrityMismatch(downloads[i].Name, err))
+		}
+	}
+	if len(mismatches) > 0 {
+		return &IntegrityError{Mismatches: mismatches}
+	}
+	return nil
+}
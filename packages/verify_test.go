@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyReader(t *testing.T) {
+	data := "package bytes"
+	sum256 := sha256.Sum256([]byte(data))
+	sum384 := sha512.Sum384([]byte(data))
+	sum512 := sha512.Sum512([]byte(data))
+	sumMD5 := md5.Sum([]byte(data))
+	tests := []struct {
+		name      string
+		integrity string
+		weak      bool
+		wantErr   string
+	}{
+		{"hex sha256", "sha256-" + hex.EncodeToString(sum256[:]), false, ""},
+		{"base64 sha256", "sha256-" + base64.StdEncoding.EncodeToString(sum256[:]), false, ""},
+		{"hex sha384", "sha384-" + hex.EncodeToString(sum384[:]), false, ""},
+		{"base64 sha384", "sha384-" + base64.StdEncoding.EncodeToString(sum384[:]), false, ""},
+		{"hex sha512", "sha512-" + hex.EncodeToString(sum512[:]), false, ""},
+		{"base64 sha512", "sha512-" + base64.StdEncoding.EncodeToString(sum512[:]), false, ""},
+		{"wrong sha256", "sha256-" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size)), false, "expected sha256-"},
+		{"wrong sha384", "sha384-" + base64.StdEncoding.EncodeToString(make([]byte, sha512.Size384)), false, "expected sha384-"},
+		{"wrong sha512", "sha512-" + base64.StdEncoding.EncodeToString(make([]byte, sha512.Size)), false, "expected sha512-"},
+		{"sha256 digest labelled sha512", "sha512-" + base64.StdEncoding.EncodeToString(sum256[:]), false, "not a sha512 digest"},
+		{"no algorithm", hex.EncodeToString(sum256[:]), false, "malformed integrity"},
+		{"blake3", "blake3-" + base64.StdEncoding.EncodeToString(sum256[:]), false, "blake3 integrity is not supported"},
+		{"unknown algorithm", "crc32-abcd", false, "unknown checksum algorithm"},
+		{"weak refused", "md5-" + hex.EncodeToString(sumMD5[:]), false, "too weak"},
+		{"weak allowed", "md5-" + hex.EncodeToString(sumMD5[:]), true, ""},
+		{"wrong md5 allowed", "md5-" + strings.Repeat("0", 32), true, "expected md5-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowWeakChecksums = tt.weak
+			defer func() { allowWeakChecksums = false }()
+			err := verifyReader(strings.NewReader(data), tt.integrity)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("verifyReader(%q) = %v", tt.integrity, err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("verifyReader(%q) = %v, want an error containing %q", tt.integrity, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormatIntegrity(t *testing.T) {
+	data := []byte("package bytes")
+	for _, algo := range []string{"sha256", "sha384", "sha512"} {
+		h, err := newDigest(algo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Write(data)
+		got := formatIntegrity(algo, h)
+		want := algo + "-" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+		if got != want {
+			t.Errorf("formatIntegrity(%s) = %s, want SRI base64 %s", algo, got, want)
+		}
+		if err := verifyReader(bytes.NewReader(data), got); err != nil {
+			t.Errorf("%s does not verify its own data: %v", got, err)
+		}
+	}
+}
+
+func TestSameIntegrity(t *testing.T) {
+	sum := sha256.Sum256([]byte("package bytes"))
+	hexSum := "sha256-" + hex.EncodeToString(sum[:])
+	b64Sum := "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{hexSum, hexSum, true},
+		{hexSum, b64Sum, true},
+		{b64Sum, "sha256-" + strings.Repeat("0", 64), false},
+		{b64Sum, "sha512-" + base64.StdEncoding.EncodeToString(sum[:]), false},
+		{b64Sum, "", false},
+	}
+	for _, tt := range tests {
+		if got := sameIntegrity(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameIntegrity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCIFailsBatchWithOneBadChecksum(t *testing.T) {
+	testHome(t)
+	noProgress = true
+	defer func() { noProgress = false }()
+	files := map[string][]byte{}
+	lock := &Lock{Packages: map[string]*LockEntry{}}
+	reg := newTestRegistry(t, files)
+	for _, name := range []string{"http", "json", "math"} {
+		archive := gzipBytes(t, makeTar(t, []tarEntry{{name: name + "/lib.vira", body: name}}))
+		files[name+".tar.gz"] = archive
+		sum := sha256.Sum256(archive)
+		lock.Packages[name] = &LockEntry{Version: "1.0.0", URL: registryOverride + name + ".tar.gz", Integrity: "sha256-" + base64.StdEncoding.EncodeToString(sum[:])}
+	}
+	lock.Packages["json"].Integrity = "sha256-" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := writeLock(lockFile, lock); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := captureStdout(t, func() error { return ci(t.Context(), 4) })
+	var integrityErr *IntegrityError
+	if !errors.As(err, &integrityErr) {
+		t.Fatalf("ci = %v, want an integrity error", err)
+	}
+	if len(integrityErr.Mismatches) != 1 || !strings.Contains(integrityErr.Mismatches[0], "json") {
+		t.Errorf("mismatches %q, want json only", integrityErr.Mismatches)
+	}
+	// Every archive was fetched and checked, but none was installed.
+	for _, name := range []string{"http", "json", "math"} {
+		if n := reg.count(name + ".tar.gz"); n != 1 {
+			t.Errorf("%s fetched %d times, want 1", name, n)
+		}
+	}
+	destDir := filepath.Join("build", "dependencies")
+	if extracted, _ := filepath.Glob(filepath.Join(destDir, "*", "lib.vira")); len(extracted) != 0 {
+		t.Errorf("installed %v from a batch that failed verification", extracted)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "json.tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("archive with a bad checksum was kept: %v", err)
+	}
+	for _, name := range []string{"http", "math"} {
+		if _, err := os.Stat(filepath.Join(destDir, name+".tar.gz")); err != nil {
+			t.Errorf("verified archive %s was removed: %v", name, err)
+		}
+	}
+}
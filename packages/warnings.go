@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Warning is something an operation noticed but carried on past. Code is
+// stable so tools reading --json results can match on it; Message is for
+// people and may change.
+type Warning struct {
+	Code    string `json:"code"`
+	Package string `json:"package,omitempty"`
+	Message string `json:"message"`
+}
+
+// Warning codes.
+const (
+	codeDeprecatedVersion = "deprecated_version" // the installed version is marked deprecated in the index
+	codeDeprecatedPackage = "deprecated_package" // the package is replaced by another one
+	codeStaleIndex        = "stale_index"        // the cached index is older than index-ttl
+	codeClockSkew         = "clock_skew"         // the cached index was refreshed in the future
+	codeIndexChanges      = "index_changes"      // incremental index changes were unusable
+	codeShardUnavailable  = "shard_unavailable"  // an index shard could not be fetched
+	codeUnsignedIndex     = "unsigned_index"     // VIRA_INDEX_KEY is set but the registry serves no signature
+	codeSkippedScript     = "skipped_script"     // a lifecycle script was not run
+	codeSkippedEntry      = "skipped_entry"      // an archive link or special file was not extracted
+	codeNoSandbox         = "no_sandbox"         // a lifecycle script ran without a sandbox tool
+	codeEngineMismatch    = "engine_mismatch"    // a package requires another Vira version
+	codeOptionalSkipped   = "optional_skipped"   // an optional dependency was left out
+	codeMissingPeer       = "missing_peer"       // a peer dependency is not installed
+	codePeerMismatch      = "peer_mismatch"      // an installed peer dependency is outside the range asked for
+	codeLockPlatform      = "lock_platform"      // the lockfile has no entry for this platform
+	codeLockEnvironment   = "lock_environment"   // the lockfile was resolved for another environment
+	codeLockOptional      = "lock_optional"      // the lockfile was resolved with another --no-optional setting
+	codeLockRecovery      = "lock_recovery"      // recover could not lock a package as installed
+	codeManifestDrift     = "manifest_drift"     // installed packages and the manifest disagree
+	codeAuditLog          = "audit_log"          // the audit log could not be written
+)
+
+var (
+	warningsMu sync.Mutex
+	warnings   []Warning
+	// warningsQuiet is set by commands printing a --json result, which
+	// carries the warnings instead of stderr.
+	warningsQuiet bool
+)
+
+// warn records a warning for the current operation and, unless it goes
+// into a --json result or the --events stream, prints it to stderr.
+func warn(code string, pkgName string, format string, args ...any) {
+	w := Warning{Code: code, Package: pkgName, Message: fmt.Sprintf(format, args...)}
+	warningsMu.Lock()
+	warnings = append(warnings, w)
+	warningsMu.Unlock()
+	switch {
+	case eventsEnabled():
+		emit(Event{Type: "warning", Package: w.Package, Code: w.Code, Message: w.Message})
+	case !warningsQuiet:
+		fmt.Fprintln(os.Stderr, "warning:", w.Message)
+	}
+}
+
+// warnDeprecated warns when the index marks name@version deprecated.
+func warnDeprecated(name string, version string, meta IndexVersion) {
+	if meta.Deprecated != "" {
+		warn(codeDeprecatedVersion, name, "%s@%s is deprecated: %s", name, version, meta.Deprecated)
+	}
+}
+
+// collectedWarnings returns the warnings recorded so far, never nil so
+// JSON results always carry an array.
+func collectedWarnings() []Warning {
+	warningsMu.Lock()
+	defer warningsMu.Unlock()
+	return append([]Warning{}, warnings...)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestJSONOutputsCarryWarnings(t *testing.T) {
+	home := testHome(t)
+	warningsQuiet = true
+	defer func() { warningsQuiet = false }()
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {}}},
+	}})
+	warn(codeStaleIndex, "", "the package index is stale")
+
+	outputs := []struct {
+		name  string
+		print func() error
+	}{
+		{"search", func() error { return search("math", SearchOptions{JSON: true}) }},
+		{"search without results", func() error { return search("nothing", SearchOptions{JSON: true}) }},
+		{"search --exact", func() error { return search("math", SearchOptions{Exact: true, JSON: true}) }},
+		{"verify", func() error {
+			_, err := printVerify([]VerifyResult{}, true)
+			return err
+		}},
+		{"diff", func() error { return printLockDiff(LockDiff{}, true) }},
+		{"frozen drift", func() error { return printDrift(nil, true) }},
+		{"dry run", func() error { return printPlan(&Plan{}, true) }},
+		{"deps", func() error { return printDependencyList(newDependencyList("math", "1.0.0", "index"), true) }},
+	}
+	for _, tt := range outputs {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := captureStdout(t, tt.print)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result struct {
+				Warnings []Warning `json:"warnings"`
+			}
+			if err := json.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("printed %q: %v", out, err)
+			}
+			if len(result.Warnings) == 0 || result.Warnings[len(result.Warnings)-1].Code != codeStaleIndex {
+				t.Errorf("warnings %v, want the %s warning", result.Warnings, codeStaleIndex)
+			}
+		})
+	}
+}
+
+func TestDeprecatedInstallWarnsInJSON(t *testing.T) {
+	home := testHome(t)
+	noProgress = true
+	defer func() { noProgress = false }()
+	quietWarnings(t)
+	writeCachedIndex(t, home, Index{Packages: map[string]IndexPackage{
+		"math": {Latest: "1.0.0", Versions: map[string]IndexVersion{"1.0.0": {Deprecated: "use math 2"}}},
+	}})
+	newTestRegistry(t, map[string][]byte{
+		"math.tar.gz": gzipBytes(t, makeTar(t, []tarEntry{{name: "math/lib.vira", body: "1.0.0"}})),
+	})
+	prefix := t.TempDir()
+	if _, err := captureStdout(t, func() error {
+		return install(t.Context(), "math", InstallOptions{Prefix: prefix, MaxDepth: 8, NoScripts: true})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	libs, err := globalLibsDir(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputs := []struct {
+		name  string
+		print func() error
+	}{
+		{"search", func() error { return search("math", SearchOptions{JSON: true}) }},
+		{"verify", func() error {
+			results, err := verifyInstalled(libs, false)
+			if err != nil {
+				return err
+			}
+			_, err = printVerify(results, true)
+			return err
+		}},
+		{"diff", func() error {
+			current := &Lock{Packages: map[string]*LockEntry{"math": {Version: "1.0.0", URL: "math.tar.gz"}}}
+			return printLockDiff(diffLocks(&Lock{}, current), true)
+		}},
+	}
+	for _, tt := range outputs {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := captureStdout(t, tt.print)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result struct {
+				Warnings []Warning `json:"warnings"`
+			}
+			if err := json.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("printed %q: %v", out, err)
+			}
+			want := Warning{Code: codeDeprecatedVersion, Package: "math", Message: "math@1.0.0 is deprecated: use math 2"}
+			if !slices.Contains(result.Warnings, want) {
+				t.Errorf("warnings %+v, want %+v", result.Warnings, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,984 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"slices"
+)
+
+// A zstd decoder (RFC 8878) for .tar.zst archives. It covers what a
+// package archive needs: any number of frames, skippable frames and
+// content checksums. Dictionaries are not supported, and frames asking
+// for a window past zstdMaxWindow are refused rather than buffered.
+
+const (
+	zstdMagic         = 0xFD2FB528
+	zstdMaxWindow     = 1 << 27
+	zstdMaxBlockSize  = 128 << 10
+	zstdMaxHuffmanLog = 11
+)
+
+var errZstdCorrupt = errors.New("zstd: corrupt input")
+
+// zstdReader decompresses a zstd stream one block at a time.
+type zstdReader struct {
+	r      io.Reader
+	frame  *zstdFrame // nil between frames
+	frames int
+	out    []byte // decoded bytes not yet returned by Read
+	err    error
+	block  []byte
+}
+
+func newZstdReader(r io.Reader) *zstdReader {
+	return &zstdReader{r: r}
+}
+
+func (z *zstdReader) Read(p []byte) (int, error) {
+	for len(z.out) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.next()
+	}
+	n := copy(p, z.out)
+	z.out = z.out[n:]
+	return n, nil
+}
+
+// next decodes the next block, starting a frame first if needed. It
+// returns io.EOF once the input ends cleanly after a frame.
+func (z *zstdReader) next() error {
+	if z.frame == nil {
+		return z.readFrameHeader()
+	}
+	f := z.frame
+	var hdr [3]byte
+	if _, err := io.ReadFull(z.r, hdr[:]); err != nil {
+		return unexpected(err)
+	}
+	h := uint32(hdr[0]) | uint32(hdr[1])<<8 | uint32(hdr[2])<<16
+	last := h&1 != 0
+	size := int(h >> 3)
+	if size > f.blockMax {
+		return errZstdCorrupt
+	}
+
+	// Back-references reach at most a window back, so older output can go.
+	if len(f.hist) >= 2*f.window && f.window > 0 {
+		n := copy(f.hist, f.hist[len(f.hist)-f.window:])
+		f.hist = f.hist[:n]
+	}
+	start := len(f.hist)
+	switch (h >> 1) & 3 {
+	case 0: // raw
+		f.hist = append(f.hist, make([]byte, size)...)
+		if _, err := io.ReadFull(z.r, f.hist[start:]); err != nil {
+			return unexpected(err)
+		}
+	case 1: // RLE
+		var b [1]byte
+		if _, err := io.ReadFull(z.r, b[:]); err != nil {
+			return unexpected(err)
+		}
+		f.hist = appendRun(f.hist, b[0], size)
+	case 2: // compressed
+		if cap(z.block) < size {
+			z.block = make([]byte, size)
+		}
+		z.block = z.block[:size]
+		if _, err := io.ReadFull(z.r, z.block); err != nil {
+			return unexpected(err)
+		}
+		if err := f.decodeBlock(z.block); err != nil {
+			return err
+		}
+		if len(f.hist)-start > f.blockMax {
+			return errZstdCorrupt
+		}
+	default:
+		return errZstdCorrupt
+	}
+	z.out = f.hist[start:]
+	f.produced += int64(len(z.out))
+	f.xxh.write(z.out)
+
+	if last {
+		if f.checksum {
+			var sum [4]byte
+			if _, err := io.ReadFull(z.r, sum[:]); err != nil {
+				return unexpected(err)
+			}
+			if binary.LittleEndian.Uint32(sum[:]) != uint32(f.xxh.sum()) {
+				return errors.New("zstd: checksum mismatch")
+			}
+		}
+		if f.contentSize >= 0 && f.produced != f.contentSize {
+			return errZstdCorrupt
+		}
+		z.frame = nil
+		z.frames++
+	}
+	return nil
+}
+
+// appendRun appends n copies of b to dst.
+func appendRun(dst []byte, b byte, n int) []byte {
+	dst = slices.Grow(dst, n)
+	run := dst[len(dst) : len(dst)+n]
+	for i := range run {
+		run[i] = b
+	}
+	return dst[:len(dst)+n]
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (z *zstdReader) readFrameHeader() error {
+	var b [8]byte
+	if _, err := io.ReadFull(z.r, b[:4]); err != nil {
+		if err == io.EOF && z.frames > 0 {
+			return io.EOF
+		}
+		return unexpected(err)
+	}
+	magic := binary.LittleEndian.Uint32(b[:4])
+	if magic&0xFFFFFFF0 == 0x184D2A50 {
+		if _, err := io.ReadFull(z.r, b[:4]); err != nil {
+			return unexpected(err)
+		}
+		if _, err := io.CopyN(io.Discard, z.r, int64(binary.LittleEndian.Uint32(b[:4]))); err != nil {
+			return unexpected(err)
+		}
+		z.frames++
+		return nil
+	}
+	if magic != zstdMagic {
+		return errors.New("zstd: invalid header")
+	}
+	if _, err := io.ReadFull(z.r, b[:1]); err != nil {
+		return unexpected(err)
+	}
+	desc := b[0]
+	if desc&0x08 != 0 {
+		return errZstdCorrupt
+	}
+	single := desc&0x20 != 0
+	window := 0
+	if !single {
+		if _, err := io.ReadFull(z.r, b[:1]); err != nil {
+			return unexpected(err)
+		}
+		base := 1 << (10 + b[0]>>3)
+		window = base + base/8*int(b[0]&7)
+	}
+	if n := [4]int{0, 1, 2, 4}[desc&3]; n > 0 {
+		clear(b[:])
+		if _, err := io.ReadFull(z.r, b[:n]); err != nil {
+			return unexpected(err)
+		}
+		if binary.LittleEndian.Uint32(b[:4]) != 0 {
+			return errors.New("zstd: dictionaries are not supported")
+		}
+	}
+	contentSize := int64(-1)
+	n := [4]int{0, 2, 4, 8}[desc>>6]
+	if n == 0 && single {
+		n = 1
+	}
+	if n > 0 {
+		clear(b[:])
+		if _, err := io.ReadFull(z.r, b[:n]); err != nil {
+			return unexpected(err)
+		}
+		contentSize = int64(binary.LittleEndian.Uint64(b[:]))
+		if n == 2 {
+			contentSize += 256
+		}
+	}
+	if single {
+		if contentSize > zstdMaxWindow {
+			return fmt.Errorf("zstd: window of %d bytes exceeds the limit", contentSize)
+		}
+		window = int(contentSize)
+	}
+	if window > zstdMaxWindow {
+		return fmt.Errorf("zstd: window of %d bytes exceeds the limit", window)
+	}
+	z.frame = &zstdFrame{
+		window:      window,
+		blockMax:    min(window, zstdMaxBlockSize),
+		checksum:    desc&0x04 != 0,
+		contentSize: contentSize,
+		rep:         [3]int{1, 4, 8},
+		xxh:         newXXH64(),
+	}
+	return nil
+}
+
+// zstdFrame is the decoding state carried from one block of a frame to
+// the next.
+type zstdFrame struct {
+	window      int
+	blockMax    int
+	checksum    bool
+	contentSize int64 // -1 when the header omits it
+	produced    int64
+	xxh         xxh64
+
+	hist    []byte // decoded output, the last window of it for matches
+	rep     [3]int
+	huff    *huffTable
+	ll      *fseTable
+	of      *fseTable
+	ml      *fseTable
+	litsBuf []byte
+}
+
+func (f *zstdFrame) decodeBlock(src []byte) error {
+	lits, n, err := f.decodeLiterals(src)
+	if err != nil {
+		return err
+	}
+	return f.decodeSequences(src[n:], lits)
+}
+
+// decodeLiterals decodes the literals section at the start of a
+// compressed block, returning the literals and the section's length.
+func (f *zstdFrame) decodeLiterals(src []byte) ([]byte, int, error) {
+	if len(src) == 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	typ, format := src[0]&3, (src[0]>>2)&3
+	if typ < 2 { // raw or RLE
+		var size, hdr int
+		switch format {
+		case 0, 2:
+			size, hdr = int(src[0]>>3), 1
+		case 1:
+			if len(src) < 2 {
+				return nil, 0, errZstdCorrupt
+			}
+			size, hdr = int(src[0]>>4)|int(src[1])<<4, 2
+		case 3:
+			if len(src) < 3 {
+				return nil, 0, errZstdCorrupt
+			}
+			size, hdr = int(src[0]>>4)|int(src[1])<<4|int(src[2])<<12, 3
+		}
+		if size > f.blockMax {
+			return nil, 0, errZstdCorrupt
+		}
+		if typ == 0 {
+			if len(src) < hdr+size {
+				return nil, 0, errZstdCorrupt
+			}
+			return src[hdr : hdr+size], hdr + size, nil
+		}
+		if len(src) < hdr+1 {
+			return nil, 0, errZstdCorrupt
+		}
+		f.litsBuf = appendRun(f.litsBuf[:0], src[hdr], size)
+		return f.litsBuf, hdr + 1, nil
+	}
+
+	var regen, size, hdr int
+	streams := 4
+	switch format {
+	case 0, 1:
+		if len(src) < 3 {
+			return nil, 0, errZstdCorrupt
+		}
+		h := uint32(src[0]) | uint32(src[1])<<8 | uint32(src[2])<<16
+		regen, size, hdr = int(h>>4)&0x3ff, int(h>>14)&0x3ff, 3
+		if format == 0 {
+			streams = 1
+		}
+	case 2:
+		if len(src) < 4 {
+			return nil, 0, errZstdCorrupt
+		}
+		h := binary.LittleEndian.Uint32(src)
+		regen, size, hdr = int(h>>4)&0x3fff, int(h>>18)&0x3fff, 4
+	case 3:
+		if len(src) < 5 {
+			return nil, 0, errZstdCorrupt
+		}
+		h := uint64(binary.LittleEndian.Uint32(src)) | uint64(src[4])<<32
+		regen, size, hdr = int(h>>4)&0x3ffff, int(h>>22)&0x3ffff, 5
+	}
+	if regen > f.blockMax || len(src) < hdr+size {
+		return nil, 0, errZstdCorrupt
+	}
+	data := src[hdr : hdr+size]
+	if typ == 2 {
+		t, n, err := readHuffmanTable(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		f.huff = t
+		data = data[n:]
+	} else if f.huff == nil {
+		return nil, 0, errZstdCorrupt
+	}
+	lits, err := f.huff.decode(f.litsBuf[:0], data, regen, streams)
+	if err != nil {
+		return nil, 0, err
+	}
+	f.litsBuf = lits
+	return lits, hdr + size, nil
+}
+
+// decodeSequences decodes the sequences section and executes it against
+// the frame's history, consuming lits.
+func (f *zstdFrame) decodeSequences(src []byte, lits []byte) error {
+	if len(src) == 0 {
+		return errZstdCorrupt
+	}
+	count, p := int(src[0]), 1
+	switch {
+	case count == 0:
+		f.hist = append(f.hist, lits...)
+		return nil
+	case count == 255:
+		if len(src) < 3 {
+			return errZstdCorrupt
+		}
+		count, p = int(src[1])+int(src[2])<<8+0x7F00, 3
+	case count >= 128:
+		if len(src) < 2 {
+			return errZstdCorrupt
+		}
+		count, p = (count-128)<<8+int(src[1]), 2
+	}
+	if len(src) < p+1 || src[p]&3 != 0 {
+		return errZstdCorrupt
+	}
+	modes := src[p]
+	p++
+	for _, t := range []struct {
+		cur    **fseTable
+		mode   byte
+		def    *fseTable
+		maxSym int
+		maxLog uint8
+	}{
+		{&f.ll, modes >> 6, zstdLLDefault, 35, 9},
+		{&f.of, (modes >> 4) & 3, zstdOFDefault, 31, 8},
+		{&f.ml, (modes >> 2) & 3, zstdMLDefault, 52, 9},
+	} {
+		n, err := selectTable(t.cur, t.mode, src[p:], t.def, t.maxSym, t.maxLog)
+		if err != nil {
+			return err
+		}
+		p += n
+	}
+
+	br, err := newRevBits(src[p:])
+	if err != nil {
+		return err
+	}
+	ll, of, ml := f.ll, f.of, f.ml
+	llState := br.read(ll.log)
+	ofState := br.read(of.log)
+	mlState := br.read(ml.log)
+	for i := range count {
+		ofCode := of.entries[ofState].sym
+		mlCode := ml.entries[mlState].sym
+		llCode := ll.entries[llState].sym
+		if ofCode > 31 || mlCode > 52 || llCode > 35 {
+			return errZstdCorrupt
+		}
+		offsetValue := 1<<ofCode + int(br.read(ofCode))
+		matchLen := int(zstdMLBase[mlCode]) + int(br.read(zstdMLBits[mlCode]))
+		litLen := int(zstdLLBase[llCode]) + int(br.read(zstdLLBits[llCode]))
+		if i < count-1 {
+			e := ll.entries[llState]
+			llState = uint32(e.base) + br.read(e.bits)
+			e = ml.entries[mlState]
+			mlState = uint32(e.base) + br.read(e.bits)
+			e = of.entries[ofState]
+			ofState = uint32(e.base) + br.read(e.bits)
+		}
+		if br.pos < 0 {
+			return errZstdCorrupt
+		}
+
+		offset := f.repeatOffset(offsetValue, litLen)
+		if litLen > len(lits) {
+			return errZstdCorrupt
+		}
+		f.hist = append(f.hist, lits[:litLen]...)
+		lits = lits[litLen:]
+		if offset <= 0 || offset > len(f.hist) {
+			return errZstdCorrupt
+		}
+		// A match may overlap the bytes it produces; copying what lies
+		// between its start and the end doubles each round and keeps the
+		// period.
+		from := len(f.hist) - offset
+		for matchLen > 0 {
+			n := min(matchLen, len(f.hist)-from)
+			f.hist = append(f.hist, f.hist[from:from+n]...)
+			matchLen -= n
+		}
+	}
+	if br.pos != 0 {
+		return errZstdCorrupt
+	}
+	f.hist = append(f.hist, lits...)
+	return nil
+}
+
+// repeatOffset turns a decoded offset value into a match offset,
+// updating the repeat offsets.
+func (f *zstdFrame) repeatOffset(value, litLen int) int {
+	if value > 3 {
+		f.rep = [3]int{value - 3, f.rep[0], f.rep[1]}
+		return f.rep[0]
+	}
+	if litLen == 0 {
+		value++
+	}
+	switch value {
+	case 1:
+		return f.rep[0]
+	case 2:
+		f.rep[0], f.rep[1] = f.rep[1], f.rep[0]
+	case 3:
+		f.rep = [3]int{f.rep[2], f.rep[0], f.rep[1]}
+	case 4:
+		f.rep = [3]int{f.rep[0] - 1, f.rep[0], f.rep[1]}
+	}
+	return f.rep[0]
+}
+
+// selectTable sets *cur to the table mode describes, reading any
+// description from src, and returns the bytes consumed.
+func selectTable(cur **fseTable, mode byte, src []byte, def *fseTable, maxSym int, maxLog uint8) (int, error) {
+	switch mode {
+	case 0: // predefined
+		*cur = def
+		return 0, nil
+	case 1: // RLE
+		if len(src) == 0 || int(src[0]) > maxSym {
+			return 0, errZstdCorrupt
+		}
+		*cur = &fseTable{entries: []fseEntry{{sym: src[0]}}}
+		return 1, nil
+	case 2: // FSE compressed
+		norm, log, n, err := readFSECounts(src, maxSym, maxLog)
+		if err != nil {
+			return 0, err
+		}
+		t, err := buildFSETable(norm, log)
+		if err != nil {
+			return 0, err
+		}
+		*cur = t
+		return n, nil
+	}
+	// Repeat the previous block's table.
+	if *cur == nil {
+		return 0, errZstdCorrupt
+	}
+	return 0, nil
+}
+
+// revBits reads a bitstream backwards, as zstd writes FSE and Huffman
+// streams: from the highest bit after the end marker down to bit 0.
+// Reading past the start yields zeros and leaves pos negative.
+type revBits struct {
+	data []byte
+	pos  int // bits left to read
+}
+
+func newRevBits(data []byte) (*revBits, error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return nil, errZstdCorrupt
+	}
+	return &revBits{data: data, pos: (len(data)-1)*8 + bits.Len8(data[len(data)-1]) - 1}, nil
+}
+
+func (b *revBits) peek(n uint8) uint32 {
+	if n == 0 || b.pos <= 0 {
+		return 0
+	}
+	lo := b.pos - int(n)
+	if lo < 0 {
+		return uint32(b.bitsAt(0, b.pos)) << uint(-lo)
+	}
+	return uint32(b.bitsAt(lo, int(n)))
+}
+
+func (b *revBits) bitsAt(lo, n int) uint64 {
+	var v uint64
+	for i := (lo + n - 1) >> 3; i >= lo>>3; i-- {
+		v = v<<8 | uint64(b.data[i])
+	}
+	return v >> uint(lo&7) & (1<<n - 1)
+}
+
+func (b *revBits) read(n uint8) uint32 {
+	v := b.peek(n)
+	b.pos -= int(n)
+	return v
+}
+
+// fwdBits reads a little-endian bitstream forwards, as table
+// descriptions are written. Reading past the end yields zeros.
+type fwdBits struct {
+	data []byte
+	pos  int
+}
+
+func (b *fwdBits) peek(n int) uint32 {
+	var v uint64
+	for i := (b.pos + n - 1) >> 3; i >= b.pos>>3; i-- {
+		v <<= 8
+		if i < len(b.data) {
+			v |= uint64(b.data[i])
+		}
+	}
+	return uint32(v >> uint(b.pos&7) & (1<<n - 1))
+}
+
+func (b *fwdBits) read(n int) uint32 {
+	v := b.peek(n)
+	b.pos += n
+	return v
+}
+
+type fseEntry struct {
+	sym  uint8
+	bits uint8
+	base uint16
+}
+
+type fseTable struct {
+	log     uint8
+	entries []fseEntry
+}
+
+// readFSECounts reads an FSE table description, returning the normalized
+// counts, the accuracy log and the bytes consumed.
+func readFSECounts(src []byte, maxSym int, maxLog uint8) ([]int16, uint8, int, error) {
+	br := fwdBits{data: src}
+	log := uint8(br.read(4)) + 5
+	if log > maxLog {
+		return nil, 0, 0, errZstdCorrupt
+	}
+	remaining := 1<<log + 1
+	threshold := 1 << log
+	nbBits := int(log) + 1
+	var norm []int16
+	prevZero := false
+	for remaining > 1 && len(norm) <= maxSym {
+		if prevZero {
+			// Repeat flags: 2 bits each, 3 meaning three more zeros follow.
+			zeros := 0
+			for br.peek(16) == 0xFFFF && br.pos < len(src)*8 {
+				zeros += 24
+				br.pos += 16
+			}
+			for br.peek(2) == 3 {
+				zeros += 3
+				br.pos += 2
+			}
+			zeros += int(br.read(2))
+			if len(norm)+zeros > maxSym {
+				return nil, 0, 0, errZstdCorrupt
+			}
+			for range zeros {
+				norm = append(norm, 0)
+			}
+		}
+		limit := 2*threshold - 1 - remaining
+		count := int(br.peek(nbBits - 1))
+		if count < limit {
+			br.pos += nbBits - 1
+		} else {
+			count = int(br.peek(nbBits))
+			if count >= threshold {
+				count -= limit
+			}
+			br.pos += nbBits
+		}
+		count--
+		if count < 0 {
+			remaining--
+		} else {
+			remaining -= count
+		}
+		norm = append(norm, int16(count))
+		prevZero = count == 0
+		for remaining < threshold && threshold > 1 {
+			nbBits--
+			threshold >>= 1
+		}
+	}
+	if remaining != 1 || br.pos > len(src)*8 {
+		return nil, 0, 0, errZstdCorrupt
+	}
+	return norm, log, (br.pos + 7) / 8, nil
+}
+
+// buildFSETable spreads the symbols of a normalized distribution over a
+// decoding table.
+func buildFSETable(norm []int16, log uint8) (*fseTable, error) {
+	size := 1 << log
+	t := &fseTable{log: log, entries: make([]fseEntry, size)}
+	next := make([]int, len(norm))
+	high := size - 1
+	for s, c := range norm {
+		if c == -1 {
+			t.entries[high].sym = uint8(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = int(c)
+		}
+	}
+	step := size>>1 + size>>3 + 3
+	pos := 0
+	for s, c := range norm {
+		for range int(c) {
+			t.entries[pos].sym = uint8(s)
+			pos = (pos + step) & (size - 1)
+			for pos > high {
+				pos = (pos + step) & (size - 1)
+			}
+		}
+	}
+	if pos != 0 {
+		return nil, errZstdCorrupt
+	}
+	for i := range t.entries {
+		e := &t.entries[i]
+		state := next[e.sym]
+		next[e.sym]++
+		e.bits = log - uint8(bits.Len(uint(state))-1)
+		e.base = uint16(state<<e.bits - size)
+	}
+	return t, nil
+}
+
+func mustFSETable(norm []int16, log uint8) *fseTable {
+	t, err := buildFSETable(norm, log)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// The predefined sequence tables and code values of RFC 8878 section 3.1.1.3.2.
+var (
+	zstdLLDefault = mustFSETable([]int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}, 6)
+	zstdMLDefault = mustFSETable([]int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}, 6)
+	zstdOFDefault = mustFSETable([]int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}, 5)
+
+	zstdLLBase = [36]uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 0x80, 0x100, 0x200, 0x400, 0x800, 0x1000,
+		0x2000, 0x4000, 0x8000, 0x10000,
+	}
+	zstdLLBits = [36]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16,
+	}
+	zstdMLBase = [53]uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 0x83, 0x103, 0x203, 0x403, 0x803,
+		0x1003, 0x2003, 0x4003, 0x8003, 0x10003,
+	}
+	zstdMLBits = [53]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16,
+	}
+)
+
+type huffEntry struct {
+	sym  uint8
+	bits uint8
+}
+
+type huffTable struct {
+	log     uint8
+	entries []huffEntry
+}
+
+// readHuffmanTable reads the Huffman tree description of a compressed
+// literals section, returning the decoding table and the bytes consumed.
+func readHuffmanTable(src []byte) (*huffTable, int, error) {
+	if len(src) == 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	var weights [256]uint8
+	var n, used int
+	if hb := int(src[0]); hb >= 128 {
+		n, used = hb-127, 1+(hb-127+1)/2
+		if len(src) < used {
+			return nil, 0, errZstdCorrupt
+		}
+		for i := range n {
+			b := src[1+i/2]
+			if i%2 == 0 {
+				weights[i] = b >> 4
+			} else {
+				weights[i] = b & 15
+			}
+		}
+	} else {
+		used = 1 + hb
+		if len(src) < used {
+			return nil, 0, errZstdCorrupt
+		}
+		var err error
+		if n, err = decodeHuffmanWeights(src[1:used], weights[:255]); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// The last symbol's weight is implied: it completes the total to a
+	// power of two.
+	var total uint32
+	for _, w := range weights[:n] {
+		if w > zstdMaxHuffmanLog {
+			return nil, 0, errZstdCorrupt
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	log := uint8(bits.Len32(total))
+	left := uint32(1)<<log - total
+	if log > zstdMaxHuffmanLog || left&(left-1) != 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	weights[n] = uint8(bits.Len32(left))
+	n++
+
+	var start [zstdMaxHuffmanLog + 2]int
+	var counts [zstdMaxHuffmanLog + 2]int
+	for _, w := range weights[:n] {
+		counts[w]++
+	}
+	next := 0
+	for w := 1; w <= int(log); w++ {
+		start[w] = next
+		next += counts[w] << (w - 1)
+	}
+	t := &huffTable{log: log, entries: make([]huffEntry, 1<<log)}
+	for s, w := range weights[:n] {
+		if w == 0 {
+			continue
+		}
+		length := 1 << (w - 1)
+		e := huffEntry{sym: uint8(s), bits: log + 1 - w}
+		for i := start[w]; i < start[w]+length; i++ {
+			t.entries[i] = e
+		}
+		start[w] += length
+	}
+	return t, used, nil
+}
+
+// decodeHuffmanWeights decodes FSE-compressed Huffman weights into dst,
+// returning how many there are.
+func decodeHuffmanWeights(src []byte, dst []uint8) (int, error) {
+	norm, log, n, err := readFSECounts(src, zstdMaxHuffmanLog+1, 6)
+	if err != nil {
+		return 0, err
+	}
+	t, err := buildFSETable(norm, log)
+	if err != nil {
+		return 0, err
+	}
+	br, err := newRevBits(src[n:])
+	if err != nil {
+		return 0, err
+	}
+	// Two interleaved states; the stream ends when an update reads past
+	// its start, and the other state then holds the last weight.
+	states := [2]uint32{br.read(log), br.read(log)}
+	count := 0
+	for i := 0; ; i ^= 1 {
+		if count >= len(dst)-1 {
+			return 0, errZstdCorrupt
+		}
+		e := t.entries[states[i]]
+		dst[count] = e.sym
+		count++
+		states[i] = uint32(e.base) + br.read(e.bits)
+		if br.pos < 0 {
+			dst[count] = t.entries[states[i^1]].sym
+			return count + 1, nil
+		}
+	}
+}
+
+// decode appends size symbols decoded from src, in one stream or four.
+func (t *huffTable) decode(dst, src []byte, size, streams int) ([]byte, error) {
+	if streams == 1 {
+		return t.decodeStream(dst, src, size)
+	}
+	if len(src) < 6 {
+		return nil, errZstdCorrupt
+	}
+	seg := (size + 3) / 4
+	lens := [4]int{
+		int(binary.LittleEndian.Uint16(src)),
+		int(binary.LittleEndian.Uint16(src[2:])),
+		int(binary.LittleEndian.Uint16(src[4:])),
+	}
+	lens[3] = len(src) - 6 - lens[0] - lens[1] - lens[2]
+	if lens[3] < 0 || size-3*seg < 0 {
+		return nil, errZstdCorrupt
+	}
+	src = src[6:]
+	for i, n := range lens {
+		want := seg
+		if i == 3 {
+			want = size - 3*seg
+		}
+		var err error
+		if dst, err = t.decodeStream(dst, src[:n], want); err != nil {
+			return nil, err
+		}
+		src = src[n:]
+	}
+	return dst, nil
+}
+
+func (t *huffTable) decodeStream(dst, src []byte, size int) ([]byte, error) {
+	br, err := newRevBits(src)
+	if err != nil {
+		return nil, err
+	}
+	for range size {
+		e := t.entries[br.peek(t.log)]
+		br.pos -= int(e.bits)
+		dst = append(dst, e.sym)
+	}
+	if br.pos != 0 {
+		return nil, errZstdCorrupt
+	}
+	return dst, nil
+}
+
+// xxh64 is the XXH64 hash zstd uses for content checksums, with seed 0.
+type xxh64 struct {
+	v     [4]uint64
+	total uint64
+	buf   [32]byte
+	n     int
+}
+
+const (
+	xxhPrime1 uint64 = 11400714785074694791
+	xxhPrime2 uint64 = 14029467366897019727
+	xxhPrime3 uint64 = 1609587929392839161
+	xxhPrime4 uint64 = 9650029242287828579
+	xxhPrime5 uint64 = 2870177450012600261
+)
+
+func newXXH64() xxh64 {
+	p1, p2 := xxhPrime1, xxhPrime2
+	return xxh64{v: [4]uint64{p1 + p2, p2, 0, -p1}}
+}
+
+func xxhRound(acc, input uint64) uint64 {
+	acc += input * xxhPrime2
+	return bits.RotateLeft64(acc, 31) * xxhPrime1
+}
+
+func xxhMerge(acc, v uint64) uint64 {
+	acc ^= xxhRound(0, v)
+	return acc*xxhPrime1 + xxhPrime4
+}
+
+func (x *xxh64) write(p []byte) {
+	x.total += uint64(len(p))
+	if x.n > 0 {
+		c := copy(x.buf[x.n:], p)
+		x.n += c
+		p = p[c:]
+		if x.n < 32 {
+			return
+		}
+		x.stripe(x.buf[:])
+		x.n = 0
+	}
+	for ; len(p) >= 32; p = p[32:] {
+		x.stripe(p)
+	}
+	x.n = copy(x.buf[:], p)
+}
+
+func (x *xxh64) stripe(p []byte) {
+	for i := range x.v {
+		x.v[i] = xxhRound(x.v[i], binary.LittleEndian.Uint64(p[i*8:]))
+	}
+}
+
+func (x *xxh64) sum() uint64 {
+	var h uint64
+	if x.total >= 32 {
+		v := x.v
+		h = bits.RotateLeft64(v[0], 1) + bits.RotateLeft64(v[1], 7) +
+			bits.RotateLeft64(v[2], 12) + bits.RotateLeft64(v[3], 18)
+		for _, vi := range v {
+			h = xxhMerge(h, vi)
+		}
+	} else {
+		h = xxhPrime5
+	}
+	h += x.total
+	p := x.buf[:x.n]
+	for ; len(p) >= 8; p = p[8:] {
+		h ^= xxhRound(0, binary.LittleEndian.Uint64(p))
+		h = bits.RotateLeft64(h, 27)*xxhPrime1 + xxhPrime4
+	}
+	if len(p) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(p)) * xxhPrime1
+		h = bits.RotateLeft64(h, 23)*xxhPrime2 + xxhPrime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		h ^= uint64(b) * xxhPrime5
+		h = bits.RotateLeft64(h, 11) * xxhPrime1
+	}
+	h ^= h >> 33
+	h *= xxhPrime2
+	h ^= h >> 29
+	h *= xxhPrime3
+	h ^= h >> 32
+	return h
+}
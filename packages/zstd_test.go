@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// zstdCorpus is the text in testdata/corpus.zst, compressed twice: once
+// at -19 with a checksum, a frame of known size, and once streamed at -3
+// without one. Numbered lines of a few words, broken up by stretches of
+// noise, span several blocks and every literals and sequence mode.
+func zstdCorpus() []byte {
+	words := []string{"vira", "package", "registry", "archive", "lock", "frame", "block", "window"}
+	var b bytes.Buffer
+	x := uint32(1)
+	for i := 0; b.Len() < 300<<10; i++ {
+		x = x*1664525 + 1013904223
+		fmt.Fprintf(&b, "%d %s %s\n", i, words[x>>29], words[x>>26&7])
+		if i%5000 == 4999 {
+			for range 4096 {
+				x = x*1664525 + 1013904223
+				b.WriteByte(byte(x >> 24))
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+func TestZstdReader(t *testing.T) {
+	corpus, err := os.ReadFile(filepath.Join("testdata", "corpus.zst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := zstdCorpus()
+	tampered, err := os.ReadFile(filepath.Join("testdata", "math.tar.zst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered[len(tampered)-1] ^= 1
+	magic := []byte{0x28, 0xb5, 0x2f, 0xfd}
+	// A frame of known size 5 holding a raw block and an RLE block.
+	small := append(bytes.Clone(magic), 0x20, 5, 0x10, 0, 0, 'h', 'i', 0x1b, 0, 0, 'x')
+	skippable := []byte{0x50, 0x2a, 0x4d, 0x18, 3, 0, 0, 0, 'a', 'b', 'c'}
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []byte
+		wantErr string
+	}{
+		{"frames with and without checksum", corpus, append(bytes.Clone(text), text...), ""},
+		{"raw and RLE blocks", small, []byte("hixxx"), ""},
+		{"skippable frame", append(skippable, small...), []byte("hixxx"), ""},
+		{"empty", nil, nil, "unexpected EOF"},
+		{"truncated", corpus[:len(corpus)/2], nil, "unexpected EOF"},
+		{"bad checksum", tampered, nil, "zstd: checksum mismatch"},
+		{"not zstd", []byte("hello"), nil, "zstd: invalid header"},
+		{"dictionary", append(bytes.Clone(magic), 0x01, 0x00, 7), nil, "dictionaries are not supported"},
+		{"window too large", append(bytes.Clone(magic), 0x00, 18<<3), nil, "exceeds the limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := io.ReadAll(newZstdReader(bytes.NewReader(tt.data)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("decoded %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestXXH64(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"abc", 0x44bc2cf5ad770999},
+	}
+	for _, tt := range tests {
+		x := newXXH64()
+		x.write([]byte(tt.in))
+		if got := x.sum(); got != tt.want {
+			t.Errorf("xxh64(%q) = %#x, want %#x", tt.in, got, tt.want)
+		}
+	}
+}